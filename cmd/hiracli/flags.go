@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"hiracli/llm"
+)
+
+// stringListFlag は、繰り返し指定できる文字列フラグです
+type stringListFlag []string
+
+func (f *stringListFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringListFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// keyValueFlag は、key=value 形式で繰り返し指定できるフラグです
+type keyValueFlag map[string]string
+
+func (f keyValueFlag) String() string {
+	pairs := make([]string, 0, len(f))
+	for key, value := range f {
+		pairs = append(pairs, key+"="+value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f keyValueFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("key=value の形式で指定してください: %s", value)
+	}
+	f[key] = val
+	return nil
+}
+
+// optionalFloatFlag は、指定されなかった場合にnilとなる小数フラグです
+type optionalFloatFlag struct {
+	value *float64
+}
+
+func (f *optionalFloatFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f.value, 'g', -1, 64)
+}
+
+func (f *optionalFloatFlag) Set(value string) error {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return fmt.Errorf("数値で指定してください: %s", value)
+	}
+	f.value = &v
+	return nil
+}
+
+// optionalIntFlag は、指定されなかった場合にnilとなる整数フラグです
+type optionalIntFlag struct {
+	value *int
+}
+
+func (f *optionalIntFlag) String() string {
+	if f.value == nil {
+		return ""
+	}
+	return strconv.Itoa(*f.value)
+}
+
+func (f *optionalIntFlag) Set(value string) error {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return fmt.Errorf("整数で指定してください: %s", value)
+	}
+	f.value = &v
+	return nil
+}
+
+// inferenceFlags は、llm ask と git diff-comment で共通の推論パラメータのフラグです
+// 最大出力トークン数は設定ファイルと同じ優先順位で扱うため、loadSettingsを経由して参照します
+type inferenceFlags struct {
+	temperature   optionalFloatFlag
+	topP          optionalFloatFlag
+	topK          optionalIntFlag
+	stopSequences stringListFlag
+	autoContinue  *int
+}
+
+// registerInferenceFlags は、推論パラメータのフラグをフラグセットに登録する関数です
+func registerInferenceFlags(fs *flag.FlagSet) *inferenceFlags {
+	f := &inferenceFlags{}
+	fs.Int("max-tokens", 0, "最大出力トークン数（デフォルト: 設定ファイルのmax_tokens、0の場合は1000）")
+	fs.Var(&f.temperature, "temperature", "温度（未指定の場合はモデルのデフォルト）")
+	fs.Var(&f.topP, "top-p", "top-p（0から1、未指定の場合はモデルのデフォルト）")
+	fs.Var(&f.topK, "top-k", "top-k（未指定の場合はモデルのデフォルト）")
+	fs.Var(&f.stopSequences, "stop", "停止シーケンス（複数指定可）")
+	f.autoContinue = fs.Int("auto-continue", 0, "回答が最大出力トークン数で途切れた場合に続きを自動取得する回数")
+	return f
+}
+
+// params は、フラグの値と設定から推論パラメータを組み立てる関数です
+func (f *inferenceFlags) params(settings llm.Settings) llm.InferenceParams {
+	return llm.InferenceParams{
+		MaxTokens:     settings.MaxTokens,
+		Temperature:   f.temperature.value,
+		TopP:          f.topP.value,
+		TopK:          f.topK.value,
+		StopSequences: f.stopSequences,
+	}
+}
+
+// clientFlags は、Bedrock APIを呼び出すコマンドで共通のタイムアウトと再試行、AWSの接続先のフラグです
+// リージョン・プロファイル・ロールは設定ファイルと同じ優先順位で扱うため、loadSettingsを経由して参照します
+type clientFlags struct {
+	timeout    *time.Duration
+	maxRetries *int
+}
+
+// configProfileFlag は、使用する設定ファイルのプロファイルを指定するフラグの名前です
+// --profile はAWSの名前付きプロファイルを指定するため、別の名前にしています
+const configProfileFlag = "config-profile"
+
+// registerConfigProfileFlag は、設定ファイルのプロファイルを指定するフラグをフラグセットに登録する関数です
+func registerConfigProfileFlag(fs *flag.FlagSet) {
+	fs.String(configProfileFlag, "", "使用するhiracliの設定ファイルのプロファイル（デフォルト: HIRACLI_PROFILE、設定ファイルのprofile。AWSのプロファイルは --profile）")
+}
+
+// registerClientFlags は、タイムアウトと再試行、AWSの接続先のフラグをフラグセットに登録する関数です
+// 設定ファイルのプロファイルを指定するフラグも登録します
+func registerClientFlags(fs *flag.FlagSet) *clientFlags {
+	registerConfigProfileFlag(fs)
+	fs.String("region", "", "AWSのリージョン（デフォルト: 設定ファイルのregion、未設定の場合はAWSの設定）")
+	fs.String("profile", "", "AWSの名前付きプロファイル（デフォルト: 設定ファイルのaws_profile、未設定の場合はAWSの設定）")
+	fs.String("assume-role-arn", "", "Bedrockの呼び出しに引き受けるIAMロールのARN（デフォルト: 設定ファイルのassume_role_arn）")
+	return &clientFlags{
+		timeout:    fs.Duration("timeout", llm.DefaultTimeout, "API呼び出し全体のタイムアウト（例: 30s, 5m、0で無制限）"),
+		maxRetries: fs.Int("max-retries", llm.DefaultMaxRetries, "スロットリングなど一時的なエラーで再試行する最大回数"),
+	}
+}
+
+// options は、フラグの値と設定からタイムアウトと再試行、AWSの接続先の設定を組み立てる関数です
+func (f *clientFlags) options(settings llm.Settings) llm.ClientOptions {
+	return llm.ClientOptions{
+		Timeout:    *f.timeout,
+		MaxRetries: *f.maxRetries,
+		Region:     settings.Region,
+		Profile:    settings.AWSProfile,
+
+		AssumeRoleARN: settings.AssumeRoleARN,
+	}
+}
+
+// readSystemPrompt は、--system と --system-file からシステムプロンプトを取得する関数です
+func readSystemPrompt(system, systemFile string) (string, error) {
+	if systemFile == "" {
+		return system, nil
+	}
+	if system != "" {
+		return "", fmt.Errorf("--system と --system-file は同時に指定できません")
+	}
+
+	data, err := os.ReadFile(systemFile)
+	if err != nil {
+		return "", fmt.Errorf("システムプロンプトファイルの読み込みに失敗しました: %v", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// 設定ファイルの設定キーに対応するフラグ（フラグ名: 設定キー）
+var settingFlags = map[string]string{
+	"llm":              "default_model",
+	"lang":             "lang",
+	"max-tokens":       "max_tokens",
+	"max-input-tokens": "max_input_tokens",
+	"tokenizer":        "tokenizer",
+	"region":           "region",
+	"profile":          "aws_profile",
+	"assume-role-arn":  "assume_role_arn",
+}
+
+// loadSettings は、設定ファイルと環境変数の設定に、明示的に指定されたフラグの値を重ねる関数です
+// --config-profile が登録されている場合は、そのプロファイルを使用します
+func loadSettings(fs *flag.FlagSet) (*llm.LoadedConfig, error) {
+	var profile string
+	if f := fs.Lookup(configProfileFlag); f != nil {
+		profile = f.Value.String()
+	}
+	config, err := llm.LoadConfig(profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var overrideErr error
+	fs.Visit(func(f *flag.Flag) {
+		if key, ok := settingFlags[f.Name]; ok && overrideErr == nil {
+			overrideErr = config.OverrideFlag(key, f.Name, f.Value.String())
+		}
+	})
+	if overrideErr != nil {
+		return nil, overrideErr
+	}
+	return config, nil
+}
+
+// validateModel は、APIを呼び出す前に、キャッシュされたモデル一覧でモデルを検証する関数です
+// nameは指定されたモデルIDまたはエイリアス、modelIDは解決後のモデルIDです
+// 有効期限内のキャッシュがない場合やキャッシュを読み込めない場合は検証しません
+func validateModel(settings *llm.LoadedConfig, clientOpts llm.ClientOptions, name, modelID string) error {
+	models, err := llm.CachedModels(context.Background(), clientOpts, settings.CacheTTL())
+	if err != nil || models == nil {
+		return nil
+	}
+	aliases, err := settings.ModelAliases()
+	if err != nil {
+		return err
+	}
+	return llm.ValidateModelID(name, modelID, models, aliases)
+}
@@ -1,9 +1,16 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"hiracli/llm"
 	gitllm "hiracli/llm/git"
@@ -11,10 +18,18 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// 終了コード
+const (
+	exitCodeError       = 1   // 実行時のエラー
+	exitCodeUsage       = 2   // 引数の誤り
+	exitCodeInterrupted = 130 // Ctrl-Cによる中断
+)
+
 func main() {
-	err := godotenv.Load()
-	if err != nil {
-		fmt.Println("Error loading .env file")
+	// .envは環境変数として扱い、ファイルがない場合は何もしない
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		// 回答のみを標準出力に出力できるよう、警告は標準エラー出力に出す
+		fmt.Fprintf(os.Stderr, ".envファイルの読み込みエラー: %v\n", err)
 	}
 
 	if len(os.Args) < 2 {
@@ -27,6 +42,8 @@ func main() {
 		handleLLMCommand(os.Args[2:])
 	case "git":
 		handleGitCommand(os.Args[2:])
+	case "config":
+		handleConfigCommand(os.Args[2:])
 	default:
 		printHelp()
 		os.Exit(1)
@@ -42,21 +59,70 @@ func handleGitCommand(args []string) {
 	switch args[0] {
 	case "diff-comment":
 		gitDiffCmd := flag.NewFlagSet("git diff-comment", flag.ExitOnError)
-		llmModel := gitDiffCmd.String("llm", "anthropic.claude-3-5-sonnet-20240620-v1:0", "LLMのモデルを指定")
+		gitDiffCmd.String("llm", "", "LLMのモデルIDまたはエイリアス（デフォルト: 設定ファイルのdefault_model）")
 		cached := gitDiffCmd.Bool("cached", false, "ステージングされた変更の差分を使用")
+		noStream := gitDiffCmd.Bool("no-stream", false, "ストリーミングを使用せず、回答全体を受信してから表示する")
+		system := gitDiffCmd.String("system", "", "システムプロンプトを指定")
+		systemFile := gitDiffCmd.String("system-file", "", "システムプロンプトを記述したファイル")
+		templateName := gitDiffCmd.String("template", "diff-comment", "プロンプトテンプレート名")
+		gitDiffCmd.String("lang", "", "コミットメッセージの言語（デフォルト: 設定ファイルのlang、未設定の場合は日本語）")
+		vars := keyValueFlag{}
+		gitDiffCmd.Var(vars, "var", "テンプレートに渡す変数（key=value、複数指定可）")
+		api := gitDiffCmd.String("api", llm.APIInvoke, "モデルの呼び出しに使用するAPI（invoke または converse）")
+		inference := registerInferenceFlags(gitDiffCmd)
+		client := registerClientFlags(gitDiffCmd)
 
 		if err := gitDiffCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("引数のパースエラー: %v\n", err)
 			os.Exit(1)
 		}
 
+		if err := llm.ValidateAPI(*api); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		settings, err := loadSettings(gitDiffCmd)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		model, err := settings.ResolveModel("")
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		if err := validateModel(settings, client.options(settings.Settings), settings.DefaultModel, model); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		systemPrompt, err := readSystemPrompt(*system, *systemFile)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+
 		opts := gitllm.GitDiffOptions{
-			LLMModel: *llmModel,
+			LLMModel: model,
 			Cached:   *cached,
+			NoStream: *noStream,
+			Template: *templateName,
+			Lang:     settings.Lang,
+			System:   systemPrompt,
+			Vars:     vars,
+
+			Params:       inference.params(settings.Settings),
+			AutoContinue: *inference.autoContinue,
+			Client:       client.options(settings.Settings),
+			API:          *api,
 		}
 
-		if err := gitllm.GitDiffComment(opts); err != nil {
+		if err := gitllm.GitDiffComment(context.Background(), opts); err != nil {
 			fmt.Printf("エラー: %v\n", err)
+			if errors.Is(err, context.Canceled) {
+				os.Exit(exitCodeInterrupted)
+			}
 			os.Exit(1)
 		}
 	default:
@@ -73,48 +139,280 @@ func handleLLMCommand(args []string) {
 
 	switch args[0] {
 	case "list":
-		if err := llm.ListModels(); err != nil {
+		listCmd := flag.NewFlagSet("llm list", flag.ExitOnError)
+		aliases := listCmd.Bool("aliases", false, "モデルのエイリアスと対応するモデルIDを表示")
+		provider := listCmd.String("provider", "", "プロバイダー名で絞り込む（例: Anthropic）")
+		outputModality := listCmd.String("output-modality", "", "出力モダリティで絞り込む（TEXT, IMAGE, EMBEDDING）")
+		inputModality := listCmd.String("input-modality", "", "入力モダリティで絞り込む（TEXT, IMAGE など）")
+		inferenceType := listCmd.String("inference-type", "", "推論タイプで絞り込む（ON_DEMAND, PROVISIONED）")
+		customization := listCmd.String("customization", "", "カスタマイズの種類で絞り込む（FINE_TUNING, CONTINUED_PRE_TRAINING, DISTILLATION）")
+		sortBy := listCmd.String("sort", "id", "並べ替えのキー（id, name, provider）")
+		output := listCmd.String("output", llm.ListOutputTable, "出力形式（table, json, yaml, ids）")
+		access := listCmd.Bool("access", false, "このアカウントでのモデルアクセスの状態を取得して表示")
+		refresh := listCmd.Bool("refresh", false, "キャッシュを使用せず、モデル一覧をAPIから取得し直す")
+		cachedOnly := listCmd.Bool("cached", false, "APIを呼び出さず、キャッシュされたモデル一覧のみを表示（期限切れを含む）")
+		profiles := listCmd.Bool("profiles", false, "基盤モデルの代わりに推論プロファイル（システム定義とアプリケーション）を表示")
+		provisioned := listCmd.Bool("provisioned", false, "基盤モデルの代わりにプロビジョンドスループットを表示")
+		client := registerClientFlags(listCmd)
+
+		if err := listCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("引数のパースエラー: %v\n", err)
+			os.Exit(1)
+		}
+
+		settings, err := loadSettings(listCmd)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+
+		if *aliases {
+			if err := printModelAliases(settings, client.options(settings.Settings)); err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+
+		listOpts := llm.ListOptions{
+			Provider:       *provider,
+			OutputModality: *outputModality,
+			InputModality:  *inputModality,
+			InferenceType:  *inferenceType,
+			Customization:  *customization,
+			SortBy:         *sortBy,
+			Format:         *output,
+			CheckAccess:    *access,
+			CacheTTL:       settings.CacheTTL(),
+			Refresh:        *refresh,
+			CacheOnly:      *cachedOnly,
+			Profiles:       *profiles,
+			Provisioned:    *provisioned,
+		}
+		if *refresh && *cachedOnly {
+			fmt.Println("エラー: --refresh と --cached は同時に指定できません")
+			os.Exit(exitCodeUsage)
+		}
+		if err := listOpts.Validate(); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		// Ctrl-Cで一覧の取得を中断できるようにする
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if err := llm.ListModels(ctx, client.options(settings.Settings), listOpts); err != nil {
 			fmt.Printf("エラー: %v\n", err)
+			if errors.Is(err, context.Canceled) {
+				os.Exit(exitCodeInterrupted)
+			}
 			os.Exit(1)
 		}
 	case "ask":
 		llmAskCmd := flag.NewFlagSet("llm ask", flag.ExitOnError)
-		llmModel := llmAskCmd.String("llm", "anthropic.claude-3-5-sonnet-20240620-v1:0", "LLMのモデルを指定")
+		llmAskCmd.String("llm", "", "LLMのモデルIDまたはエイリアス（デフォルト: 設定ファイルのdefault_model）")
 		debug := llmAskCmd.Bool("debug", false, "デバッグモードを有効にする")
 		llmAskCmd.BoolVar(debug, "d", false, "デバッグモードを有効にする (shorthand)")
+		noStream := llmAskCmd.Bool("no-stream", false, "ストリーミングを使用せず、回答全体を受信してから表示する")
+		session := llmAskCmd.String("session", "", "会話を保存・再開するセッション名")
+		promptFile := llmAskCmd.String("prompt-file", "", "質問に添えるファイル（- で標準入力）")
+		system := llmAskCmd.String("system", "", "システムプロンプトを指定")
+		systemFile := llmAskCmd.String("system-file", "", "システムプロンプトを記述したファイル")
+		templateName := llmAskCmd.String("template", "", "プロンプトテンプレート名")
+		llmAskCmd.String("lang", "", "テンプレートに渡す回答の言語（デフォルト: 設定ファイルのlang、未設定の場合は日本語）")
+		vars := keyValueFlag{}
+		llmAskCmd.Var(vars, "var", "テンプレートに渡す変数（key=value、複数指定可）")
+		api := llmAskCmd.String("api", llm.APIInvoke, "モデルの呼び出しに使用するAPI（invoke または converse）")
+		tools := llmAskCmd.String("tools", "", "モデルに提供するツール（カンマ区切り、all ですべて）")
+		approveTools := llmAskCmd.Bool("approve-tools", false, "ツールの実行前に確認を求めない")
+		var attach stringListFlag
+		llmAskCmd.Var(&attach, "attach", "質問に添付する画像やドキュメント（PNG・JPEG・GIF・WebP・PDF・TXT・MD、複数指定可）")
+		inference := registerInferenceFlags(llmAskCmd)
+		client := registerClientFlags(llmAskCmd)
 
 		if err := llmAskCmd.Parse(args[1:]); err != nil {
-			fmt.Printf("引数のパースエラー: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintf(os.Stderr, "引数のパースエラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		settings, err := loadSettings(llmAskCmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		// 引数で質問が指定された場合や入力がパイプされた場合は、単発の質問として実行する
+		question, content, err := readAskInput(strings.Join(llmAskCmd.Args(), " "), *promptFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		prompt := composePrompt(question, content)
+
+		systemPrompt, err := readSystemPrompt(*system, *systemFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		// テンプレートが指定された場合は、質問とファイルの内容をテンプレートに適用する
+		if *templateName != "" {
+			if prompt == "" {
+				fmt.Fprintln(os.Stderr, "エラー: --template は質問または --prompt-file と組み合わせて指定してください")
+				os.Exit(exitCodeUsage)
+			}
+			rendered, err := llm.RenderTemplate(*templateName, llm.TemplateData{
+				Input: question,
+				Files: content,
+				Lang:  settings.Lang,
+				Vars:  vars,
+			})
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+				os.Exit(exitCodeUsage)
+			}
+			prompt = rendered.Prompt
+			if systemPrompt == "" {
+				systemPrompt = rendered.System
+			}
+		}
+
+		if err := inference.params(settings.Settings).Validate(); err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		if err := llm.ValidateAPI(*api); err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		model, err := settings.ResolveModel("")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		if err := validateModel(settings, client.options(settings.Settings), settings.DefaultModel, model); err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		attachments, err := llm.LoadAttachments(attach)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		// ツールは作業ディレクトリ配下でのみ動作する
+		var toolRegistry *llm.ToolRegistry
+		if *tools != "" {
+			workDir, err := os.Getwd()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "エラー: カレントディレクトリの取得に失敗しました: %v\n", err)
+				os.Exit(exitCodeError)
+			}
+			toolRegistry, err = llm.BuiltinTools(workDir).Select(strings.Split(*tools, ","))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+				os.Exit(exitCodeUsage)
+			}
 		}
 
 		opts := llm.AskOptions{
-			LLMModel:  *llmModel,
+			LLMModel:  model,
 			DebugMode: *debug,
+			Prompt:    prompt,
+			NoStream:  *noStream,
+			Session:   *session,
+			System:    systemPrompt,
+
+			Params:       inference.params(settings.Settings),
+			AutoContinue: *inference.autoContinue,
+			Client:       client.options(settings.Settings),
+			API:          *api,
+			Tools:        toolRegistry,
+			ApproveTools: *approveTools,
+			Attachments:  attachments,
 		}
 
-		if err := llm.Ask(opts); err != nil {
-			fmt.Printf("エラー: %v\n", err)
-			os.Exit(1)
+		if err := llm.Ask(context.Background(), opts); err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			if errors.Is(err, context.Canceled) {
+				os.Exit(exitCodeInterrupted)
+			}
+			os.Exit(exitCodeError)
 		}
+	case "check":
+		handleCheckCommand(args[1:])
+	case "sessions":
+		handleSessionsCommand(args[1:])
+	case "templates":
+		handleTemplatesCommand(args[1:])
+	case "usage":
+		handleUsageCommand(args[1:])
+	case "count-tokens":
+		handleCountTokensCommand(args[1:])
 	case "flatten-src":
 		flattenCmd := flag.NewFlagSet("llm flatten-src", flag.ExitOnError)
 		pattern := flattenCmd.String("pattern", "", "ファイルを検索する正規表現パターン")
-		extension := flattenCmd.String("extension", "", "ファイル拡張子でフィルタリング（例: *.go）")
-		maxTokens := flattenCmd.Int("max-input-tokens", 200000, "最大トークン数（デフォルト: 200000）")
+		extension := flattenCmd.String("extension", "", "ファイル拡張子でフィルタリング（例: *.go、カンマ区切りで複数指定可: *.go,*.md）")
+		var includes, excludes stringListFlag
+		flattenCmd.Var(&includes, "include", "対象にするファイルのglobパターン（例: **/*.go、! で始まるものは除外、複数指定可）")
+		flattenCmd.Var(&excludes, "exclude", "除外するファイルとディレクトリのglobパターン（例: **/*_test.go、複数指定可）")
+		flattenCmd.Int("max-input-tokens", 0, "最大トークン数（デフォルト: 設定ファイルのmax_input_tokens、未設定の場合は200000）")
+		flattenCmd.String("tokenizer", "", "トークン数を数えるトークナイザー（cl100k, o200k, heuristic、デフォルト: 設定ファイルのtokenizer、未設定の場合はcl100k）")
 		depthLimit := flattenCmd.Int("depth-limit", 10, "ディレクトリ探索の深さ制限（デフォルト: 10）")
 		debug := flattenCmd.Bool("debug", false, "デバッグモードを有効にする")
 		flattenCmd.BoolVar(debug, "d", false, "デバッグモードを有効にする (shorthand)")
 		path := flattenCmd.String("path", "", "検索を開始するディレクトリパス（デフォルト: カレントディレクトリ）")
 		flattenCmd.StringVar(path, "p", "", "検索を開始するディレクトリパス（デフォルト: カレントディレクトリ）")
+		noIgnore := flattenCmd.Bool("no-ignore", false, ".gitignore、.git/info/exclude、Gitのグローバルな除外設定、.hiracliignoreを使用しない")
+		hidden := flattenCmd.Bool("hidden", false, "隠しファイルと隠しディレクトリも対象にする（.gitは常に除外）")
+		gitTracked := flattenCmd.Bool("git-tracked", false, "Gitで管理されているファイルのみを対象にする")
+		gitChanged := flattenCmd.Bool("git-changed", false, "HEADから変更されたファイル（未追跡のファイルを含む）のみを対象にする")
+		gitStaged := flattenCmd.Bool("git-staged", false, "ステージングされたファイルのみを対象にする")
+		since := flattenCmd.String("since", "", "指定したGitの参照（ブランチ、タグ、コミット）から変更されたファイルのみを対象にする")
+		registerConfigProfileFlag(flattenCmd)
+		budget := flattenCmd.String("budget", llm.BudgetSkip, "トークン数の制限を超える場合の扱い（skip: 収まらないファイルを省略して続ける, stop: 収まらないファイルで終了する, truncate: 各ファイルをトークン数に比例して切り詰める）")
+		order := flattenCmd.String("order", llm.OrderPath, "ファイルを含める優先順位（path: パスの順, recent: 更新日時が新しい順, size: トークン数が少ない順）")
+		var weights stringListFlag
+		flattenCmd.Var(&weights, "weight", "パスの重み（glob=重み、例: cmd/**=10、重みが大きいファイルを優先する、複数指定可）")
 
 		if err := flattenCmd.Parse(args[1:]); err != nil {
 			fmt.Printf("引数のパースエラー: %v\n", err)
 			os.Exit(1)
 		}
 
-		if *pattern == "" && *extension == "" {
-			fmt.Println("エラー: --pattern または --extension のいずれかは必須です")
+		settings, err := loadSettings(flattenCmd)
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+
+		var gitFiles string
+		gitModes := 0
+		for mode, set := range map[string]bool{llm.GitFilesTracked: *gitTracked, llm.GitFilesChanged: *gitChanged, llm.GitFilesStaged: *gitStaged} {
+			if set {
+				gitFiles = mode
+				gitModes++
+			}
+		}
+		if gitModes > 1 {
+			fmt.Println("エラー: --git-tracked、--git-changed、--git-staged は同時に指定できません")
+			os.Exit(exitCodeUsage)
+		}
+		if err := llm.ValidateGitFiles(gitFiles, *since); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		if err := llm.ValidateFlattenBudget(*budget, *order, weights); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+
+		// Gitからファイル一覧を取得する場合は、絞り込みの条件を省略できる
+		if *pattern == "" && *extension == "" && len(includes) == 0 && gitFiles == "" && *since == "" {
+			fmt.Println("エラー: --pattern、--extension、--include、--git-tracked、--git-changed、--git-staged、--since のいずれかは必須です")
 			flattenCmd.PrintDefaults()
 			os.Exit(1)
 		}
@@ -133,10 +431,20 @@ func handleLLMCommand(args []string) {
 		opts := llm.FlattenOptions{
 			Pattern:        *pattern,
 			Extension:      *extension,
-			MaxInputTokens: *maxTokens,
+			Includes:       includes,
+			Excludes:       excludes,
+			MaxInputTokens: settings.MaxInputTokens,
+			Tokenizer:      settings.Tokenizer,
 			DepthLimit:     *depthLimit,
 			DebugMode:      *debug,
 			BasePath:       basePath,
+			NoIgnore:       *noIgnore,
+			Hidden:         *hidden,
+			GitFiles:       gitFiles,
+			Since:          *since,
+			Budget:         *budget,
+			Order:          *order,
+			Weights:        weights,
 		}
 
 		if err := llm.FlattenSrc(opts); err != nil {
@@ -149,11 +457,524 @@ func handleLLMCommand(args []string) {
 	}
 }
 
+// readAskInput は、llm askの引数とプロンプトファイルから質問とファイルの内容を読み込む関数です
+// 質問もファイルも指定されず、標準入力がパイプされている場合は標準入力を質問とします
+func readAskInput(question, promptFile string) (string, string, error) {
+	var content string
+
+	switch {
+	case promptFile == "-":
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", "", fmt.Errorf("標準入力の読み込みに失敗しました: %v", err)
+		}
+		content = string(data)
+	case promptFile != "":
+		data, err := os.ReadFile(promptFile)
+		if err != nil {
+			return "", "", fmt.Errorf("プロンプトファイルの読み込みに失敗しました: %v", err)
+		}
+		content = string(data)
+	case question == "" && isPiped(os.Stdin):
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", "", fmt.Errorf("標準入力の読み込みに失敗しました: %v", err)
+		}
+		question = strings.TrimSpace(string(data))
+		if question == "" {
+			return "", "", fmt.Errorf("標準入力から質問を読み込めませんでした")
+		}
+	}
+
+	if promptFile != "" && strings.TrimSpace(content) == "" && question == "" {
+		return "", "", fmt.Errorf("プロンプトファイルが空です")
+	}
+
+	return question, content, nil
+}
+
+// composePrompt は、質問とファイルの内容から単発の質問を組み立てる関数です
+// 空文字列を返した場合は対話モードで実行します
+func composePrompt(question, content string) string {
+	switch {
+	case content == "":
+		return question
+	case question == "":
+		return content
+	default:
+		return question + "\n\n" + content
+	}
+}
+
+// isPiped は、ファイルが端末ではなくパイプやリダイレクトかどうかを返す関数です
+func isPiped(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice == 0
+}
+
+// handleCheckCommand は、モデルに短いプロンプトを送信して動作を確認するコマンドを処理する関数です
+func handleCheckCommand(args []string) {
+	checkCmd := flag.NewFlagSet("llm check", flag.ExitOnError)
+	api := checkCmd.String("api", "", "使用するAPI（invoke または converse、デフォルト: モデルファミリーがあればinvoke）")
+	client := registerClientFlags(checkCmd)
+	checkCmd.Usage = func() {
+		fmt.Fprintln(os.Stderr, "使用方法: hiracli llm check [options] [model|alias]")
+		checkCmd.PrintDefaults()
+	}
+
+	if err := checkCmd.Parse(args); err != nil {
+		fmt.Fprintf(os.Stderr, "引数のパースエラー: %v\n", err)
+		os.Exit(exitCodeUsage)
+	}
+	if checkCmd.NArg() > 1 {
+		checkCmd.Usage()
+		os.Exit(exitCodeUsage)
+	}
+
+	settings, err := loadSettings(checkCmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+		os.Exit(exitCodeUsage)
+	}
+
+	// モデルが指定されていない場合は設定のデフォルトモデルを確認する
+	name := checkCmd.Arg(0)
+	if name == "" {
+		name = settings.DefaultModel
+	}
+	model, err := settings.ResolveModel(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+		os.Exit(exitCodeUsage)
+	}
+	if err := validateModel(settings, client.options(settings.Settings), name, model); err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+		os.Exit(exitCodeUsage)
+	}
+
+	// Ctrl-Cで確認を中断できるようにする
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := llm.CheckModel(ctx, llm.CheckOptions{
+		LLMModel: model,
+		API:      *api,
+		Client:   client.options(settings.Settings),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+		os.Exit(exitCodeError)
+	}
+
+	fmt.Printf("モデル:     %s\n", result.ModelID)
+	if result.Family != "" {
+		fmt.Printf("ファミリー: %s\n", result.Family)
+	}
+	fmt.Printf("API:        %s\n", result.API)
+	fmt.Printf("応答時間:   %s\n", result.Latency.Round(time.Millisecond))
+	if !result.OK() {
+		fmt.Println("結果:       NG")
+		fmt.Printf("エラー:     %v\n", result.Err)
+		if result.Hint != "" {
+			fmt.Printf("対処:       %s\n", result.Hint)
+		}
+		if errors.Is(result.Err, context.Canceled) {
+			os.Exit(exitCodeInterrupted)
+		}
+		os.Exit(exitCodeError)
+	}
+	fmt.Println("結果:       OK")
+	fmt.Printf("回答:       %s\n", result.Text)
+}
+
+func handleSessionsCommand(args []string) {
+	if len(args) < 1 {
+		printSessionsHelp()
+		os.Exit(1)
+	}
+
+	store, err := llm.DefaultSessionStore()
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		sessions, err := store.List()
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		if len(sessions) == 0 {
+			fmt.Println("保存されているセッションはありません")
+			return
+		}
+		for _, session := range sessions {
+			fmt.Printf("%s\t%s\t%s\tメッセージ: %d\tトークン: %d/%d\n",
+				session.Name,
+				session.ModelID,
+				session.UpdatedAt.Format("2006-01-02 15:04:05"),
+				len(session.Messages),
+				session.Usage.InputTokens,
+				session.Usage.OutputTokens,
+			)
+		}
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("エラー: セッション名を指定してください")
+			os.Exit(1)
+		}
+		session, err := store.Load(args[1])
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("セッション: %s\n", session.Name)
+		fmt.Printf("モデル: %s\n", session.ModelID)
+		fmt.Printf("作成日時: %s\n", session.CreatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("更新日時: %s\n", session.UpdatedAt.Format("2006-01-02 15:04:05"))
+		fmt.Printf("トークン数: 入力 %d / 出力 %d\n", session.Usage.InputTokens, session.Usage.OutputTokens)
+		for _, message := range session.Messages {
+			fmt.Printf("\n[%s] %s\n%s\n", message.Role, message.Timestamp.Format("2006-01-02 15:04:05"), message.Content)
+		}
+	case "rm":
+		if len(args) < 2 {
+			fmt.Println("エラー: セッション名を指定してください")
+			os.Exit(1)
+		}
+		for _, name := range args[1:] {
+			if err := store.Remove(name); err != nil {
+				fmt.Printf("エラー: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("セッション '%s' を削除しました\n", name)
+		}
+	case "export":
+		exportCmd := flag.NewFlagSet("llm sessions export", flag.ExitOnError)
+		output := exportCmd.String("output", "", "出力先のファイルパス（デフォルト: 標準出力）")
+		exportCmd.StringVar(output, "o", "", "出力先のファイルパス（デフォルト: 標準出力） (shorthand)")
+
+		if err := exportCmd.Parse(args[1:]); err != nil {
+			fmt.Printf("引数のパースエラー: %v\n", err)
+			os.Exit(1)
+		}
+		if exportCmd.NArg() < 1 {
+			fmt.Println("エラー: セッション名を指定してください")
+			os.Exit(1)
+		}
+
+		session, err := store.Load(exportCmd.Arg(0))
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+
+		out := os.Stdout
+		if *output != "" {
+			out, err = os.Create(*output)
+			if err != nil {
+				fmt.Printf("エラー: 出力ファイルの作成に失敗しました: %v\n", err)
+				os.Exit(1)
+			}
+			defer out.Close()
+		}
+
+		if err := session.WriteMarkdown(out); err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+	default:
+		printSessionsHelp()
+		os.Exit(1)
+	}
+}
+
+func handleTemplatesCommand(args []string) {
+	if len(args) < 1 {
+		printTemplatesHelp()
+		os.Exit(1)
+	}
+
+	switch args[0] {
+	case "list":
+		templates, err := llm.ListTemplates()
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		for _, name := range llm.SortedTemplateNames(templates) {
+			source := templates[name]
+			if source == "" {
+				source = "（組み込み）"
+			}
+			fmt.Printf("%s\t%s\n", name, source)
+		}
+	case "show":
+		if len(args) < 2 {
+			fmt.Println("エラー: テンプレート名を指定してください")
+			os.Exit(1)
+		}
+		source, err := llm.TemplateSource(args[1])
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(source)
+	case "path":
+		dir, err := llm.TemplateDir()
+		if err != nil {
+			fmt.Printf("エラー: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(dir)
+	default:
+		printTemplatesHelp()
+		os.Exit(1)
+	}
+}
+
+// handleCountTokensCommand は、ファイルまたは標準入力のトークン数を表示するコマンドを処理する関数です
+func handleCountTokensCommand(args []string) {
+	countCmd := flag.NewFlagSet("llm count-tokens", flag.ExitOnError)
+	countCmd.String("tokenizer", "", "トークン数を数えるトークナイザー（cl100k, o200k, heuristic、デフォルト: 設定ファイルのtokenizer、未設定の場合はcl100k）")
+	output := countCmd.String("output", llm.ListOutputTable, "出力形式（table, json, yaml）")
+	registerConfigProfileFlag(countCmd)
+
+	if err := countCmd.Parse(args); err != nil {
+		fmt.Printf("引数のパースエラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	settings, err := loadSettings(countCmd)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(exitCodeUsage)
+	}
+
+	// ファイルが指定されていない場合は標準入力から読み込む
+	if err := llm.CountTokens(llm.CountTokensOptions{
+		Files:     countCmd.Args(),
+		Tokenizer: settings.Tokenizer,
+		Format:    *output,
+	}); err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func handleUsageCommand(args []string) {
+	usageCmd := flag.NewFlagSet("llm usage", flag.ExitOnError)
+	since := usageCmd.String("since", "", "集計の開始時点（例: 7d, 2w, 12h, 2024-01-01）")
+	by := usageCmd.String("by", "", "集計キー（model, day, command, user）")
+
+	if err := usageCmd.Parse(args); err != nil {
+		fmt.Printf("引数のパースエラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	sinceTime, err := llm.ParseSince(*since, time.Now())
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	ledger, err := llm.DefaultUsageLedger()
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	records, err := ledger.Read(sinceTime, os.Stderr)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	summaries, err := llm.SummarizeUsage(records, *by)
+	if err != nil {
+		fmt.Printf("エラー: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(summaries) == 0 {
+		fmt.Println("記録されている使用量はありません")
+		return
+	}
+
+	// 全角文字はtabwriterで桁が揃わないため、見出しは英字で出力する
+	key := "TOTAL"
+	if *by != "" {
+		key = strings.ToUpper(*by)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\tCALLS\tINPUT\tOUTPUT\tCOST(USD)\n", key)
+	var total llm.UsageSummary
+	for _, summary := range summaries {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.4f\n", summary.Key, summary.Calls, summary.InputTokens, summary.OutputTokens, summary.CostUSD)
+		total.Calls += summary.Calls
+		total.InputTokens += summary.InputTokens
+		total.OutputTokens += summary.OutputTokens
+		total.CostUSD += summary.CostUSD
+	}
+	if *by != "" {
+		fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%.4f\n", total.Calls, total.InputTokens, total.OutputTokens, total.CostUSD)
+	}
+	w.Flush()
+}
+
+func handleConfigCommand(args []string) {
+	if len(args) < 1 {
+		printConfigHelp()
+		os.Exit(exitCodeUsage)
+	}
+
+	switch args[0] {
+	case "get":
+		getCmd := flag.NewFlagSet("config get", flag.ExitOnError)
+		registerConfigProfileFlag(getCmd)
+
+		if err := getCmd.Parse(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "引数のパースエラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		if getCmd.NArg() != 1 {
+			fmt.Fprintln(os.Stderr, "エラー: 設定キーを1つ指定してください")
+			os.Exit(exitCodeUsage)
+		}
+		config, err := loadSettings(getCmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		value, _, err := config.Get(getCmd.Arg(0))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		fmt.Println(value)
+	case "set":
+		setCmd := flag.NewFlagSet("config set", flag.ExitOnError)
+		repo := setCmd.Bool("repo", false, "ユーザーの設定ファイルではなく、リポジトリの設定ファイル（.hiracli.yaml）に書き込む")
+		profile := setCmd.String(configProfileFlag, "", "指定したhiracliの設定ファイルのプロファイルの設定として書き込む（AWSのプロファイルではない）")
+
+		if err := setCmd.Parse(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "引数のパースエラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		if setCmd.NArg() != 2 {
+			fmt.Fprintln(os.Stderr, "エラー: 設定キーと値を指定してください")
+			os.Exit(exitCodeUsage)
+		}
+
+		path, err := configFilePath(*repo)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		if err := llm.SetConfigValue(path, *profile, setCmd.Arg(0), setCmd.Arg(1)); err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		fmt.Printf("%s を設定しました（%s）\n", setCmd.Arg(0), path)
+	case "list":
+		listCmd := flag.NewFlagSet("config list", flag.ExitOnError)
+		registerConfigProfileFlag(listCmd)
+
+		if err := listCmd.Parse(args[1:]); err != nil {
+			fmt.Fprintf(os.Stderr, "引数のパースエラー: %v\n", err)
+			os.Exit(exitCodeUsage)
+		}
+		config, err := loadSettings(listCmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+		for _, entry := range config.Entries() {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", entry.Key, entry.Value, entry.Source)
+		}
+		w.Flush()
+
+		if names := config.ProfileNames(); len(names) > 0 {
+			fmt.Printf("\n定義されているプロファイル: %s\n", strings.Join(names, ", "))
+		}
+	case "path":
+		userPath, err := llm.UserConfigPath()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		repoPath, err := configFilePath(true)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "エラー: %v\n", err)
+			os.Exit(exitCodeError)
+		}
+		fmt.Printf("user\t%s\n", userPath)
+		fmt.Printf("repo\t%s\n", repoPath)
+	default:
+		printConfigHelp()
+		os.Exit(exitCodeUsage)
+	}
+}
+
+// configFilePath は、config set の書き込み先の設定ファイルのパスを返す関数です
+func configFilePath(repo bool) (string, error) {
+	if !repo {
+		return llm.UserConfigPath()
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("カレントディレクトリの取得に失敗しました: %v", err)
+	}
+	return llm.RepoConfigPath(wd)
+}
+
+// printModelAliases は、モデルのエイリアスと対応するモデルID、定義元を表示する関数です
+// エイリアスの指すモデルがキャッシュされたモデル一覧にない場合は警告を表示します
+func printModelAliases(config *llm.LoadedConfig, clientOpts llm.ClientOptions) error {
+	aliases, err := config.ModelAliases()
+	if err != nil {
+		return err
+	}
+	defaultModel, err := config.ResolveModel("")
+	if err != nil {
+		return err
+	}
+	models, _ := llm.CachedModels(context.Background(), clientOpts, config.CacheTTL())
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ALIAS\tMODEL\tSOURCE")
+	for _, alias := range aliases {
+		source := alias.Source
+		if source == "" {
+			source = "builtin"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", alias.Name, alias.ModelID, source)
+	}
+	w.Flush()
+
+	fmt.Printf("\nデフォルトのモデル: %s\n", defaultModel)
+	for _, alias := range aliases {
+		if err := llm.ValidateModelID(alias.ModelID, alias.ModelID, models, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "警告: エイリアス %s のモデル %s はこのリージョンのモデル一覧にありません\n", alias.Name, alias.ModelID)
+		}
+	}
+	return nil
+}
+
 func printHelp() {
 	fmt.Println("使用方法: hiracli <command> [options]")
 	fmt.Println("\nコマンド:")
 	fmt.Println("  llm    LLM関連のコマンド")
 	fmt.Println("  git    Git関連のコマンド")
+	fmt.Println("  config 設定を表示・変更")
 	fmt.Println("\n詳細なヘルプは各コマンドに -h または --help オプションを付けて実行してください")
 }
 
@@ -161,13 +982,70 @@ func printLLMHelp() {
 	fmt.Println("使用方法: hiracli llm <subcommand> [options]")
 	fmt.Println("\nサブコマンド:")
 	fmt.Println("  list         利用可能なLLMモデルを表示")
+	fmt.Println("               [--provider name] [--output-modality m] [--input-modality m]")
+	fmt.Println("               [--inference-type t] [--customization c] [--sort id|name|provider]")
+	fmt.Println("               [--output table|json|yaml|ids] [--access] [--refresh|--cached]")
+	fmt.Println("               [--profiles|--provisioned] [--aliases] [--region region] [--profile name]")
+	fmt.Println("               [--assume-role-arn arn] [--timeout duration] [--max-retries n]")
 	fmt.Println("  ask          LLMに質問する")
+	fmt.Println("               [--llm model|alias] [--session name] [--no-stream] [--debug|-d]")
+	fmt.Println("               [--prompt-file file|-] [--system text|--system-file file]")
+	fmt.Println("               [--template name] [--lang lang] [--var key=value]")
+	fmt.Println("               [--max-tokens n] [--temperature t] [--top-p p] [--top-k k]")
+	fmt.Println("               [--stop seq] [--auto-continue n] [--api invoke|converse]")
+	fmt.Println("               [--tools name,...|all] [--approve-tools] [--attach file]")
+	fmt.Println("               [--region region] [--profile name] [--assume-role-arn arn]")
+	fmt.Println("               [--timeout duration] [--max-retries n] [question...]")
+	fmt.Println("  check        モデルに短いプロンプトを送信し、呼び出せるかと応答時間を確認")
+	fmt.Println("               [--api invoke|converse] [--region region] [--profile name]")
+	fmt.Println("               [--assume-role-arn arn] [--timeout duration] [model|alias]")
+	fmt.Println("  sessions     保存された会話セッションを管理（list|show|rm|export）")
+	fmt.Println("  templates    プロンプトテンプレートを管理（list|show|path）")
+	fmt.Println("  usage        トークン使用量と推定料金を集計")
+	fmt.Println("               [--since 7d] [--by model|day|command|user]")
+	fmt.Println("  count-tokens ファイルまたは標準入力のトークン数を表示")
+	fmt.Println("               [--tokenizer cl100k|o200k|heuristic] [--output table|json|yaml] [file...]")
 	fmt.Println("  flatten-src  ファイルをLLMチャットに適した形式で表示")
-	fmt.Println("               [--pattern pattern] [--extension *.ext] [--path|-p dir]")
-	fmt.Println("               [--depth-limit n] [--max-input-tokens n] [--debug|-d]")
+	fmt.Println("               [--pattern pattern] [--extension *.ext,...] [--include glob]")
+	fmt.Println("               [--exclude glob] [--path|-p dir]")
+	fmt.Println("               [--git-tracked|--git-changed|--git-staged|--since ref]")
+	fmt.Println("               [--depth-limit n] [--max-input-tokens n] [--tokenizer name]")
+	fmt.Println("               [--budget skip|stop|truncate] [--order path|recent|size]")
+	fmt.Println("               [--weight glob=n] [--no-ignore] [--hidden]")
+	fmt.Println("               [--debug|-d]")
+	fmt.Println("\nsessions、templates、usage 以外のサブコマンドでは、--config-profile name で設定ファイルの")
+	fmt.Println("プロファイルを指定できます（--profile はAWSの名前付きプロファイルです）")
 	fmt.Println("\n詳細なヘルプは各サブコマンドに -h または --help オプションを付けて実行してください")
 }
 
+func printSessionsHelp() {
+	fmt.Println("使用方法: hiracli llm sessions <subcommand> [options]")
+	fmt.Println("\nサブコマンド:")
+	fmt.Println("  list                       保存されているセッションの一覧を表示")
+	fmt.Println("  show <name>                セッションの内容を表示")
+	fmt.Println("  rm <name>...               セッションを削除")
+	fmt.Println("  export [-o file] <name>    セッションをMarkdown形式で出力")
+}
+
+func printTemplatesHelp() {
+	fmt.Println("使用方法: hiracli llm templates <subcommand>")
+	fmt.Println("\nサブコマンド:")
+	fmt.Println("  list         利用可能なテンプレートの一覧を表示")
+	fmt.Println("  show <name>  テンプレートの内容を表示")
+	fmt.Println("  path         ユーザー定義のテンプレートを配置するディレクトリを表示")
+}
+
+func printConfigHelp() {
+	fmt.Println("使用方法: hiracli config <subcommand> [options]")
+	fmt.Println("\nサブコマンド:")
+	fmt.Println("  get [--config-profile name] <key>                   設定値を表示")
+	fmt.Println("  set [--repo] [--config-profile name] <key> <value>  設定ファイルに値を書き込む")
+	fmt.Println("  list [--config-profile name]                        設定値と設定元の一覧を表示")
+	fmt.Println("  path                                                設定ファイルのパスを表示")
+	fmt.Println("\n設定キー: profile, default_model, aws_profile, region, assume_role_arn, lang,")
+	fmt.Println("          max_tokens, max_input_tokens, model_cache_ttl, tokenizer, aliases.<name>")
+}
+
 func printGitHelp() {
 	fmt.Println("使用方法: hiracli git <subcommand> [options]")
 	fmt.Println("\nサブコマンド:")
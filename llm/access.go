@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go"
+)
+
+// モデルアクセスの状態
+const (
+	AccessGranted           = "granted"            // 利用できる
+	AccessNotAuthorized     = "not-authorized"     // IAMやSCPで許可されていない
+	AccessNotEntitled       = "not-entitled"       // モデルアクセスが有効になっていない
+	AccessRegionUnavailable = "region-unavailable" // リージョンで提供されていない
+	AccessUnknown           = "unknown"            // 状態を取得できなかった
+)
+
+// モデルアクセスの状態を並行して取得する数
+const maxAccessRequests = 5
+
+// 本文が空のリクエストのSHA-256ハッシュ（署名に使用する）
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// ModelAvailability は、GetFoundationModelAvailability APIのレスポンスを定義する構造体です
+type ModelAvailability struct {
+	ModelID               string `json:"modelId"`
+	AgreementAvailability struct {
+		Status       string `json:"status"`
+		ErrorMessage string `json:"errorMessage"`
+	} `json:"agreementAvailability"`
+	AuthorizationStatus     string `json:"authorizationStatus"`
+	EntitlementAvailability string `json:"entitlementAvailability"`
+	RegionAvailability      string `json:"regionAvailability"`
+}
+
+// AccessStatus は、モデルアクセスの状態を1つの値にまとめて返します
+// 利用できない理由が複数ある場合は、リージョン・権限・モデルアクセス・利用規約の順に判定します
+func (a *ModelAvailability) AccessStatus() string {
+	switch {
+	case a.RegionAvailability == "NOT_AVAILABLE":
+		return AccessRegionUnavailable
+	case a.AuthorizationStatus == "NOT_AUTHORIZED":
+		return AccessNotAuthorized
+	case a.EntitlementAvailability == "NOT_AVAILABLE":
+		return AccessNotEntitled
+	case a.AgreementAvailability.Status != "" && a.AgreementAvailability.Status != "AVAILABLE":
+		return "agreement-" + strings.ToLower(strings.ReplaceAll(a.AgreementAvailability.Status, "_", "-"))
+	}
+	return AccessGranted
+}
+
+// ModelAccessAPI は、モデルアクセスの状態を取得するAPIのインターフェースです（テスト用にモック可能）
+type ModelAccessAPI interface {
+	GetFoundationModelAvailability(ctx context.Context, modelID string) (*ModelAvailability, error)
+}
+
+// デフォルトのモデルアクセスのクライアント生成関数
+var newModelAccessClient = func(cfg aws.Config) ModelAccessAPI {
+	return &modelAccessClient{cfg: cfg}
+}
+
+// modelAccessClient は、署名付きのHTTPリクエストでGetFoundationModelAvailability APIを呼び出すクライアントです
+// 使用しているバージョンのAWS SDKにはこのAPIが含まれていないため、REST APIを直接呼び出します
+type modelAccessClient struct {
+	cfg aws.Config
+}
+
+func (c *modelAccessClient) GetFoundationModelAvailability(ctx context.Context, modelID string) (*ModelAvailability, error) {
+	endpoint := fmt.Sprintf("https://bedrock.%s.amazonaws.com", c.cfg.Region)
+	if c.cfg.BaseEndpoint != nil {
+		endpoint = strings.TrimSuffix(*c.cfg.BaseEndpoint, "/")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/foundation-model-availability/"+url.PathEscape(modelID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの作成エラー: %v", err)
+	}
+
+	if c.cfg.Credentials == nil {
+		return nil, fmt.Errorf("AWSの認証情報が設定されていません")
+	}
+	credentials, err := c.cfg.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("AWSの認証情報の取得エラー: %v", err)
+	}
+	if err := v4.NewSigner().SignHTTP(ctx, credentials, req, emptyPayloadHash, "bedrock", c.cfg.Region, time.Now()); err != nil {
+		return nil, fmt.Errorf("リクエストの署名エラー: %v", err)
+	}
+
+	var httpClient aws.HTTPClient = http.DefaultClient
+	if c.cfg.HTTPClient != nil {
+		httpClient = c.cfg.HTTPClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("レスポンスの読み込みエラー: %v", err)
+	}
+
+	// エラーは他のAPIと同様にエラーコードで判定できるようにする（再試行の判定などに使用）
+	if resp.StatusCode != http.StatusOK {
+		code, _, _ := strings.Cut(resp.Header.Get("X-Amzn-Errortype"), ":")
+		if code == "" {
+			code = http.StatusText(resp.StatusCode)
+		}
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		_ = json.Unmarshal(body, &apiErr)
+		return nil, &smithy.GenericAPIError{Code: code, Message: apiErr.Message}
+	}
+
+	var availability ModelAvailability
+	if err := json.Unmarshal(body, &availability); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+	return &availability, nil
+}
+
+// annotateAccess は、モデルアクセスの状態を並行して取得し、モデルの情報に設定する関数です
+// 取得できなかったモデルはunknownとし、最初のエラーのみ警告として表示します
+func annotateAccess(ctx context.Context, client ModelAccessAPI, clientOpts ClientOptions, models []ModelInfo, errOut io.Writer) {
+	var wg sync.WaitGroup
+	var warnOnce sync.Once
+	sem := make(chan struct{}, maxAccessRequests)
+
+	for i := range models {
+		wg.Add(1)
+		go func(model *ModelInfo) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			var availability *ModelAvailability
+			err := withRetry(ctx, clientOpts, func(ctx context.Context) error {
+				var err error
+				availability, err = client.GetFoundationModelAvailability(ctx, model.ID)
+				return err
+			})
+			if err != nil {
+				model.Access = AccessUnknown
+				warnOnce.Do(func() {
+					fmt.Fprintf(errOut, "警告: モデルアクセスの状態を取得できませんでした（%s）: %v\n", model.ID, err)
+				})
+				return
+			}
+			model.Access = availability.AccessStatus()
+		}(&models[i])
+	}
+	wg.Wait()
+}
@@ -0,0 +1,146 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/smithy-go"
+)
+
+// モックのモデルアクセスのクライアント
+// モデルIDのプレフィックスごとに状態を返し、定義されていないモデルはエラーにします
+type MockModelAccessClient struct{}
+
+// モデルIDのプレフィックスに対応するモデルアクセスの状態（ダミーデータ）
+var mockAvailabilities = map[string]ModelAvailability{
+	"anthropic.": {AuthorizationStatus: "AUTHORIZED", EntitlementAvailability: "AVAILABLE", RegionAvailability: "AVAILABLE"},
+	"amazon.":    {AuthorizationStatus: "AUTHORIZED", EntitlementAvailability: "NOT_AVAILABLE", RegionAvailability: "AVAILABLE"},
+}
+
+func (m *MockModelAccessClient) GetFoundationModelAvailability(ctx context.Context, modelID string) (*ModelAvailability, error) {
+	for prefix, availability := range mockAvailabilities {
+		if strings.HasPrefix(modelID, prefix) {
+			availability.ModelID = modelID
+			return &availability, nil
+		}
+	}
+	return nil, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "not authorized"}
+}
+
+// モデルアクセスの状態の判定のテスト
+func TestModelAvailabilityAccessStatus(t *testing.T) {
+	testCases := []struct {
+		name         string
+		availability ModelAvailability
+		expect       string
+	}{
+		{name: "利用できる", availability: mockAvailabilities["anthropic."], expect: AccessGranted},
+		{name: "モデルアクセスが無効", availability: mockAvailabilities["amazon."], expect: AccessNotEntitled},
+		{name: "権限がない", availability: ModelAvailability{AuthorizationStatus: "NOT_AUTHORIZED", EntitlementAvailability: "NOT_AVAILABLE"}, expect: AccessNotAuthorized},
+		{name: "リージョンで提供されていない", availability: ModelAvailability{AuthorizationStatus: "NOT_AUTHORIZED", RegionAvailability: "NOT_AVAILABLE"}, expect: AccessRegionUnavailable},
+		{
+			name: "利用規約に未同意",
+			availability: func() ModelAvailability {
+				a := mockAvailabilities["anthropic."]
+				a.AgreementAvailability.Status = "NOT_AVAILABLE"
+				return a
+			}(),
+			expect: "agreement-not-available",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.availability.AccessStatus(); actual != tc.expect {
+				t.Errorf("モデルアクセスの状態が期待通りではありません。期待: %s, 実際: %s", tc.expect, actual)
+			}
+		})
+	}
+}
+
+// 署名付きリクエストでのモデルアクセスの状態の取得のテスト
+func TestModelAccessClient(t *testing.T) {
+	var authorization, path string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization, path = r.Header.Get("Authorization"), r.URL.EscapedPath()
+		if strings.Contains(path, "unknown") {
+			w.Header().Set("X-Amzn-Errortype", "ResourceNotFoundException:http://internal.amazon.com/coral/com.amazonaws.bedrock/")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"Model not found"}`))
+			return
+		}
+		w.Write([]byte(`{"modelId":"anthropic.claude-3-haiku-20240307-v1:0","agreementAvailability":{"status":"AVAILABLE"},"authorizationStatus":"AUTHORIZED","entitlementAvailability":"AVAILABLE","regionAvailability":"AVAILABLE"}`))
+	}))
+	defer server.Close()
+
+	client := newModelAccessClient(aws.Config{
+		Region:       "us-east-1",
+		BaseEndpoint: aws.String(server.URL),
+		Credentials:  credentials.NewStaticCredentialsProvider("AKIDEXAMPLE", "secret", ""),
+	})
+
+	availability, err := client.GetFoundationModelAvailability(context.Background(), "anthropic.claude-3-haiku-20240307-v1:0")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if availability.AccessStatus() != AccessGranted {
+		t.Errorf("モデルアクセスの状態が期待通りではありません: %+v", availability)
+	}
+	if path != "/foundation-model-availability/anthropic.claude-3-haiku-20240307-v1:0" {
+		t.Errorf("リクエストのパスが期待通りではありません: %s", path)
+	}
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(authorization, "/us-east-1/bedrock/aws4_request") {
+		t.Errorf("リクエストが署名されていません: %s", authorization)
+	}
+
+	// エラーはエラーコードで判定できること
+	_, err = client.GetFoundationModelAvailability(context.Background(), "unknown.model-v1")
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ResourceNotFoundException" || apiErr.ErrorMessage() != "Model not found" {
+		t.Errorf("エラーが期待通りではありません: %v", err)
+	}
+}
+
+// モデル一覧へのモデルアクセスの状態の表示のテスト
+func TestListModelsAccess(t *testing.T) {
+	useMockRuntimeClient(t)
+
+	var stdout, stderr bytes.Buffer
+	err := ListModels(context.Background(), ClientOptions{}, ListOptions{
+		OutputModality: "TEXT",
+		CheckAccess:    true,
+		Output:         &stdout,
+		ErrOutput:      &stderr,
+	})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimRight(stdout.String(), "\n"), "\n")
+	if !strings.HasSuffix(lines[0], "ACCESS") {
+		t.Errorf("見出しにACCESSが含まれていません: %s", lines[0])
+	}
+	expect := map[string]string{
+		"anthropic.claude-3-haiku-20240307-v1:0": AccessGranted,
+		"amazon.nova-pro-v1:0":                   AccessNotEntitled,
+		"cohere.rerank-v3-5:0":                   AccessUnknown,
+	}
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if status, ok := expect[fields[0]]; ok && fields[len(fields)-1] != status {
+			t.Errorf("モデル「%s」のモデルアクセスの状態が期待通りではありません。期待: %s, 実際: %s", fields[0], status, fields[len(fields)-1])
+		}
+	}
+
+	// 取得できなかったモデルの警告は1回のみ表示する
+	if strings.Count(stderr.String(), "警告:") != 1 {
+		t.Errorf("警告が期待通りではありません:\n%s", stderr.String())
+	}
+}
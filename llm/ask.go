@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/signal"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
 )
 
@@ -17,34 +20,194 @@ type AskOptions struct {
 	LLMModel  string
 	DebugMode bool
 	Prompt    string // プロンプトを直接指定する場合に使用
+	NoStream  bool   // ストリーミングを使用せず、回答全体を受信してから表示する場合にtrue
+	Session   string // 会話を保存・再開するセッション名（空の場合は保存しない）
+	System    string // システムプロンプト（空の場合は指定しない）
+	Command   string // 使用量の記録に残すコマンド名（デフォルト: llm ask）
+
+	Params       InferenceParams // 推論パラメータ
+	AutoContinue int             // 回答が最大出力トークン数で途切れた場合に自動で続きを取得する回数
+	Client       ClientOptions   // タイムアウトと再試行の設定
+	API          string          // モデルの呼び出しに使用するAPI（APIInvoke または APIConverse、空の場合はAPIInvoke）
+	Tools        *ToolRegistry   // モデルに提供するツール（nilの場合はツールを使用しない）
+	ApproveTools bool            // ツールの実行前に確認を求めない場合にtrue
+	Attachments  []ContentBlock  // 最初の質問に添付する画像やドキュメント（LoadAttachmentsで読み込んだもの）
+
+	Input     io.Reader // 対話モードの入力（nilの場合は標準入力）
+	Output    io.Writer // 回答の出力先（nilの場合は標準出力）
+	ErrOutput io.Writer // 警告やデバッグ情報の出力先（nilの場合は標準エラー出力）
+
+	baseModel string // ARNで指定されたモデルの、APIで解決した元の基盤モデルのID（resolveModelARNで設定）
+}
+
+// baseModelID は、モデルファミリーの判定や料金の計算に使用する、元の基盤モデルのIDを返します
+func (opts AskOptions) baseModelID() string {
+	if opts.baseModel != "" {
+		return opts.baseModel
+	}
+	return BaseModelID(opts.LLMModel)
+}
+
+// input は、対話モードの入力を返します
+func (opts AskOptions) input() io.Reader {
+	if opts.Input == nil {
+		return os.Stdin
+	}
+	return opts.Input
+}
+
+// output は、回答の出力先を返します
+func (opts AskOptions) output() io.Writer {
+	if opts.Output == nil {
+		return os.Stdout
+	}
+	return opts.Output
 }
 
+// errOutput は、警告やデバッグ情報の出力先を返します
+func (opts AskOptions) errOutput() io.Writer {
+	if opts.ErrOutput == nil {
+		return os.Stderr
+	}
+	return opts.ErrOutput
+}
+
+// continuePrompt は、途切れた回答の続きを要求する際にモデルへ送信するメッセージです
+const continuePrompt = "回答が途中で途切れました。直前の回答の続きから出力してください。前置きや繰り返しは不要です。"
+
+// maxToolRounds は、1回の質問でツールの実行結果をモデルに返す回数の上限です
+const maxToolRounds = 10
+
 // Ask は、指定されたLLMに対して質問を行い、回答を取得する関数です
-func Ask(opts AskOptions) error {
+// ctxがキャンセルされた場合は、受信中の回答を含めて処理を中断します
+func Ask(ctx context.Context, opts AskOptions) error {
+	if err := opts.Params.Validate(); err != nil {
+		return err
+	}
+	if err := ValidateAPI(opts.API); err != nil {
+		return err
+	}
+
+	if opts.LLMModel == "" {
+		opts.LLMModel = DefaultModelID
+	}
+
+	// ツールの呼び出しはConverse APIでのみ扱う
+	if opts.Tools != nil {
+		opts.API = APIConverse
+	}
+
+	// 再試行の通知も警告と同じ出力先に書き込む
+	if opts.Client.ErrOutput == nil {
+		opts.Client.ErrOutput = opts.ErrOutput
+	}
+
 	// AWSの設定を読み込み
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := loadAWSConfig(ctx, opts.Client)
+	if err != nil {
+		return err
+	}
+
+	// アプリケーション推論プロファイルやプロビジョンドスループットのARNは、元のモデルでモデルファミリーを判定する
+	opts.baseModel, err = resolveModelARN(ctx, cfg, opts.Client, opts.LLMModel)
 	if err != nil {
-		return fmt.Errorf("AWS設定の読み込みエラー: %v", err)
+		return err
+	}
+
+	// 添付ファイルをInvokeModelで送信できないモデルファミリーは、Converse APIで呼び出す
+	if len(opts.Attachments) > 0 && opts.API != APIConverse {
+		family, err := FindModelFamily(opts.baseModelID())
+		if _, ok := family.(contentBlockModelFamily); err != nil || !ok {
+			opts.API = APIConverse
+		}
+	}
+
+	// 画像を添付する場合は、モデルが画像の入力に対応しているかを確認する
+	if hasImageBlock(opts.Attachments) {
+		if err := checkImageInput(ctx, cfg, opts); err != nil {
+			return err
+		}
 	}
 
 	// BedrockRuntimeクライアントの作成
-	bedrockClient := bedrockruntime.NewFromConfig(cfg)
+	bedrockClient := newBedrockRuntimeClient(cfg)
+	out, errOut := opts.output(), opts.errOutput()
+
+	// 会話履歴の推定トークン数の上限（コンテキストウィンドウから出力分を除いたもの）
+	historyBudget := ContextWindow(opts.baseModelID()) - maxTokensOrDefault(opts.Params.MaxTokens)
+	var conversation Conversation
+
+	// セッションが指定されている場合は、保存済みの会話を再開する
+	var store *SessionStore
+	var session *Session
+	if opts.Session != "" {
+		store, err = DefaultSessionStore()
+		if err != nil {
+			return err
+		}
+		if store.Exists(opts.Session) {
+			session, err = store.Load(opts.Session)
+			if err != nil {
+				return err
+			}
+			conversation.Messages = session.ConversationMessages()
+			// システムプロンプトが指定されていない場合は、セッションのものを引き継ぐ
+			if opts.System == "" {
+				opts.System = session.System
+			}
+			fmt.Fprintf(errOut, "セッション '%s' を再開します（メッセージ %d 件）\n", session.Name, len(session.Messages))
+		} else {
+			session = NewSession(opts.Session, opts.LLMModel)
+		}
+		session.System = opts.System
+	}
+
+	// saveSession は、セッションが指定されている場合に現在の内容を保存する
+	saveSession := func() error {
+		if session == nil {
+			return nil
+		}
+		return store.Save(session)
+	}
+
+	// 対話モードの入力とツール実行の確認で同じ入力を読み取る
+	lines := bufio.NewScanner(opts.input())
+
+	// answer は、会話履歴に対する回答を取得する
+	// ツールが指定されている場合は、モデルが最終的な回答を返すまでツールを実行する
+	answer := func(messages []Message) (*ModelResponse, error) {
+		if opts.Tools == nil {
+			return processPrompt(ctx, opts, bedrockClient, messages)
+		}
+		return runToolLoop(ctx, opts, bedrockClient, messages, lines)
+	}
 
 	// プロンプトが指定されている場合は、そのプロンプトを使用
 	if opts.Prompt != "" {
-		return processPrompt(opts, bedrockClient, opts.Prompt)
+		conversation.AddUserWithAttachments(opts.Prompt, opts.Attachments)
+		conversation.Trim(historyBudget)
+		response, err := answer(conversation.Messages)
+		if err != nil {
+			return err
+		}
+		recordUsage(opts, response)
+		if session != nil {
+			session.AddTurn(opts.Prompt, response, opts.LLMModel)
+		}
+		return saveSession()
 	}
 
-	fmt.Println("質問を入力してください（終了するには 'exit' または 'quit' を入力）:")
-	scanner := bufio.NewScanner(os.Stdin)
+	fmt.Fprintln(out, "質問を入力してください（終了するには 'exit' または 'quit' を入力、コマンド一覧は '/help'）:")
 
+	// 添付ファイルは最初に回答を得られた質問にのみ添付する
+	attachments := opts.Attachments
 	for {
-		fmt.Print("> ")
-		if !scanner.Scan() {
+		fmt.Fprint(out, "> ")
+		if !lines.Scan() {
 			break
 		}
 
-		input := scanner.Text()
+		input := lines.Text()
 		if input == "exit" || input == "quit" {
 			break
 		}
@@ -53,98 +216,438 @@ func Ask(opts AskOptions) error {
 			continue
 		}
 
-		if err := processPrompt(opts, bedrockClient, input); err != nil {
+		if strings.HasPrefix(input, "/") {
+			runSlashCommand(out, &conversation, session, input)
+			if err := saveSession(); err != nil {
+				return err
+			}
+			continue
+		}
+
+		conversation.AddUserWithAttachments(input, attachments)
+
+		// コンテキストウィンドウを超えないよう古いやり取りを削除
+		if removed := conversation.Trim(historyBudget); removed > 0 {
+			fmt.Fprintf(errOut, "トークン数の上限を超えるため、古いメッセージを %d 件削除しました\n", removed)
+		}
+
+		response, err := answer(conversation.Messages)
+		if err != nil {
+			// 回答を得られなかった入力は履歴から取り除く
+			conversation.Undo()
+
+			// Ctrl-Cによる中断やタイムアウトの場合は対話を継続する
+			if ctx.Err() == nil && errors.Is(err, context.Canceled) {
+				fmt.Fprintln(errOut, "回答の受信を中断しました")
+				continue
+			}
+			if ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+				fmt.Fprintf(errOut, "エラー: %v\n", err)
+				continue
+			}
 			return err
 		}
+
+		conversation.AddAssistant(response.Text)
+		recordUsage(opts, response)
+		attachments = nil
+
+		if session != nil {
+			session.AddTurn(input, response, opts.LLMModel)
+			if err := saveSession(); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func processPrompt(opts AskOptions, bedrockClient *bedrockruntime.Client, input string) error {
-	// モデルに応じてリクエストを構築
-	var payload []byte
-	var err error
-
-	switch opts.LLMModel {
-	case "anthropic.claude-3-5-sonnet-20240620-v1:0":
-		payload, err = json.Marshal(map[string]interface{}{
-			"anthropic_version": "bedrock-2023-05-31",
-			"max_tokens":        1000,
-			"messages": []map[string]string{
-				{
-					"role":    "user",
-					"content": input,
-				},
-			},
-		})
-	case "amazon.titan-text-express-v1":
-		payload, err = json.Marshal(map[string]interface{}{
-			"inputText": input,
-			"textGenerationConfig": map[string]interface{}{
-				"maxTokenCount": 1000,
-				"stopSequences": []string{},
-				"temperature":   0.7,
-				"topP":          0.9,
-			},
-		})
+// runSlashCommand は、対話モードのスラッシュコマンドを実行する関数です
+// セッションが指定されている場合は、セッションの内容も合わせて更新します
+func runSlashCommand(out io.Writer, conversation *Conversation, session *Session, input string) {
+	switch strings.Fields(input)[0] {
+	case "/reset":
+		conversation.Reset()
+		if session != nil {
+			session.Reset()
+		}
+		fmt.Fprintln(out, "会話履歴をリセットしました")
+	case "/undo":
+		if conversation.Undo() {
+			if session != nil {
+				session.Undo()
+			}
+			fmt.Fprintln(out, "最後のやり取りを取り消しました")
+		} else {
+			fmt.Fprintln(out, "取り消すやり取りがありません")
+		}
+	case "/history":
+		if len(conversation.Messages) == 0 {
+			fmt.Fprintln(out, "会話履歴はありません")
+			return
+		}
+		for _, message := range conversation.Messages {
+			fmt.Fprintf(out, "[%s] %s\n", message.Role, message.Content)
+		}
+		fmt.Fprintf(out, "（推定トークン数: %d）\n", conversation.EstimatedTokens())
+	case "/help":
+		fmt.Fprintln(out, "コマンド:")
+		fmt.Fprintln(out, "  /reset    会話履歴をリセット")
+		fmt.Fprintln(out, "  /history  会話履歴を表示")
+		fmt.Fprintln(out, "  /undo     最後のやり取りを取り消す")
+		fmt.Fprintln(out, "  /help     このヘルプを表示")
 	default:
-		return fmt.Errorf("未対応のLLMモデル: %s", opts.LLMModel)
+		fmt.Fprintf(out, "不明なコマンド: %s（'/help' でコマンド一覧を表示）\n", input)
 	}
+}
+
+// runToolLoop は、モデルがツールの呼び出しを要求する間、ツールを実行して結果を返し、
+// 最終的な回答を取得する関数です
+// ツールの呼び出しと実行結果は今回の質問の中でのみ使用し、戻り値には各回の回答を連結したものを返します
+func runToolLoop(ctx context.Context, opts AskOptions, bedrockClient BedrockRuntimeAPI, messages []Message, lines *bufio.Scanner) (*ModelResponse, error) {
+	errOut := opts.errOutput()
+
+	var texts []string
+	var usage Usage
+	for round := 0; ; round++ {
+		response, err := processPrompt(ctx, opts, bedrockClient, messages)
+		if err != nil {
+			return nil, err
+		}
+		usage.Add(response.Usage)
+		if response.Text != "" {
+			texts = append(texts, response.Text)
+		}
+
+		var calls []ContentBlock
+		for _, block := range response.Blocks {
+			if block.Type == BlockToolUse {
+				calls = append(calls, block)
+			}
+		}
+		if len(calls) == 0 || round >= maxToolRounds {
+			if len(calls) > 0 {
+				fmt.Fprintf(errOut, "警告: ツールの実行回数が上限（%d）に達したため終了します\n", maxToolRounds)
+			}
+			return &ModelResponse{
+				Text:       strings.Join(texts, "\n\n"),
+				Usage:      usage,
+				StopReason: response.StopReason,
+				Truncated:  response.Truncated,
+			}, nil
+		}
+
+		// ツールの呼び出しをアシスタントの発言として追加し、実行結果をユーザーの発言として返す
+		var assistant []ContentBlock
+		if response.Text != "" {
+			assistant = append(assistant, TextBlock(response.Text))
+		}
+		assistant = append(assistant, calls...)
+
+		results := make([]ContentBlock, 0, len(calls))
+		for _, call := range calls {
+			results = append(results, executeTool(ctx, opts, lines, call))
+		}
+
+		messages = append(append([]Message{}, messages...),
+			NewMessage(RoleAssistant, assistant...),
+			NewMessage(RoleUser, results...),
+		)
+	}
+}
+
+// executeTool は、モデルが要求したツールを確認のうえ実行し、実行結果のコンテンツブロックを返す関数です
+// 実行できなかった場合も、その理由をエラーの実行結果としてモデルに返します
+func executeTool(ctx context.Context, opts AskOptions, lines *bufio.Scanner, call ContentBlock) ContentBlock {
+	errOut := opts.errOutput()
 
+	tool, ok := opts.Tools.Get(call.Name)
+	if !ok {
+		return ToolResultBlock(call.ToolUseID, fmt.Sprintf("不明なツールです: %s", call.Name), true)
+	}
+
+	if !opts.ApproveTools {
+		fmt.Fprintf(errOut, "ツール %s を実行しますか？ 入力: %s [y/N]: ", call.Name, string(call.Input))
+		if !lines.Scan() {
+			fmt.Fprintln(errOut, "\n確認の入力がないため、ツールを実行しませんでした（--approve-tools で確認を省略できます）")
+			return ToolResultBlock(call.ToolUseID, "ユーザーの確認を得られなかったため、ツールを実行しませんでした", true)
+		}
+		answer := strings.ToLower(strings.TrimSpace(lines.Text()))
+		if answer != "y" && answer != "yes" {
+			return ToolResultBlock(call.ToolUseID, "ユーザーがツールの実行を拒否しました", true)
+		}
+	} else {
+		fmt.Fprintf(errOut, "ツール %s を実行します: %s\n", call.Name, string(call.Input))
+	}
+
+	// Ctrl-Cでツールの実行を中断できるようにする
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	result, err := tool.Run(ctx, call.Input)
+	if err != nil {
+		if opts.DebugMode {
+			fmt.Fprintf(errOut, "ツール %s の実行エラー: %v\n", call.Name, err)
+		}
+		return ToolResultBlock(call.ToolUseID, fmt.Sprintf("エラー: %v", err), true)
+	}
+	if result == "" {
+		result = "（出力なし）"
+	}
+	return ToolResultBlock(call.ToolUseID, result, false)
+}
+
+// processPrompt は、会話履歴をモデルに送信して回答を表示し、回答を返す関数です
+// 回答が最大出力トークン数で途切れた場合は、AutoContinueの回数まで続きを取得して連結します
+func processPrompt(ctx context.Context, opts AskOptions, bedrockClient BedrockRuntimeAPI, messages []Message) (*ModelResponse, error) {
+	// モデルIDに対応するモデルファミリーを取得
+	// Converseの場合は、モデルファミリーはConverseに対応していない場合のフォールバックにのみ使用する
+	family, err := FindModelFamily(opts.baseModelID())
+	if err != nil && opts.API != APIConverse {
+		return nil, err
+	}
+
+	out, errOut := opts.output(), opts.errOutput()
+
+	// Ctrl-Cで回答の受信を中断できるようにする
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	// 続きの取得を含む回答全体にタイムアウトを設定する
+	ctx, cancel := withTimeout(ctx, opts.Client)
+	defer cancel()
+
+	prefix, suffix := answerDelimiters(opts)
+	fmt.Fprint(out, prefix)
+
+	var answer strings.Builder
+	var response *ModelResponse
+	var usage Usage
+	for attempt := 0; ; attempt++ {
+		response, err = callModel(ctx, opts, bedrockClient, family, messages)
+		if err != nil {
+			fmt.Fprint(out, suffix)
+			return nil, err
+		}
+		answer.WriteString(response.Text)
+		usage.Add(response.Usage)
+
+		if !response.Truncated || attempt >= opts.AutoContinue {
+			break
+		}
+
+		// 途切れた回答をアシスタントの発言として追加し、続きを要求する
+		messages = append(append([]Message{}, messages...),
+			Message{Role: RoleAssistant, Content: response.Text},
+			Message{Role: RoleUser, Content: continuePrompt},
+		)
+		if opts.DebugMode {
+			fmt.Fprintf(errOut, "\n回答が途切れたため続きを取得します（%d/%d）\n", attempt+1, opts.AutoContinue)
+		}
+	}
+	fmt.Fprint(out, suffix)
+
+	if answer.Len() == 0 && len(response.Blocks) == 0 {
+		return nil, fmt.Errorf("レスポンスから回答を抽出できませんでした")
+	}
+
+	if response.Truncated {
+		fmt.Fprintf(errOut, "警告: 最大出力トークン数（%d）に達したため、回答が途中で終了しました（--max-tokens で上限を変更するか、--auto-continue で続きを自動取得できます）\n", maxTokensOrDefault(opts.Params.MaxTokens))
+	}
+
+	return &ModelResponse{
+		Text:       answer.String(),
+		Blocks:     response.Blocks,
+		Usage:      usage,
+		StopReason: response.StopReason,
+		Truncated:  response.Truncated,
+	}, nil
+}
+
+// callModel は、指定されたAPIでモデルを1回呼び出す関数です
+// Converseに対応していないモデルは、モデルファミリーがあればInvokeModelにフォールバックします
+func callModel(ctx context.Context, opts AskOptions, bedrockClient BedrockRuntimeAPI, family ModelFamily, messages []Message) (*ModelResponse, error) {
+	if opts.API != APIConverse {
+		return invokeModel(ctx, opts, bedrockClient, family, messages)
+	}
+
+	response, err := converseModel(ctx, opts, bedrockClient, messages)
+	if err == nil || family == nil || !isConverseUnsupported(err) {
+		return response, err
+	}
+
+	fmt.Fprintf(opts.errOutput(), "警告: %s はConverse APIに対応していないため、InvokeModelで呼び出します（%v）\n", opts.LLMModel, err)
+	return invokeModel(ctx, opts, bedrockClient, family, messages)
+}
+
+// converseModel は、Converse APIでモデルを1回呼び出して回答を出力先に書き出す関数です
+func converseModel(ctx context.Context, opts AskOptions, bedrockClient BedrockRuntimeAPI, messages []Message) (*ModelResponse, error) {
+	out, errOut := opts.output(), opts.errOutput()
+
+	request := ModelRequest{System: opts.System, Messages: messages, Params: opts.Params}
+	if opts.Tools != nil {
+		request.Tools = opts.Tools.Tools()
+	}
+	input, err := buildConverseInput(opts.LLMModel, opts.baseModelID(), request)
 	if err != nil {
-		return fmt.Errorf("リクエストの構築エラー: %v", err)
+		return nil, fmt.Errorf("リクエストの構築エラー: %v", err)
 	}
 
 	if opts.DebugMode {
-		fmt.Printf("リクエスト:\n%s\n\n", string(payload))
+		payload, _ := json.MarshalIndent(request, "", "  ")
+		fmt.Fprintf(errOut, "リクエスト（Converse）:\n%s\n\n", string(payload))
+	}
+
+	if !opts.NoStream {
+		var output *bedrockruntime.ConverseStreamOutput
+		err := withRetry(ctx, opts.Client, func(ctx context.Context) error {
+			var err error
+			output, err = bedrockClient.ConverseStream(ctx, &bedrockruntime.ConverseStreamInput{
+				ModelId:                      input.ModelId,
+				Messages:                     input.Messages,
+				System:                       input.System,
+				InferenceConfig:              input.InferenceConfig,
+				AdditionalModelRequestFields: input.AdditionalModelRequestFields,
+				ToolConfig:                   input.ToolConfig,
+			})
+			return err
+		})
+		if err != nil {
+			return nil, callError(ctx, opts.Client, "モデル呼び出し", err)
+		}
+
+		response, err := readConverseStream(ctx, output.GetStream(), out)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, callError(ctx, opts.Client, "ストリーミング", err)
+			}
+			return nil, err
+		}
+		return response, nil
 	}
 
-	// Bedrockにリクエストを送信
-	output, err := bedrockClient.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
-		ModelId:     aws.String(opts.LLMModel),
-		Body:        payload,
-		ContentType: aws.String("application/json"),
+	var output *bedrockruntime.ConverseOutput
+	err = withRetry(ctx, opts.Client, func(ctx context.Context) error {
+		var err error
+		output, err = bedrockClient.Converse(ctx, input)
+		return err
 	})
 	if err != nil {
-		return fmt.Errorf("モデル呼び出しエラー: %v", err)
+		return nil, callError(ctx, opts.Client, "モデル呼び出し", err)
 	}
 
-	// レスポンスの解析
-	var response map[string]interface{}
-	if err := json.Unmarshal(output.Body, &response); err != nil {
-		return fmt.Errorf("レスポンスの解析エラー: %v", err)
+	response, err := parseConverseOutput(output)
+	if err != nil {
+		return nil, err
 	}
 
 	if opts.DebugMode {
-		fmt.Printf("レスポンス:\n%+v\n\n", response)
-	}
-
-	// モデルに応じてレスポンスを抽出
-	var answer string
-	switch opts.LLMModel {
-	case "anthropic.claude-3-5-sonnet-20240620-v1:0":
-		if content, ok := response["content"].([]interface{}); ok && len(content) > 0 {
-			if first, ok := content[0].(map[string]interface{}); ok {
-				if text, ok := first["text"].(string); ok {
-					answer = text
-				}
-			}
-		}
-	case "amazon.titan-text-express-v1":
-		if results, ok := response["results"].([]interface{}); ok && len(results) > 0 {
-			if first, ok := results[0].(map[string]interface{}); ok {
-				if text, ok := first["outputText"].(string); ok {
-					answer = text
-				}
+		fmt.Fprintf(errOut, "レスポンス（Converse）: 終了理由 %s, トークン数 %d/%d\n\n", response.StopReason, response.Usage.InputTokens, response.Usage.OutputTokens)
+	}
+
+	fmt.Fprint(out, response.Text)
+	return response, nil
+}
+
+// invokeModel は、モデルを1回呼び出して回答を出力先に書き出す関数です
+func invokeModel(ctx context.Context, opts AskOptions, bedrockClient BedrockRuntimeAPI, family ModelFamily, messages []Message) (*ModelResponse, error) {
+	out, errOut := opts.output(), opts.errOutput()
+
+	// 多くのモデルファミリーのJSONはテキストのみに対応している
+	if _, ok := family.(contentBlockModelFamily); !ok {
+		for _, message := range messages {
+			if message.HasNonText() {
+				return nil, fmt.Errorf("このモデルはInvokeModelでテキスト以外の入力を送信できません（--api %s を指定してください）", APIConverse)
 			}
 		}
 	}
 
-	if answer == "" {
-		return fmt.Errorf("レスポンスから回答を抽出できませんでした")
+	// ストリーミングに対応していないモデルファミリーは通常の呼び出しにフォールバック
+	streamingFamily, canStream := family.(StreamingModelFamily)
+	stream := canStream && !opts.NoStream
+
+	// モデルファミリーに応じてリクエストを構築
+	payload, err := family.BuildRequest(ModelRequest{
+		System:   opts.System,
+		Messages: messages,
+		Params:   opts.Params,
+		Stream:   stream,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("リクエストの構築エラー: %v", err)
 	}
 
-	fmt.Printf("\n%s\n\n", answer)
-	return nil
+	if opts.DebugMode {
+		fmt.Fprintf(errOut, "リクエスト:\n%s\n\n", string(payload))
+	}
+
+	if stream {
+		return processStreamPrompt(ctx, opts, bedrockClient, streamingFamily, payload)
+	}
+
+	// Bedrockにリクエストを送信（一時的なエラーの場合は再試行）
+	var output *bedrockruntime.InvokeModelOutput
+	err = withRetry(ctx, opts.Client, func(ctx context.Context) error {
+		var err error
+		output, err = bedrockClient.InvokeModel(ctx, &bedrockruntime.InvokeModelInput{
+			ModelId:     aws.String(opts.LLMModel),
+			Body:        payload,
+			ContentType: aws.String("application/json"),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, callError(ctx, opts.Client, "モデル呼び出し", err)
+	}
+
+	if opts.DebugMode {
+		fmt.Fprintf(errOut, "レスポンス:\n%s\n\n", string(output.Body))
+	}
+
+	// モデルファミリーに応じてレスポンスを抽出
+	response, err := family.ParseResponse(output.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprint(out, response.Text)
+	return response, nil
+}
+
+// processStreamPrompt は、レスポンスストリームで回答を受信しながら表示する関数です
+// 再試行はストリームの開始までで、回答の受信を始めた後のエラーは再試行しません
+func processStreamPrompt(ctx context.Context, opts AskOptions, bedrockClient BedrockRuntimeAPI, family StreamingModelFamily, payload []byte) (*ModelResponse, error) {
+	var output *bedrockruntime.InvokeModelWithResponseStreamOutput
+	err := withRetry(ctx, opts.Client, func(ctx context.Context) error {
+		var err error
+		output, err = bedrockClient.InvokeModelWithResponseStream(ctx, &bedrockruntime.InvokeModelWithResponseStreamInput{
+			ModelId:     aws.String(opts.LLMModel),
+			Body:        payload,
+			ContentType: aws.String("application/json"),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, callError(ctx, opts.Client, "モデル呼び出し", err)
+	}
+
+	response, err := readResponseStream(ctx, output.GetStream(), family, opts.output())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, callError(ctx, opts.Client, "ストリーミング", err)
+		}
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// answerDelimiters は、回答の前後に出力する文字列を返す関数です
+// 対話モードでは回答の前後に空行を入れ、単発の質問ではパイプで扱いやすいよう回答のみを出力します
+func answerDelimiters(opts AskOptions) (string, string) {
+	if opts.Prompt != "" {
+		return "", "\n"
+	}
+	return "\n", "\n\n"
 }
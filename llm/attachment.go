@@ -0,0 +1,217 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	bedrocktypes "github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+)
+
+// Bedrockで1回のリクエストに添付できるファイルの上限
+const (
+	maxImageBytes       = 3750000 // 画像1件あたりのサイズ（3.75MB）
+	maxDocumentBytes    = 4500000 // ドキュメント1件あたりのサイズ（4.5MB）
+	maxImageAttachments = 20      // 画像の件数
+	maxDocAttachments   = 5       // ドキュメントの件数
+)
+
+// 内容から判定したMIMEタイプごとの画像形式
+var imageFormats = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpeg",
+	"image/gif":  "gif",
+	"image/webp": "webp",
+}
+
+// ドキュメント名に使用できない文字（英数字、空白、ハイフン、括弧以外）
+var invalidDocumentNameChars = regexp.MustCompile(`[^A-Za-z0-9\s\-()\[\]]+`)
+
+// LoadAttachments は、添付ファイルを読み込み、画像またはドキュメントのコンテンツブロックに変換する関数です
+// 対応していない形式や、サイズ・件数の上限を超える場合はエラーを返します
+func LoadAttachments(paths []string) ([]ContentBlock, error) {
+	var blocks []ContentBlock
+	images, documents := 0, 0
+	names := map[string]bool{}
+
+	for _, path := range paths {
+		block, err := LoadAttachment(path)
+		if err != nil {
+			return nil, err
+		}
+
+		switch block.Type {
+		case BlockImage:
+			images++
+		case BlockDocument:
+			documents++
+			// ドキュメント名はリクエスト内で一意にする必要がある
+			name := block.Name
+			for i := 2; names[name]; i++ {
+				name = fmt.Sprintf("%s (%d)", block.Name, i)
+			}
+			names[name] = true
+			block.Name = name
+		}
+		blocks = append(blocks, block)
+	}
+
+	if images > maxImageAttachments {
+		return nil, fmt.Errorf("添付できる画像は %d 件までです（%d 件）", maxImageAttachments, images)
+	}
+	if documents > maxDocAttachments {
+		return nil, fmt.Errorf("添付できるドキュメントは %d 件までです（%d 件）", maxDocAttachments, documents)
+	}
+
+	return blocks, nil
+}
+
+// LoadAttachment は、1件の添付ファイルを読み込み、内容から形式を判定してコンテンツブロックに変換する関数です
+// 対応している形式は、PNG・JPEG・GIF・WebPの画像と、PDF・テキスト・Markdownのドキュメントです
+func LoadAttachment(path string) (ContentBlock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ContentBlock{}, fmt.Errorf("添付ファイルの読み込みに失敗しました: %v", err)
+	}
+	if len(data) == 0 {
+		return ContentBlock{}, fmt.Errorf("添付ファイルが空です: %s", path)
+	}
+
+	contentType := http.DetectContentType(data)
+	if format, ok := imageFormats[contentType]; ok {
+		if len(data) > maxImageBytes {
+			return ContentBlock{}, fmt.Errorf("画像のサイズが上限（%d バイト）を超えています: %s（%d バイト）", maxImageBytes, path, len(data))
+		}
+		return ImageBlock(format, data), nil
+	}
+
+	var format string
+	switch {
+	case contentType == "application/pdf":
+		format = "pdf"
+	case strings.HasPrefix(contentType, "text/plain"):
+		format = "txt"
+		if ext := strings.ToLower(filepath.Ext(path)); ext == ".md" || ext == ".markdown" {
+			format = "md"
+		}
+	default:
+		return ContentBlock{}, fmt.Errorf("対応していない形式のファイルです: %s（%s）。PNG・JPEG・GIF・WebP・PDF・テキスト・Markdownを添付できます", path, contentType)
+	}
+
+	if len(data) > maxDocumentBytes {
+		return ContentBlock{}, fmt.Errorf("ドキュメントのサイズが上限（%d バイト）を超えています: %s（%d バイト）", maxDocumentBytes, path, len(data))
+	}
+	return DocumentBlock(documentName(path), format, data), nil
+}
+
+// documentName は、ファイル名からBedrockのドキュメント名に使用できる名前を作成する関数です
+func documentName(path string) string {
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	name = invalidDocumentNameChars.ReplaceAllString(name, "-")
+	// 空白は連続して使用できない
+	name = strings.Join(strings.Fields(name), " ")
+	if strings.Trim(name, "-") == "" {
+		return "document"
+	}
+	return name
+}
+
+// hasImageBlock は、コンテンツブロックに画像が含まれるかを返す関数です
+func hasImageBlock(blocks []ContentBlock) bool {
+	for _, block := range blocks {
+		if block.Type == BlockImage {
+			return true
+		}
+	}
+	return false
+}
+
+// 画像の入力に対応しているかを、モデルIDのプレフィックスで判断するための対応表
+// モデル情報（GetFoundationModel）を取得できない場合にのみ使用します
+var imageInputModels = map[string]bool{
+	"anthropic.claude-3":         true,
+	"anthropic.claude-3-5-haiku": false,
+	"anthropic.claude-opus-4":    true,
+	"anthropic.claude-sonnet-4":  true,
+	"anthropic.claude-haiku-4":   true,
+	"anthropic.claude-v2":        false,
+	"anthropic.claude-instant":   false,
+	"amazon.nova-pro":            true,
+	"amazon.nova-lite":           true,
+	"amazon.nova-premier":        true,
+	"amazon.nova-micro":          false,
+	"amazon.titan-text":          false,
+	"meta.llama":                 false,
+	"meta.llama3-2-11b":          true,
+	"meta.llama3-2-90b":          true,
+	"meta.llama4":                true,
+	"mistral.":                   false,
+	"mistral.pixtral":            true,
+	"cohere.command":             false,
+	"ai21.":                      false,
+}
+
+// imageInputSupport は、モデルIDから画像の入力に対応しているかを返す関数です
+// 複数のプレフィックスに一致する場合は、最も長いプレフィックスを優先します
+// 対応表で判断できない場合は、known に false を返します
+func imageInputSupport(modelID string) (supported, known bool) {
+	var matched string
+	for prefix := range imageInputModels {
+		if strings.HasPrefix(modelID, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+	if matched == "" {
+		return false, false
+	}
+	return imageInputModels[matched], true
+}
+
+// checkImageInput は、モデルの入力モダリティが画像に対応しているかを確認する関数です
+// モデルの情報を取得できない場合は、モデルIDの対応表で判断し、
+// 対応表で判断できない場合は警告を表示して確認を省略します
+func checkImageInput(ctx context.Context, cfg aws.Config, opts AskOptions) error {
+	ctx, cancel := withTimeout(ctx, opts.Client)
+	defer cancel()
+
+	bedrockClient := newBedrockClient(cfg)
+
+	var output *bedrock.GetFoundationModelOutput
+	err := withRetry(ctx, opts.Client, func(ctx context.Context) error {
+		var err error
+		output, err = bedrockClient.GetFoundationModel(ctx, &bedrock.GetFoundationModelInput{
+			ModelIdentifier: aws.String(opts.baseModelID()),
+		})
+		return err
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return callError(ctx, opts.Client, "モデル情報の取得", err)
+		}
+		// 権限がないなどでモデル情報を取得できない場合は、モデルIDで判断する
+		supported, known := imageInputSupport(opts.baseModelID())
+		switch {
+		case !known:
+			fmt.Fprintf(opts.errOutput(), "警告: モデル情報を取得できないため、モデルが画像の入力に対応しているかを確認できません: %v\n", err)
+		case !supported:
+			return fmt.Errorf("モデル %s は画像の入力に対応していません", opts.LLMModel)
+		}
+		return nil
+	}
+	if output.ModelDetails == nil {
+		return nil
+	}
+
+	for _, modality := range output.ModelDetails.InputModalities {
+		if modality == bedrocktypes.ModelModalityImage {
+			return nil
+		}
+	}
+	return fmt.Errorf("モデル %s は画像の入力に対応していません（入力モダリティ: %v）", opts.LLMModel, output.ModelDetails.InputModalities)
+}
@@ -0,0 +1,227 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+)
+
+// 添付ファイルの形式の判定のテスト
+func TestLoadAttachment(t *testing.T) {
+	testCases := []struct {
+		name         string
+		file         string
+		data         []byte
+		expectType   string
+		expectFormat string
+		expectName   string
+		expectError  bool
+	}{
+		{name: "PNG", file: "screen.png", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), expectType: BlockImage, expectFormat: "png"},
+		{name: "JPEG", file: "photo.jpg", data: []byte("\xff\xd8\xff\xe0\x00\x10JFIF"), expectType: BlockImage, expectFormat: "jpeg"},
+		{name: "GIF", file: "anime.gif", data: []byte("GIF89a\x01\x00\x01\x00"), expectType: BlockImage, expectFormat: "gif"},
+		{name: "WebP", file: "image.webp", data: []byte("RIFF\x24\x00\x00\x00WEBPVP8 "), expectType: BlockImage, expectFormat: "webp"},
+		{name: "拡張子と内容が異なる画像", file: "image.txt", data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), expectType: BlockImage, expectFormat: "png"},
+		{name: "PDF", file: "spec v1.2.pdf", data: []byte("%PDF-1.7\n"), expectType: BlockDocument, expectFormat: "pdf", expectName: "spec v1-2"},
+		{name: "テキスト", file: "notes.txt", data: []byte("メモ\n"), expectType: BlockDocument, expectFormat: "txt", expectName: "notes"},
+		{name: "Markdown", file: "README.md", data: []byte("# タイトル\n"), expectType: BlockDocument, expectFormat: "md", expectName: "README"},
+		{name: "日本語のファイル名", file: "仕様書.md", data: []byte("# 仕様\n"), expectType: BlockDocument, expectFormat: "md", expectName: "document"},
+		{name: "対応していない形式", file: "archive.zip", data: []byte("PK\x03\x04\x14\x00\x00\x00"), expectError: true},
+		{name: "空のファイル", file: "empty.txt", data: []byte{}, expectError: true},
+		{name: "サイズの上限を超える画像", file: "large.png", data: append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, maxImageBytes)...), expectError: true},
+	}
+
+	dir := t.TempDir()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.file)
+			if err := os.WriteFile(path, tc.data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			block, err := LoadAttachment(path)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("エラーが期待されましたが、発生しませんでした: %+v", block.Type)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if block.Type != tc.expectType || block.Format != tc.expectFormat {
+				t.Errorf("形式が期待通りではありません。期待: %s/%s, 実際: %s/%s", tc.expectType, tc.expectFormat, block.Type, block.Format)
+			}
+			if block.Name != tc.expectName {
+				t.Errorf("ドキュメント名が期待通りではありません。期待: %q, 実際: %q", tc.expectName, block.Name)
+			}
+			if !bytes.Equal(block.Data, tc.data) {
+				t.Error("ファイルの内容が設定されていません")
+			}
+		})
+	}
+}
+
+// 複数の添付ファイルの読み込みのテスト
+func TestLoadAttachments(t *testing.T) {
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a/spec.md", "b/spec.md", "c/spec.md", "d/spec.md", "e/spec.md", "f/spec.md"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("# spec\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	// 同じ名前のドキュメントは一意な名前にすること
+	blocks, err := LoadAttachments(paths[:2])
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if blocks[0].Name != "spec" || blocks[1].Name != "spec (2)" {
+		t.Errorf("ドキュメント名が一意になっていません: %q, %q", blocks[0].Name, blocks[1].Name)
+	}
+
+	// ドキュメントの件数の上限
+	if _, err := LoadAttachments(paths); err == nil {
+		t.Error("ドキュメントの件数の上限を超えてもエラーが発生しませんでした")
+	}
+}
+
+// 画像を添付した質問のテスト
+func TestAskAttachments(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "error.png")
+	if err := os.WriteFile(path, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	attachments, err := LoadAttachments([]string{path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("画像に対応したモデル", func(t *testing.T) {
+		mockClient := useMockRuntimeClient(t)
+
+		var stdout, stderr bytes.Buffer
+		err := Ask(context.Background(), AskOptions{
+			LLMModel:    "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			Prompt:      "このエラーの原因は？",
+			NoStream:    true,
+			Attachments: attachments,
+			Output:      &stdout,
+			ErrOutput:   &stderr,
+		})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+
+		// InvokeModelで画像がBase64でエンコードされて送信されること
+		if len(mockClient.requests) != 1 {
+			t.Fatalf("InvokeModelの呼び出し回数が期待通りではありません: %d", len(mockClient.requests))
+		}
+		request := mockClient.requests[0]
+		for _, expect := range []string{`"type":"image"`, `"media_type":"image/png"`, `"type":"base64"`, "このエラーの原因は？"} {
+			if !strings.Contains(request, expect) {
+				t.Errorf("リクエストに %s が含まれていません: %s", expect, request)
+			}
+		}
+	})
+
+	t.Run("モデル情報を取得できない場合は警告する", func(t *testing.T) {
+		mockClient := useMockRuntimeClient(t)
+		newBedrockClient = func(cfg interface{}) BedrockClientAPI {
+			return &deniedBedrockClient{}
+		}
+
+		// 対応表で判断できないモデルは、確認を省略してモデルを呼び出す（モックのConverseはAnthropicのモデルのみに対応しているため、呼び出しはエラーになる）
+		var stdout, stderr bytes.Buffer
+		_ = Ask(context.Background(), AskOptions{
+			LLMModel:    "deepseek.r1-v1:0",
+			Prompt:      "このエラーの原因は？",
+			NoStream:    true,
+			Attachments: attachments,
+			Output:      &stdout,
+			ErrOutput:   &stderr,
+		})
+		if !strings.Contains(stderr.String(), "画像の入力に対応しているかを確認できません") {
+			t.Errorf("確認を省略した警告が表示されていません: %q", stderr.String())
+		}
+		if len(mockClient.converseRequests) == 0 {
+			t.Error("確認を省略した後にモデルが呼び出されていません")
+		}
+
+		// 対応表で画像に対応しているモデルは、モデル情報を取得できなくても警告しない
+		stderr.Reset()
+		err := Ask(context.Background(), AskOptions{
+			LLMModel:    "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			Prompt:      "このエラーの原因は？",
+			NoStream:    true,
+			Attachments: attachments,
+			Output:      &stdout,
+			ErrOutput:   &stderr,
+		})
+		if err != nil {
+			t.Fatalf("予期せぬエラー: %v", err)
+		}
+		if strings.Contains(stderr.String(), "確認できません") {
+			t.Errorf("画像に対応しているモデルで警告が表示されました: %q", stderr.String())
+		}
+
+		// 対応表で画像に対応していないモデルは、モデルを呼び出さずにエラーにする
+		for _, modelID := range []string{"anthropic.claude-v2:1", "us.anthropic.claude-instant-v1", "amazon.titan-text-express-v1"} {
+			calls := len(mockClient.converseRequests)
+			err := Ask(context.Background(), AskOptions{
+				LLMModel:    modelID,
+				Prompt:      "このエラーの原因は？",
+				NoStream:    true,
+				Attachments: attachments,
+				Output:      &stdout,
+				ErrOutput:   &stderr,
+			})
+			if err == nil || !strings.Contains(err.Error(), "画像の入力に対応していません") {
+				t.Errorf("%s: 画像に対応していないエラーが期待されましたが、%v が返されました", modelID, err)
+			}
+			if len(mockClient.converseRequests) != calls {
+				t.Errorf("%s: 画像に対応していないモデルが呼び出されました", modelID)
+			}
+		}
+	})
+
+	t.Run("画像に対応していないモデル", func(t *testing.T) {
+		mockClient := useMockRuntimeClient(t)
+
+		err := Ask(context.Background(), AskOptions{
+			LLMModel:    "amazon.titan-text-express-v1",
+			Prompt:      "このエラーの原因は？",
+			NoStream:    true,
+			Attachments: attachments,
+		})
+		if err == nil || !strings.Contains(err.Error(), "画像の入力に対応していません") {
+			t.Errorf("画像に対応していないモデルのエラーが期待されましたが、%v が返されました", err)
+		}
+		if len(mockClient.requests) != 0 || len(mockClient.converseRequests) != 0 {
+			t.Error("画像に対応していないモデルが呼び出されました")
+		}
+	})
+}
+
+// GetFoundationModelの権限がないモックのBedrockクライアント
+type deniedBedrockClient struct {
+	MockBedrockClient
+}
+
+func (m *deniedBedrockClient) GetFoundationModel(ctx context.Context, params *bedrock.GetFoundationModelInput, optFns ...func(*bedrock.Options)) (*bedrock.GetFoundationModelOutput, error) {
+	return nil, &types.AccessDeniedException{Message: aws.String("not authorized to perform: bedrock:GetFoundationModel")}
+}
@@ -0,0 +1,379 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// トークン数の制限を超える場合の、ファイルの選び方
+const (
+	BudgetSkip     = "skip"     // 収まらないファイルを省略し、後のファイルも続けて確認する（デフォルト）
+	BudgetStop     = "stop"     // 収まらないファイルがあった時点で終了する
+	BudgetTruncate = "truncate" // すべてのファイルを、トークン数に比例して切り詰める
+)
+
+// ファイルを含める優先順位
+const (
+	OrderPath   = "path"   // パスの順（デフォルト）
+	OrderRecent = "recent" // 更新日時が新しい順
+	OrderSize   = "size"   // トークン数が少ない順
+)
+
+// 切り詰める場合に、最低限含めるトークン数（これより少なくなる場合は省略する）
+const minTruncatedTokens = 32
+
+// pathWeight は、--weight で指定するパスの重みを定義する構造体です
+type pathWeight struct {
+	glob   globPattern
+	weight int
+}
+
+// flattenFile は、flatten-srcで出力するファイルを定義する構造体です
+type flattenFile struct {
+	path    string // 読み込むファイルのパス
+	relPath string // ベースディレクトリからの相対パス
+	content string
+	tokens  int
+	modTime time.Time
+	weight  int
+	loaded  bool // 内容を読み込み、トークン数を数えたか
+}
+
+// flattenOmission は、トークン数の制限により省略した、または切り詰めたファイルを定義する構造体です
+type flattenOmission struct {
+	relPath  string
+	tokens   int // ファイル全体のトークン数（読み込まずに省略した場合は0）
+	included int // 出力に含めたトークン数（省略した場合は0）
+}
+
+// ValidateFlattenBudget は、トークン数の制限を超える場合の選び方と優先順位の指定を検証する関数です
+func ValidateFlattenBudget(budget, order string, weights []string) error {
+	switch budget {
+	case "", BudgetSkip, BudgetStop, BudgetTruncate:
+	default:
+		return fmt.Errorf("不正なトークン数の制限の扱いです: %s（skip、stop、truncate のいずれかを指定してください）", budget)
+	}
+	switch order {
+	case "", OrderPath, OrderRecent, OrderSize:
+	default:
+		return fmt.Errorf("不正な優先順位です: %s（path、recent、size のいずれかを指定してください）", order)
+	}
+	_, err := parsePathWeights(weights)
+	return err
+}
+
+// parsePathWeights は、glob=重み の形式のパスの重みを解析する関数です
+func parsePathWeights(weights []string) ([]pathWeight, error) {
+	var parsed []pathWeight
+	for _, weight := range weights {
+		pattern, value, ok := strings.Cut(weight, "=")
+		if !ok {
+			return nil, fmt.Errorf("パスの重みは glob=重み の形式で指定してください: %s", weight)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("パスの重みには整数を指定してください: %s", weight)
+		}
+		glob, err := compileGlob(strings.TrimSpace(pattern))
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, pathWeight{glob: glob, weight: n})
+	}
+	return parsed, nil
+}
+
+// newFlattenFiles は、ファイルの一覧から、更新日時と重みを求めたflattenFileを作成する関数です
+// ファイルの内容は読み込まず、トークン数が必要になった時点でloadFlattenFileで読み込みます
+func newFlattenFiles(baseDir string, paths []string, weights []pathWeight) []flattenFile {
+	var files []flattenFile
+	for _, path := range paths {
+		relPath, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			continue
+		}
+
+		file := flattenFile{path: path, relPath: relPath}
+		if info, err := os.Stat(path); err == nil {
+			file.modTime = info.ModTime()
+		}
+
+		// 最初に一致したパターンの重みを使用する
+		slashPath := filepath.ToSlash(relPath)
+		for _, weight := range weights {
+			if weight.glob.match(slashPath) {
+				file.weight = weight.weight
+				break
+			}
+		}
+		files = append(files, file)
+	}
+	return files
+}
+
+// loadFlattenFile は、ファイルを読み込んでトークン数を数える関数です
+// 読み込めないファイルとUTF-8でないファイルは false を返します（スキップします）
+func loadFlattenFile(file *flattenFile, tokenizer Tokenizer, debug bool) bool {
+	if file.loaded {
+		return true
+	}
+
+	// ファイルの読み込み
+	content, err := os.ReadFile(file.path)
+	if err != nil {
+		if debug {
+			fmt.Fprintf(os.Stderr, "警告: ファイル '%s' の読み込みエラー: %v\n", file.relPath, err)
+		}
+		return false
+	}
+
+	// UTF-8でない場合はスキップ
+	if !utf8.Valid(content) {
+		if debug {
+			fmt.Fprintf(os.Stderr, "警告: ファイル '%s' はUTF-8でないためスキップします\n", file.relPath)
+		}
+		return false
+	}
+
+	file.content = string(content)
+	file.tokens = tokenizer.CountTokens(file.content)
+	file.loaded = true
+	return true
+}
+
+// loadAllFlattenFiles は、すべてのファイルを読み込み、読み込めたファイルのみを返す関数です
+// トークン数の少ない順に並べる場合と、トークン数に比例して切り詰める場合に使用します
+func loadAllFlattenFiles(files []flattenFile, load func(*flattenFile) bool) []flattenFile {
+	var loaded []flattenFile
+	for _, file := range files {
+		if load(&file) {
+			loaded = append(loaded, file)
+		}
+	}
+	return loaded
+}
+
+// orderFlattenFiles は、重みが大きい順に、同じ重みの中では優先順位の順にファイルを並べ替える関数です
+func orderFlattenFiles(files []flattenFile, order string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.weight != b.weight {
+			return a.weight > b.weight
+		}
+		switch order {
+		case OrderRecent:
+			if !a.modTime.Equal(b.modTime) {
+				return a.modTime.After(b.modTime)
+			}
+		case OrderSize:
+			if a.tokens != b.tokens {
+				return a.tokens < b.tokens
+			}
+		}
+		return a.relPath < b.relPath
+	})
+}
+
+// budgetFlattenFiles は、トークン数の制限に収まるように出力するファイルを選ぶ関数です
+// ファイルは優先順位の順にloadで読み込み、制限に達した後のファイルは読み込まずに省略します
+// 出力するファイル（切り詰めたものを含む）と、省略または切り詰めたファイルを返します
+func budgetFlattenFiles(files []flattenFile, budget string, maxTokens int, tokenizer Tokenizer, load func(*flattenFile) bool) ([]flattenFile, []flattenOmission) {
+	var included []flattenFile
+	var omissions []flattenOmission
+	used := 0
+
+	switch budget {
+	case BudgetTruncate:
+		// 割り当てに全体のトークン数が必要なため、すべて読み込む
+		files = loadAllFlattenFiles(files, load)
+		allotments := allotTruncatedTokens(files, maxTokens)
+		parts := make([]flattenFile, len(files))
+		ok := make([]bool, len(files))
+		for i, file := range files {
+			parts[i], ok[i] = truncateFlattenFile(file, allotments[i], tokenizer)
+			if ok[i] {
+				used += parts[i].tokens
+			}
+		}
+
+		// 割り当ての端数や行単位の切り詰めで余ったトークン数を、優先順位の順に配分する
+		for i, file := range files {
+			rest := maxTokens - used
+			if rest <= 0 {
+				break
+			}
+			if ok[i] && parts[i].tokens >= file.tokens {
+				continue
+			}
+			current := 0
+			if ok[i] {
+				current = parts[i].tokens
+			} else if used > 0 && rest < file.tokens && rest < minTruncatedTokens {
+				// 省略したファイルは、全体が収まる場合か最低限のトークン数を含められる場合のみ含める
+				continue
+			}
+			if extended, extendedOK := truncateFlattenFile(file, current+rest, tokenizer); extendedOK && extended.tokens > current {
+				parts[i], ok[i] = extended, true
+				used += extended.tokens - current
+			}
+		}
+
+		for i, file := range files {
+			if !ok[i] {
+				omissions = append(omissions, flattenOmission{relPath: file.relPath, tokens: file.tokens})
+				continue
+			}
+			included = append(included, parts[i])
+			if parts[i].tokens < file.tokens {
+				omissions = append(omissions, flattenOmission{relPath: file.relPath, tokens: file.tokens, included: parts[i].tokens})
+			}
+		}
+		return included, omissions
+
+	case BudgetStop:
+		for i, file := range files {
+			if !load(&file) {
+				continue
+			}
+			if used+file.tokens <= maxTokens {
+				included = append(included, file)
+				used += file.tokens
+				continue
+			}
+			// 最初のファイルが大きすぎる場合でも、一部だけでも含める
+			omission := flattenOmission{relPath: file.relPath, tokens: file.tokens}
+			if len(included) == 0 {
+				truncated := file
+				truncated.content, truncated.tokens = truncateContent(file.content, maxTokens, tokenizer)
+				included = append(included, truncated)
+				omission.included = truncated.tokens
+			}
+			omissions = append(omissions, omission)
+			// 残りのファイルは読み込まずに省略する
+			for _, rest := range files[i+1:] {
+				omissions = append(omissions, flattenOmission{relPath: rest.relPath, tokens: rest.tokens})
+			}
+			return included, omissions
+		}
+		return included, omissions
+	}
+
+	// 収まらないファイルは省略し、後のより小さいファイルを含める
+	var first flattenFile // 最も優先する、読み込めたファイル
+	firstOmission := -1   // firstのomissionsでの位置
+	for _, file := range files {
+		if used >= maxTokens {
+			// 制限に達した後のファイルは読み込まずに省略する
+			omissions = append(omissions, flattenOmission{relPath: file.relPath, tokens: file.tokens})
+			continue
+		}
+		if !load(&file) {
+			continue
+		}
+		if used+file.tokens <= maxTokens {
+			included = append(included, file)
+			used += file.tokens
+			continue
+		}
+		if firstOmission < 0 {
+			first, firstOmission = file, len(omissions)
+		}
+		omissions = append(omissions, flattenOmission{relPath: file.relPath, tokens: file.tokens})
+	}
+
+	// どのファイルも収まらない場合は、最も優先するファイルの一部を含める
+	if len(included) == 0 && firstOmission >= 0 {
+		truncated := first
+		truncated.content, truncated.tokens = truncateContent(first.content, maxTokens, tokenizer)
+		included = append(included, truncated)
+		omissions[firstOmission].included = truncated.tokens
+	}
+	return included, omissions
+}
+
+// allotTruncatedTokens は、ファイルのトークン数に比例して、各ファイルに割り当てるトークン数を求める関数です
+// 割り当てが最低限のトークン数に満たないファイルは省略し（割り当ては0）、その分を残りのファイルに割り当て直します
+func allotTruncatedTokens(files []flattenFile, maxTokens int) []int {
+	allotments := make([]int, len(files))
+	active := make([]bool, len(files))
+	for i := range files {
+		active[i] = true
+	}
+
+	for {
+		total := 0
+		for i, file := range files {
+			if active[i] {
+				total += file.tokens
+			}
+		}
+		if total <= maxTokens {
+			// 残りのファイルがすべて収まる
+			for i, file := range files {
+				if active[i] {
+					allotments[i] = file.tokens
+				}
+			}
+			return allotments
+		}
+
+		dropped := false
+		for i, file := range files {
+			if !active[i] {
+				continue
+			}
+			allotments[i] = int(int64(file.tokens) * int64(maxTokens) / int64(total))
+			if allotments[i] < minTruncatedTokens {
+				allotments[i] = 0
+				active[i] = false
+				dropped = true
+			}
+		}
+		if !dropped {
+			return allotments
+		}
+	}
+}
+
+// truncateFlattenFile は、ファイルを割り当てたトークン数に収まるよう行単位で切り詰める関数です
+// 何も含められない場合（割り当てがない場合や、最初の行が割り当てより長い場合）は false を返します
+func truncateFlattenFile(file flattenFile, allotted int, tokenizer Tokenizer) (flattenFile, bool) {
+	if allotted >= file.tokens {
+		return file, true
+	}
+	if allotted <= 0 {
+		return flattenFile{}, false
+	}
+	truncated := file
+	truncated.content, truncated.tokens = truncateContent(file.content, allotted, tokenizer)
+	return truncated, truncated.tokens > 0
+}
+
+// writeFlattenManifest は、省略または切り詰めたファイルの一覧を出力の末尾に書き込む関数です
+// LLMが含まれていないファイルを把握できるように、出力の一部として書き込みます
+func writeFlattenManifest(result *strings.Builder, omissions []flattenOmission, maxTokens int, tokenizer Tokenizer) {
+	if len(omissions) == 0 {
+		return
+	}
+
+	fmt.Fprintf(result, "### 省略・切り詰めたファイル\n")
+	fmt.Fprintf(result, "トークン数の制限（%d、%s）により、次のファイルは含まれていないか、一部のみ含まれています。\n\n", maxTokens, tokenizer.Name())
+	for _, omission := range omissions {
+		switch {
+		case omission.included > 0:
+			fmt.Fprintf(result, "- %s: 切り詰め（%d / %d トークン）\n", filepath.ToSlash(omission.relPath), omission.included, omission.tokens)
+		case omission.tokens > 0:
+			fmt.Fprintf(result, "- %s: 省略（%d トークン）\n", filepath.ToSlash(omission.relPath), omission.tokens)
+		default:
+			// 制限に達した後に読み込まずに省略したファイル
+			fmt.Fprintf(result, "- %s: 省略\n", filepath.ToSlash(omission.relPath))
+		}
+	}
+	result.WriteString("\n")
+}
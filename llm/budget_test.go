@@ -0,0 +1,317 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixedTokenizer は、行数をトークン数として数えるテスト用のトークナイザーです
+type fixedTokenizer struct{}
+
+func (fixedTokenizer) Name() string { return "lines" }
+
+func (fixedTokenizer) CountTokens(text string) int {
+	return strings.Count(text, "\n")
+}
+
+// budgetTestFile は、指定した行数の内容を持つテスト用のファイルを返す関数です
+func budgetTestFile(relPath string, lines int) flattenFile {
+	return flattenFile{relPath: relPath, content: strings.Repeat("x\n", lines), tokens: lines, loaded: true}
+}
+
+// loadBudgetTestFile は、読み込んだファイルを記録するテスト用の読み込み関数を返す関数です
+func loadBudgetTestFile(loaded map[string]bool) func(*flattenFile) bool {
+	return func(file *flattenFile) bool {
+		loaded[file.relPath] = true
+		return true
+	}
+}
+
+// トークン数の制限に収まるファイルの選択のテスト
+func TestBudgetFlattenFiles(t *testing.T) {
+	files := []flattenFile{
+		budgetTestFile("a.go", 60),
+		budgetTestFile("b.go", 50),
+		budgetTestFile("c.go", 30),
+		budgetTestFile("d.go", 10),
+	}
+
+	testCases := []struct {
+		name           string
+		files          []flattenFile
+		budget         string
+		maxTokens      int
+		expectIncluded []string // パス:トークン数
+		expectOmitted  []string // パス:含めたトークン数/全体のトークン数
+	}{
+		{
+			name:           "すべて収まる",
+			files:          files,
+			budget:         BudgetSkip,
+			maxTokens:      200,
+			expectIncluded: []string{"a.go:60", "b.go:50", "c.go:30", "d.go:10"},
+		},
+		{
+			name:           "収まらないファイルを省略して続ける",
+			files:          files,
+			budget:         BudgetSkip,
+			maxTokens:      100,
+			expectIncluded: []string{"a.go:60", "c.go:30", "d.go:10"},
+			expectOmitted:  []string{"b.go:0/50"},
+		},
+		{
+			name:           "収まらないファイルで終了する",
+			files:          files,
+			budget:         BudgetStop,
+			maxTokens:      100,
+			expectIncluded: []string{"a.go:60"},
+			expectOmitted:  []string{"b.go:0/50", "c.go:0/30", "d.go:0/10"},
+		},
+		{
+			name:           "最初のファイルが大きすぎる場合は先頭を含める",
+			files:          files,
+			budget:         BudgetStop,
+			maxTokens:      40,
+			expectIncluded: []string{"a.go:40"},
+			expectOmitted:  []string{"a.go:40/60", "b.go:0/50", "c.go:0/30", "d.go:0/10"},
+		},
+		{
+			name:           "どのファイルも収まらない場合は最も優先するファイルの先頭を含める",
+			files:          files[:2],
+			budget:         BudgetSkip,
+			maxTokens:      40,
+			expectIncluded: []string{"a.go:40"},
+			expectOmitted:  []string{"a.go:40/60", "b.go:0/50"},
+		},
+		{
+			name:           "トークン数に比例して切り詰める",
+			files:          files[:2],
+			budget:         BudgetTruncate,
+			maxTokens:      80,
+			expectIncluded: []string{"a.go:44", "b.go:36"},
+			expectOmitted:  []string{"a.go:44/60", "b.go:36/50"},
+		},
+		{
+			name:           "割り当てが少ないファイルの分を他のファイルに割り当てる",
+			files:          files,
+			budget:         BudgetTruncate,
+			maxTokens:      120,
+			expectIncluded: []string{"a.go:60", "b.go:50", "d.go:10"},
+			expectOmitted:  []string{"c.go:0/30"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			included, omissions := budgetFlattenFiles(tc.files, tc.budget, tc.maxTokens, fixedTokenizer{}, loadBudgetTestFile(map[string]bool{}))
+
+			var actualIncluded []string
+			total := 0
+			for _, file := range included {
+				actualIncluded = append(actualIncluded, file.relPath+":"+strconv.Itoa(file.tokens))
+				total += file.tokens
+			}
+			if strings.Join(actualIncluded, " ") != strings.Join(tc.expectIncluded, " ") {
+				t.Errorf("含めたファイルが期待通りではありません。\n期待: %v\n実際: %v", tc.expectIncluded, actualIncluded)
+			}
+			if total > tc.maxTokens {
+				t.Errorf("トークン数の合計が制限を超えています: %d > %d", total, tc.maxTokens)
+			}
+
+			var actualOmitted []string
+			for _, omission := range omissions {
+				actualOmitted = append(actualOmitted, omission.relPath+":"+strconv.Itoa(omission.included)+"/"+strconv.Itoa(omission.tokens))
+			}
+			if strings.Join(actualOmitted, " ") != strings.Join(tc.expectOmitted, " ") {
+				t.Errorf("省略したファイルが期待通りではありません。\n期待: %v\n実際: %v", tc.expectOmitted, actualOmitted)
+			}
+		})
+	}
+}
+
+// 切り詰める場合に、含めるトークン数の合計が制限に近くなることのテスト
+func TestBudgetFlattenFilesTruncateFill(t *testing.T) {
+	var files []flattenFile
+	for i := 0; i < 20; i++ {
+		files = append(files, budgetTestFile("file"+strconv.Itoa(i)+".go", 5+(i*37)%200))
+	}
+
+	for _, maxTokens := range []int{100, 333, 500, 1000, 1777} {
+		t.Run(strconv.Itoa(maxTokens), func(t *testing.T) {
+			included, _ := budgetFlattenFiles(files, BudgetTruncate, maxTokens, fixedTokenizer{}, loadBudgetTestFile(map[string]bool{}))
+			total := 0
+			for _, file := range included {
+				total += file.tokens
+			}
+			// 行数をトークン数として数えるため、余ったトークン数はすべて配分できる
+			if total != maxTokens {
+				t.Errorf("含めたトークン数の合計が制限と一致しません: %d（制限: %d）", total, maxTokens)
+			}
+		})
+	}
+}
+
+// 制限に達した後のファイルを読み込まないことのテスト
+func TestBudgetFlattenFilesLazy(t *testing.T) {
+	testCases := []struct {
+		name         string
+		budget       string
+		expectLoaded []string
+	}{
+		{name: "収まらないファイルで終了する", budget: BudgetStop, expectLoaded: []string{"a.go", "b.go"}},
+		{name: "制限に達した後は省略する", budget: BudgetSkip, expectLoaded: []string{"a.go", "b.go", "c.go"}},
+		{name: "切り詰める場合はすべて読み込む", budget: BudgetTruncate, expectLoaded: []string{"a.go", "b.go", "c.go", "d.go"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := []flattenFile{
+				budgetTestFile("a.go", 60),
+				budgetTestFile("b.go", 50),
+				budgetTestFile("c.go", 40),
+				budgetTestFile("d.go", 10),
+			}
+			loaded := map[string]bool{}
+			budgetFlattenFiles(files, tc.budget, 100, fixedTokenizer{}, loadBudgetTestFile(loaded))
+
+			var actual []string
+			for _, file := range files {
+				if loaded[file.relPath] {
+					actual = append(actual, file.relPath)
+				}
+			}
+			if strings.Join(actual, " ") != strings.Join(tc.expectLoaded, " ") {
+				t.Errorf("読み込んだファイルが期待通りではありません。\n期待: %v\n実際: %v", tc.expectLoaded, actual)
+			}
+		})
+	}
+}
+
+// ファイルの優先順位のテスト
+func TestOrderFlattenFiles(t *testing.T) {
+	now := time.Now()
+	newFiles := func() []flattenFile {
+		return []flattenFile{
+			{relPath: "README.md", tokens: 30, modTime: now.Add(-3 * time.Hour)},
+			{relPath: "cmd/main.go", tokens: 50, modTime: now.Add(-2 * time.Hour)},
+			{relPath: "llm/ask.go", tokens: 10, modTime: now},
+			{relPath: "llm/ask_test.go", tokens: 20, modTime: now.Add(-1 * time.Hour)},
+		}
+	}
+
+	weights, err := parsePathWeights([]string{"cmd/**=10", "*_test.go = -1"})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	testCases := []struct {
+		name       string
+		order      string
+		useWeights bool
+		expect     []string
+	}{
+		{name: "パスの順", order: OrderPath, expect: []string{"README.md", "cmd/main.go", "llm/ask.go", "llm/ask_test.go"}},
+		{name: "更新日時が新しい順", order: OrderRecent, expect: []string{"llm/ask.go", "llm/ask_test.go", "cmd/main.go", "README.md"}},
+		{name: "トークン数が少ない順", order: OrderSize, expect: []string{"llm/ask.go", "llm/ask_test.go", "README.md", "cmd/main.go"}},
+		{name: "重みを優先する", order: OrderSize, useWeights: true, expect: []string{"cmd/main.go", "llm/ask.go", "README.md", "llm/ask_test.go"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files := newFiles()
+			if tc.useWeights {
+				for i := range files {
+					for _, weight := range weights {
+						if weight.glob.match(files[i].relPath) {
+							files[i].weight = weight.weight
+							break
+						}
+					}
+				}
+			}
+			orderFlattenFiles(files, tc.order)
+
+			var actual []string
+			for _, file := range files {
+				actual = append(actual, file.relPath)
+			}
+			if strings.Join(actual, " ") != strings.Join(tc.expect, " ") {
+				t.Errorf("並び順が期待通りではありません。\n期待: %v\n実際: %v", tc.expect, actual)
+			}
+		})
+	}
+}
+
+// トークン数の制限の扱いの指定の検証のテスト
+func TestValidateFlattenBudget(t *testing.T) {
+	testCases := []struct {
+		name        string
+		budget      string
+		order       string
+		weights     []string
+		expectError bool
+	}{
+		{name: "指定なし"},
+		{name: "すべて指定", budget: BudgetTruncate, order: OrderRecent, weights: []string{"cmd/**=10", "*.md=-5"}},
+		{name: "不正な扱い", budget: "drop", expectError: true},
+		{name: "不正な優先順位", order: "name", expectError: true},
+		{name: "=のない重み", weights: []string{"cmd/**"}, expectError: true},
+		{name: "整数でない重み", weights: []string{"cmd/**=high"}, expectError: true},
+		{name: "不正なglob", weights: []string{"src/[a-=1"}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateFlattenBudget(tc.budget, tc.order, tc.weights)
+			if (err != nil) != tc.expectError {
+				t.Errorf("エラーの有無が期待通りではありません: %v", err)
+			}
+		})
+	}
+}
+
+// 省略したファイルの一覧を含むflatten-srcの出力のテスト
+func TestFlattenSrcManifest(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"a.go": "package a\n" + strings.Repeat("// a\n", 200),
+		"b.go": "package b\n",
+		"c.go": "package c\n",
+	})
+	// 更新日時が新しい順では b.go、c.go、a.go の順になる
+	for i, name := range []string{"a.go", "c.go", "b.go"} {
+		modTime := time.Now().Add(time.Duration(i-3) * time.Hour)
+		if err := os.Chtimes(filepath.Join(dir, name), modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var buf strings.Builder
+	err := FlattenSrc(FlattenOptions{
+		Extension:      "*.go",
+		BasePath:       dir,
+		NoIgnore:       true,
+		MaxInputTokens: 100,
+		Tokenizer:      TokenizerHeuristic,
+		Order:          OrderRecent,
+		Output:         &buf,
+	})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	output := buf.String()
+
+	if strings.Index(output, "### b.go") > strings.Index(output, "### c.go") {
+		t.Errorf("更新日時が新しい順に出力されていません:\n%s", output)
+	}
+	if strings.Contains(output, "### a.go\n") {
+		t.Errorf("収まらないファイルが含まれています:\n%s", output)
+	}
+	if !strings.Contains(output, "### 省略・切り詰めたファイル") || !strings.Contains(output, "- a.go: 省略（") {
+		t.Errorf("省略したファイルの一覧が出力されていません:\n%s", output)
+	}
+}
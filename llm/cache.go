@@ -0,0 +1,231 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// DefaultModelCacheTTL は、モデル一覧のキャッシュのデフォルトの有効期限です
+const DefaultModelCacheTTL = 24 * time.Hour
+
+// 「もしかして」として表示する候補の数
+const maxModelSuggestions = 3
+
+// キャッシュファイル名に使用できない文字
+var unsafeCacheNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// CacheDir は、hiracliが再取得できるデータを保存するディレクトリを返す関数です
+func CacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("キャッシュディレクトリの取得エラー: %v", err)
+	}
+	return filepath.Join(cacheDir, "hiracli"), nil
+}
+
+// ModelCache は、リージョンごとのモデル一覧をJSONファイルとして保存するキャッシュです
+type ModelCache struct {
+	Path string // キャッシュファイルのパス
+}
+
+// modelCacheFile は、キャッシュファイルの内容を定義する構造体です
+type modelCacheFile struct {
+	FetchedAt time.Time   `json:"fetched_at"`
+	Region    string      `json:"region"`
+	Models    []ModelInfo `json:"models"`
+}
+
+// DefaultModelCache は、リージョンのモデル一覧のキャッシュを返す関数です
+// モデルの提供状況はリージョンごとに異なるため、リージョンごとに別のファイルに保存します
+func DefaultModelCache(region string) (*ModelCache, error) {
+	cacheDir, err := CacheDir()
+	if err != nil {
+		return nil, err
+	}
+	if region == "" {
+		region = "default"
+	}
+	name := "models-" + unsafeCacheNameChars.ReplaceAllString(region, "_") + ".json"
+	return &ModelCache{Path: filepath.Join(cacheDir, name)}, nil
+}
+
+// Load は、キャッシュされたモデル一覧と取得日時を返します
+// キャッシュがない場合はnilを返します
+func (c *ModelCache) Load() ([]ModelInfo, time.Time, error) {
+	data, err := os.ReadFile(c.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, time.Time{}, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("モデル一覧のキャッシュの読み込みエラー: %v", err)
+	}
+
+	var file modelCacheFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, time.Time{}, fmt.Errorf("モデル一覧のキャッシュの解析エラー（%s）: %v", c.Path, err)
+	}
+
+	// 対応状況はhiracliのバージョンによって変わるため、読み込むたびに判定し直す
+	for i := range file.Models {
+		file.Models[i].Support, file.Models[i].Family = modelSupport(file.Models[i])
+		file.Models[i].Access = ""
+	}
+	return file.Models, file.FetchedAt, nil
+}
+
+// LoadFresh は、有効期限内のキャッシュされたモデル一覧を返します
+// キャッシュがない場合や期限切れの場合はnilを返します
+func (c *ModelCache) LoadFresh(ttl time.Duration, now time.Time) ([]ModelInfo, error) {
+	if ttl <= 0 {
+		return nil, nil
+	}
+	models, fetchedAt, err := c.Load()
+	if err != nil || models == nil || now.Sub(fetchedAt) > ttl {
+		return nil, err
+	}
+	return models, nil
+}
+
+// Save は、モデル一覧をキャッシュに保存します
+func (c *ModelCache) Save(region string, models []ModelInfo, now time.Time) error {
+	file := modelCacheFile{FetchedAt: now, Region: region, Models: make([]ModelInfo, len(models))}
+	copy(file.Models, models)
+	for i := range file.Models {
+		file.Models[i].Access = ""
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("モデル一覧のキャッシュの変換エラー: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0755); err != nil {
+		return fmt.Errorf("キャッシュディレクトリの作成エラー: %v", err)
+	}
+
+	// 書き込み途中のファイルを読み込まないよう、一時ファイルに書き込んでから置き換える
+	tmp := c.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("モデル一覧のキャッシュの書き込みエラー: %v", err)
+	}
+	if err := os.Rename(tmp, c.Path); err != nil {
+		return fmt.Errorf("モデル一覧のキャッシュの書き込みエラー: %v", err)
+	}
+	return nil
+}
+
+// CachedModels は、APIを呼び出さずに、有効期限内のキャッシュされたモデル一覧を返す関数です
+// キャッシュがない場合や期限切れの場合はnilを返します
+func CachedModels(ctx context.Context, clientOpts ClientOptions, ttl time.Duration) ([]ModelInfo, error) {
+	// リージョンの解決のみに使用し、認証情報の取得やAPIの呼び出しは行わない
+	cfg, err := loadAWSConfig(ctx, clientOpts)
+	if err != nil {
+		return nil, err
+	}
+	cache, err := DefaultModelCache(cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+	return cache.LoadFresh(ttl, time.Now())
+}
+
+// ValidateModelID は、解決したモデルIDがモデル一覧に含まれるかを検証する関数です
+// 含まれない場合は、指定された名前に近いモデルIDとエイリアスを候補として示すエラーを返します
+// モデル一覧が空の場合や、ARNが指定された場合は検証しません
+func ValidateModelID(name, modelID string, models []ModelInfo, aliases []ModelAlias) error {
+	if len(models) == 0 || arn.IsARN(modelID) {
+		return nil
+	}
+	base := BaseModelID(modelID)
+	for _, model := range models {
+		if model.ID == modelID || model.ID == base {
+			return nil
+		}
+	}
+
+	candidates := make([]string, 0, len(models)+len(aliases))
+	for _, alias := range aliases {
+		candidates = append(candidates, alias.Name)
+	}
+	for _, model := range models {
+		if model.Support != SupportUnsupported {
+			candidates = append(candidates, model.ID)
+		}
+	}
+
+	if suggestions := suggestNames(name, candidates); len(suggestions) > 0 {
+		return fmt.Errorf("不明なモデルです: %s（もしかして: %s?）", name, strings.Join(suggestions, ", "))
+	}
+	return fmt.Errorf("不明なモデルです: %s（hiracli llm list で利用可能なモデルを確認できます）", name)
+}
+
+// suggestNames は、候補の中から名前に近いものを近い順に返す関数です
+// 編集距離が名前の長さに応じたしきい値以下のものと、名前を部分文字列として含むものを候補とします
+func suggestNames(name string, candidates []string) []string {
+	type scored struct {
+		name     string
+		distance int
+	}
+
+	lowerName := strings.ToLower(name)
+	threshold := max(2, len([]rune(name))/4)
+	var matches []scored
+	seen := map[string]bool{}
+	for _, candidate := range candidates {
+		if seen[candidate] || candidate == name {
+			continue
+		}
+		seen[candidate] = true
+
+		lower := strings.ToLower(candidate)
+		distance := levenshtein(lowerName, lower)
+		if distance > threshold && !strings.Contains(lower, lowerName) {
+			continue
+		}
+		matches = append(matches, scored{name: candidate, distance: distance})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].name < matches[j].name
+	})
+
+	var suggestions []string
+	for i := 0; i < len(matches) && i < maxModelSuggestions; i++ {
+		suggestions = append(suggestions, matches[i].name)
+	}
+	return suggestions
+}
+
+// levenshtein は、2つの文字列の編集距離を返す関数です
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,193 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+)
+
+// countingBedrockClient は、ListFoundationModelsの呼び出し回数と最後のリクエストを記録するモッククライアントです
+type countingBedrockClient struct {
+	MockBedrockClient
+	calls  int
+	params *bedrock.ListFoundationModelsInput
+}
+
+func (c *countingBedrockClient) ListFoundationModels(ctx context.Context, params *bedrock.ListFoundationModelsInput, optFns ...func(*bedrock.Options)) (*bedrock.ListFoundationModelsOutput, error) {
+	c.calls++
+	c.params = params
+	return c.MockBedrockClient.ListFoundationModels(ctx, params, optFns...)
+}
+
+// モデル一覧のキャッシュの保存と有効期限のテスト
+func TestModelCache(t *testing.T) {
+	cache := &ModelCache{Path: filepath.Join(t.TempDir(), "cache", "models-us-east-1.json")}
+	now := time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	// キャッシュがない場合はnil
+	if models, _, err := cache.Load(); err != nil || models != nil {
+		t.Fatalf("キャッシュがない場合にnilが期待されました: %v, %v", models, err)
+	}
+
+	models := []ModelInfo{
+		{ID: "anthropic.claude-3-haiku-20240307-v1:0", OutputModalities: []string{"TEXT"}, Access: AccessGranted},
+		{ID: "amazon.nova-canvas-v1:0", OutputModalities: []string{"IMAGE"}},
+	}
+	if err := cache.Save("us-east-1", models, now); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	loaded, fetchedAt, err := cache.Load()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(loaded) != 2 || !fetchedAt.Equal(now) {
+		t.Fatalf("キャッシュの内容が期待通りではありません: %+v, %s", loaded, fetchedAt)
+	}
+	// 対応状況は読み込み時に判定し、アカウントごとのモデルアクセスの状態は保存しない
+	if loaded[0].Support != SupportInvoke || loaded[0].Family != "anthropic" || loaded[0].Access != "" || loaded[1].Support != SupportUnsupported {
+		t.Errorf("キャッシュから読み込んだモデルの情報が期待通りではありません: %+v", loaded)
+	}
+
+	testCases := []struct {
+		name        string
+		ttl         time.Duration
+		now         time.Time
+		expectFresh bool
+	}{
+		{name: "有効期限内", ttl: time.Hour, now: now.Add(30 * time.Minute), expectFresh: true},
+		{name: "期限切れ", ttl: time.Hour, now: now.Add(2 * time.Hour)},
+		{name: "キャッシュを使用しない", ttl: 0, now: now},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fresh, err := cache.LoadFresh(tc.ttl, tc.now)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if (fresh != nil) != tc.expectFresh {
+				t.Errorf("有効期限の判定が期待通りではありません: %v", fresh)
+			}
+		})
+	}
+}
+
+// キャッシュを使用したモデル一覧の表示のテスト
+func TestListModelsCache(t *testing.T) {
+	useMockRuntimeClient(t)
+	t.Setenv("AWS_REGION", "us-west-2")
+	client := &countingBedrockClient{}
+	newBedrockClient = func(cfg interface{}) BedrockClientAPI {
+		return client
+	}
+
+	list := func(opts ListOptions) (string, error) {
+		var stdout, stderr bytes.Buffer
+		opts.Output, opts.ErrOutput, opts.Format = &stdout, &stderr, ListOutputIDs
+		err := ListModels(context.Background(), ClientOptions{}, opts)
+		return stdout.String(), err
+	}
+
+	// キャッシュがない場合は --cached でエラー
+	if _, err := list(ListOptions{CacheOnly: true}); err == nil {
+		t.Error("キャッシュがない場合にエラーが期待されました")
+	}
+
+	steps := []struct {
+		name           string
+		opts           ListOptions
+		expectCalls    int
+		expectLines    int
+		expectProvider string // APIで絞り込んだプロバイダー（空の場合はすべてのモデルを取得）
+	}{
+		{name: "APIから取得してキャッシュに保存", opts: ListOptions{CacheTTL: time.Hour}, expectCalls: 1, expectLines: 25},
+		{name: "キャッシュから絞り込む", opts: ListOptions{CacheTTL: time.Hour, Provider: "anthropic", InferenceType: "ON_DEMAND"}, expectCalls: 1, expectLines: 6},
+		{name: "取得し直す", opts: ListOptions{CacheTTL: time.Hour, Refresh: true, Provider: "anthropic"}, expectCalls: 2, expectLines: 11},
+		{name: "キャッシュを使用しない", opts: ListOptions{}, expectCalls: 3, expectLines: 25},
+		{name: "キャッシュを使用しない場合はAPIで絞り込む", opts: ListOptions{Provider: "anthropic", InferenceType: "ON_DEMAND"}, expectCalls: 4, expectLines: 6, expectProvider: "anthropic"},
+		{name: "キャッシュのみ", opts: ListOptions{CacheOnly: true, OutputModality: "EMBEDDING"}, expectCalls: 4, expectLines: 5},
+	}
+	for _, step := range steps {
+		client.params = nil
+		output, err := list(step.opts)
+		if err != nil {
+			t.Fatalf("%s: 予期せぬエラー: %v", step.name, err)
+		}
+		if client.calls != step.expectCalls {
+			t.Errorf("%s: APIの呼び出し回数が期待通りではありません。期待: %d, 実際: %d", step.name, step.expectCalls, client.calls)
+		}
+		// APIを呼び出した場合は、絞り込みの条件を確認する
+		if client.params != nil && aws.ToString(client.params.ByProvider) != step.expectProvider {
+			t.Errorf("%s: APIで絞り込んだプロバイダーが期待通りではありません。期待: %q, 実際: %q", step.name, step.expectProvider, aws.ToString(client.params.ByProvider))
+		}
+		if lines := strings.Count(output, "\n"); lines != step.expectLines {
+			t.Errorf("%s: モデルの件数が期待通りではありません。期待: %d, 実際: %d", step.name, step.expectLines, lines)
+		}
+	}
+
+	// リージョンごとのファイルに保存されていること
+	cache, err := DefaultModelCache("us-west-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cache.Path); err != nil {
+		t.Errorf("キャッシュファイルが作成されていません: %v", err)
+	}
+	if models, err := CachedModels(context.Background(), ClientOptions{}, time.Hour); err != nil || len(models) != 25 {
+		t.Errorf("キャッシュされたモデル一覧が期待通りではありません: %d件, %v", len(models), err)
+	}
+}
+
+// キャッシュされたモデル一覧でのモデルIDの検証のテスト
+func TestValidateModelID(t *testing.T) {
+	models := []ModelInfo{
+		{ID: "anthropic.claude-3-haiku-20240307-v1:0", Support: SupportInvoke},
+		{ID: "anthropic.claude-3-5-sonnet-20240620-v1:0", Support: SupportInvoke},
+		{ID: "amazon.nova-pro-v1:0", Support: SupportConverse},
+		{ID: "amazon.nova-canvas-v1:0", Support: SupportUnsupported},
+	}
+	aliases := []ModelAlias{{Name: "haiku"}, {Name: "sonnet"}, {Name: "sonnet-v2"}}
+
+	testCases := []struct {
+		name          string
+		input         string
+		modelID       string
+		models        []ModelInfo
+		expectError   bool
+		expectSuggest string
+	}{
+		{name: "一覧にあるモデル", input: "haiku", modelID: "anthropic.claude-3-haiku-20240307-v1:0", models: models},
+		{name: "クロスリージョン推論プロファイル", input: "us.amazon.nova-pro-v1:0", modelID: "us.amazon.nova-pro-v1:0", models: models},
+		{name: "ARN", input: "arn:aws:bedrock:us-east-1:123456789012:provisioned-model/abc", modelID: "arn:aws:bedrock:us-east-1:123456789012:provisioned-model/abc", models: models},
+		{name: "キャッシュがない", input: "unknown", modelID: "unknown"},
+		{name: "エイリアスの誤り", input: "sonet", modelID: "sonet", models: models, expectError: true, expectSuggest: "もしかして: sonnet?"},
+		{name: "モデルIDの一部", input: "nova-pro", modelID: "nova-pro", models: models, expectError: true, expectSuggest: "もしかして: amazon.nova-pro-v1:0?"},
+		{name: "候補なし", input: "gpt-4o", modelID: "gpt-4o", models: models, expectError: true, expectSuggest: "hiracli llm list"},
+		{name: "テキストを生成しないモデルは候補にしない", input: "nova-canvas", modelID: "nova-canvas", models: models, expectError: true, expectSuggest: "hiracli llm list"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateModelID(tc.input, tc.modelID, tc.models, aliases)
+			if !tc.expectError {
+				if err != nil {
+					t.Errorf("予期せぬエラー: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("エラーが期待されましたが、発生しませんでした")
+			}
+			if !strings.Contains(err.Error(), tc.expectSuggest) {
+				t.Errorf("エラーメッセージが期待通りではありません: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/smithy-go"
+)
+
+// 動作確認でモデルに送信するプロンプトと最大出力トークン数
+const (
+	checkPrompt    = "Reply with OK."
+	checkMaxTokens = 10
+)
+
+// CheckOptions は、モデルの動作確認を行う際のオプションを定義する構造体です
+type CheckOptions struct {
+	LLMModel string        // 確認するモデルID
+	API      string        // 使用するAPI（空の場合はモデルファミリーがあればInvokeModel、なければConverse）
+	Client   ClientOptions // タイムアウトと再試行、AWSの接続先の設定
+
+	ErrOutput io.Writer // 警告や使用量の出力先（nilの場合は標準エラー出力）
+}
+
+// CheckResult は、モデルの動作確認の結果を定義する構造体です
+type CheckResult struct {
+	ModelID string        // 確認したモデルID
+	Family  string        // InvokeModelで使用するモデルファミリー（ない場合は空）
+	API     string        // 使用したAPI
+	Latency time.Duration // 呼び出しにかかった時間
+	Usage   Usage         // トークン数
+	Text    string        // モデルの回答
+	Err     error         // 呼び出しのエラー（成功した場合はnil）
+	Hint    string        // エラーの原因と対処の説明
+}
+
+// OK は、モデルを呼び出せた場合にtrueを返します
+func (r *CheckResult) OK() bool {
+	return r.Err == nil
+}
+
+// CheckModel は、モデルに短いプロンプトを送信し、呼び出せるかどうかと応答時間を確認する関数です
+// モデルの呼び出しに失敗した場合は、エラーを返さずに結果のErrとHintに設定します
+func CheckModel(ctx context.Context, opts CheckOptions) (*CheckResult, error) {
+	if err := ValidateAPI(opts.API); err != nil {
+		return nil, err
+	}
+	if opts.Client.ErrOutput == nil {
+		opts.Client.ErrOutput = opts.ErrOutput
+	}
+
+	cfg, err := loadAWSConfig(ctx, opts.Client)
+	if err != nil {
+		return nil, err
+	}
+
+	// アプリケーション推論プロファイルやプロビジョンドスループットのARNは、元のモデルでモデルファミリーを判定する
+	baseModel, err := resolveModelARN(ctx, cfg, opts.Client, opts.LLMModel)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CheckResult{ModelID: opts.LLMModel, API: opts.API}
+	family, err := FindModelFamily(baseModel)
+	if err == nil {
+		result.Family = family.Name()
+	} else {
+		// モデルファミリーがないモデルはConverse APIでのみ呼び出せる
+		if opts.API == APIInvoke {
+			return nil, err
+		}
+		result.API = APIConverse
+	}
+	if result.API == "" {
+		result.API = APIInvoke
+	}
+
+	ctx, cancel := withTimeout(ctx, opts.Client)
+	defer cancel()
+
+	askOpts := AskOptions{
+		LLMModel:  opts.LLMModel,
+		NoStream:  true,
+		Command:   "llm check",
+		Params:    InferenceParams{MaxTokens: checkMaxTokens},
+		Client:    opts.Client,
+		API:       result.API,
+		Output:    io.Discard,
+		ErrOutput: opts.ErrOutput,
+		baseModel: baseModel,
+	}
+	if askOpts.ErrOutput == nil {
+		askOpts.ErrOutput = os.Stderr
+	}
+
+	start := time.Now()
+	response, err := callModel(ctx, askOpts, newBedrockRuntimeClient(cfg), family, []Message{{Role: RoleUser, Content: checkPrompt}})
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		result.Hint = errorHint(err)
+		return result, nil
+	}
+
+	result.Usage = response.Usage
+	result.Text = strings.TrimSpace(response.Text)
+	recordUsage(askOpts, response)
+	return result, nil
+}
+
+// errorHint は、モデル呼び出しのエラーから考えられる原因と対処を返す関数です
+func errorHint(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "タイムアウトしました。--timeout を延ばすか、ネットワークとリージョンの設定を確認してください"
+	}
+
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return ""
+	}
+	message := strings.ToLower(apiErr.ErrorMessage())
+	switch apiErr.ErrorCode() {
+	case "AccessDeniedException":
+		if strings.Contains(message, "model access") || strings.Contains(message, "don't have access") {
+			return "このアカウントではモデルアクセスが有効になっていません。Bedrockコンソールのモデルアクセスで有効にしてください"
+		}
+		return "IAMポリシーでbedrock:InvokeModelが許可されていない可能性があります。ロールやSCPを確認してください"
+	case "ResourceNotFoundException":
+		return "モデルが見つかりません。モデルIDとリージョンを確認してください（hiracli llm list で確認できます）"
+	case "ValidationException":
+		switch {
+		case strings.Contains(message, "on-demand"):
+			return "このモデルはオンデマンドで呼び出せません。クロスリージョン推論プロファイルのID（例: us.）を指定してください"
+		case strings.Contains(message, "invalid") && strings.Contains(message, "model"):
+			return "モデルIDが正しくありません。hiracli llm list で利用可能なモデルIDを確認してください"
+		case isConverseUnsupported(err):
+			return "このモデルはConverse APIに対応しておらず、対応するモデルファミリーもないため、hiracliでは呼び出せません"
+		}
+	case "ThrottlingException", "ServiceQuotaExceededException":
+		return "リクエストが制限されています。しばらく待ってから再実行するか、サービスクォータを確認してください"
+	case "ModelNotReadyException":
+		return "モデルの準備ができていません。しばらく待ってから再実行してください"
+	}
+	return ""
+}
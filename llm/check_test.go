@@ -0,0 +1,89 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// モデルの動作確認のテスト
+func TestCheckModel(t *testing.T) {
+	testCases := []struct {
+		name         string
+		model        string
+		api          string
+		expectAPI    string
+		expectFamily string
+		expectOK     bool
+		expectHint   string
+		expectError  bool
+	}{
+		{name: "InvokeModelで呼び出せるモデル", model: "anthropic.claude-3-5-sonnet-20240620-v1:0", expectAPI: APIInvoke, expectFamily: "anthropic", expectOK: true},
+		{name: "Converseを指定", model: "anthropic.claude-3-5-sonnet-20240620-v1:0", api: APIConverse, expectAPI: APIConverse, expectFamily: "anthropic", expectOK: true},
+		{name: "モデルファミリーがなくConverseに対応していないモデル", model: "amazon.nova-pro-v1:0", expectAPI: APIConverse, expectHint: "hiracliでは呼び出せません"},
+		{name: "モデルファミリーがないモデルにInvokeModelを指定", model: "amazon.nova-pro-v1:0", api: APIInvoke, expectError: true},
+		{name: "不正なAPI", model: "anthropic.claude-3-5-sonnet-20240620-v1:0", api: "chat", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useMockRuntimeClient(t)
+
+			var stderr bytes.Buffer
+			result, err := CheckModel(context.Background(), CheckOptions{LLMModel: tc.model, API: tc.api, ErrOutput: &stderr})
+			if tc.expectError {
+				if err == nil {
+					t.Error("エラーが期待されましたが、発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			if result.API != tc.expectAPI || result.Family != tc.expectFamily {
+				t.Errorf("APIとモデルファミリーが期待通りではありません: %s, %s", result.API, result.Family)
+			}
+			if result.OK() != tc.expectOK {
+				t.Fatalf("結果が期待通りではありません: %v", result.Err)
+			}
+			if tc.expectOK && (result.Text == "" || result.Usage.OutputTokens == 0) {
+				t.Errorf("回答と使用量が記録されていません: %+v", result)
+			}
+			if !strings.Contains(result.Hint, tc.expectHint) {
+				t.Errorf("対処の説明が期待通りではありません: %s", result.Hint)
+			}
+		})
+	}
+}
+
+// エラーの原因と対処の説明のテスト
+func TestErrorHint(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		expect string
+	}{
+		{name: "モデルアクセスが無効", err: &types.AccessDeniedException{Message: aws.String("You don't have access to the model with the specified model ID.")}, expect: "モデルアクセス"},
+		{name: "IAMで拒否", err: &types.AccessDeniedException{Message: aws.String("User is not authorized to perform: bedrock:InvokeModel")}, expect: "IAMポリシー"},
+		{name: "オンデマンド非対応", err: &types.ValidationException{Message: aws.String("Invocation of model ID with on-demand throughput isn't supported.")}, expect: "クロスリージョン推論"},
+		{name: "スロットリング", err: fmt.Errorf("モデル呼び出しエラー: %w", &types.ThrottlingException{Message: aws.String("Too many requests")}), expect: "制限"},
+		{name: "タイムアウト", err: fmt.Errorf("モデル呼び出しがタイムアウトしました: %w", context.DeadlineExceeded), expect: "--timeout"},
+		{name: "その他のエラー", err: errors.New("unexpected"), expect: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hint := errorHint(tc.err)
+			if tc.expect == "" && hint != "" || !strings.Contains(hint, tc.expect) {
+				t.Errorf("対処の説明が期待通りではありません: %q", hint)
+			}
+		})
+	}
+}
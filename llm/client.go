@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/smithy-go"
+)
+
+// BedrockRuntimeAPI はBedrock Runtime APIのインターフェースです（テスト用にモック可能）
+type BedrockRuntimeAPI interface {
+	InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error)
+	InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelWithResponseStreamOutput, error)
+	Converse(ctx context.Context, params *bedrockruntime.ConverseInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseOutput, error)
+	ConverseStream(ctx context.Context, params *bedrockruntime.ConverseStreamInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseStreamOutput, error)
+}
+
+// デフォルトのBedrockRuntimeクライアント生成関数
+var newBedrockRuntimeClient = func(cfg aws.Config) BedrockRuntimeAPI {
+	return bedrockruntime.NewFromConfig(cfg)
+}
+
+// ロールを引き受ける際のセッション名（CloudTrailでhiracliからの呼び出しを識別するため）
+const roleSessionName = "hiracli"
+
+// デフォルトのタイムアウトと再試行の設定
+const (
+	DefaultTimeout    = 5 * time.Minute
+	DefaultMaxRetries = 3
+	defaultBaseDelay  = 500 * time.Millisecond
+	defaultMaxDelay   = 20 * time.Second
+)
+
+// ClientOptions は、Bedrock APIの呼び出しのタイムアウトと再試行を定義する構造体です
+type ClientOptions struct {
+	Timeout    time.Duration // 1回のコマンドでのAPI呼び出し全体のタイムアウト（0の場合は無制限）
+	MaxRetries int           // 一時的なエラーで再試行する最大回数（0の場合は再試行しない）
+	BaseDelay  time.Duration // 再試行の待ち時間の基準値（0の場合はデフォルト値）
+	MaxDelay   time.Duration // 再試行の待ち時間の上限（0の場合はデフォルト値）
+	Region     string        // AWSのリージョン（空の場合はAWSの設定に従う）
+	Profile    string        // AWSの名前付きプロファイル（空の場合はAWSの設定に従う）
+
+	AssumeRoleARN string // 引き受けるIAMロールのARN（空の場合は引き受けない）
+
+	ErrOutput io.Writer // 再試行の通知の出力先（nilの場合は標準エラー出力）
+}
+
+// errOutput は、再試行の通知の出力先を返す関数です
+func (opts ClientOptions) errOutput() io.Writer {
+	if opts.ErrOutput == nil {
+		return os.Stderr
+	}
+	return opts.ErrOutput
+}
+
+// DefaultClientOptions は、デフォルトのタイムアウトと再試行の設定を返す関数です
+func DefaultClientOptions() ClientOptions {
+	return ClientOptions{
+		Timeout:    DefaultTimeout,
+		MaxRetries: DefaultMaxRetries,
+	}
+}
+
+// 再試行の対象とするBedrockのエラーコード
+var retryableErrorCodes = map[string]bool{
+	"ThrottlingException":         true,
+	"TooManyRequestsException":    true,
+	"ModelNotReadyException":      true,
+	"ServiceUnavailableException": true,
+	"ServiceUnavailable":          true,
+	"InternalServerException":     true,
+	"ModelTimeoutException":       true,
+}
+
+// isRetryableError は、エラーが再試行で解消する可能性のある一時的なものかを返す関数です
+func isRetryableError(err error) bool {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return retryableErrorCodes[apiErr.ErrorCode()]
+	}
+	return false
+}
+
+// backoffDelay は、再試行までの待ち時間をジッター付きの指数バックオフで計算する関数です
+func backoffDelay(opts ClientOptions, attempt int) time.Duration {
+	base := opts.BaseDelay
+	if base <= 0 {
+		base = defaultBaseDelay
+	}
+	maxDelay := opts.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxDelay
+	}
+
+	delay := maxDelay
+	if attempt < 30 && base<<attempt < maxDelay {
+		delay = base << attempt
+	}
+
+	// 複数のクライアントが同時に再試行しないよう、待ち時間を0から上限の間でランダムにする
+	return time.Duration(rand.Int63n(int64(delay) + 1))
+}
+
+// withRetry は、一時的なエラーの場合に指数バックオフで再試行しながら関数を実行する関数です
+// コンテキストがキャンセルされた場合は、待機中でも直ちに終了します
+func withRetry(ctx context.Context, opts ClientOptions, fn func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !isRetryableError(err) || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= opts.MaxRetries {
+			return fmt.Errorf("%d 回再試行しましたが失敗しました: %w", opts.MaxRetries, err)
+		}
+
+		delay := backoffDelay(opts, attempt)
+		fmt.Fprintf(opts.errOutput(), "一時的なエラーのため %.1f 秒後に再試行します（%d/%d）: %v\n", delay.Seconds(), attempt+1, opts.MaxRetries, err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// withTimeout は、タイムアウトが指定されている場合にコンテキストへ期限を設定する関数です
+func withTimeout(ctx context.Context, opts ClientOptions) (context.Context, context.CancelFunc) {
+	if opts.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, opts.Timeout)
+}
+
+// callError は、API呼び出しのエラーを中断・タイムアウト・その他に分けてラップする関数です
+func callError(ctx context.Context, opts ClientOptions, operation string, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%sがタイムアウトしました（%s）: %w", operation, opts.Timeout, ctx.Err())
+	case ctx.Err() != nil:
+		return fmt.Errorf("%sを中断しました: %w", operation, ctx.Err())
+	default:
+		return fmt.Errorf("%sエラー: %w", operation, err)
+	}
+}
+
+// loadAWSConfig は、AWSの設定を読み込む関数です
+// 再試行はwithRetryで行うため、SDK自身の再試行は無効にします
+func loadAWSConfig(ctx context.Context, opts ClientOptions) (aws.Config, error) {
+	optFns := []func(*config.LoadOptions) error{
+		config.WithRetryer(func() aws.Retryer {
+			return aws.NopRetryer{}
+		}),
+	}
+	if opts.Region != "" {
+		optFns = append(optFns, config.WithRegion(opts.Region))
+	}
+	if opts.Profile != "" {
+		optFns = append(optFns, config.WithSharedConfigProfile(opts.Profile))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, optFns...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("AWS設定の読み込みエラー: %v", err)
+	}
+
+	// 別のアカウントのBedrockを使用する場合は、読み込んだ認証情報でロールを引き受ける
+	if opts.AssumeRoleARN != "" {
+		provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), opts.AssumeRoleARN, func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = roleSessionName
+		})
+		cfg.Credentials = aws.NewCredentialsCache(provider)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,222 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// 失敗を注入できるモックのBedrock Runtimeクライアント
+type FakeRuntimeClient struct {
+	failures []error // 先頭から順に返すエラー（使い切った後は成功）
+	body     string  // 成功時に返すレスポンス
+	calls    int
+}
+
+func (c *FakeRuntimeClient) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	c.calls++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if c.calls <= len(c.failures) {
+		return nil, c.failures[c.calls-1]
+	}
+	return &bedrockruntime.InvokeModelOutput{Body: []byte(c.body)}, nil
+}
+
+func (c *FakeRuntimeClient) InvokeModelWithResponseStream(ctx context.Context, params *bedrockruntime.InvokeModelWithResponseStreamInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelWithResponseStreamOutput, error) {
+	return nil, fmt.Errorf("ストリーミングには対応していません")
+}
+
+func (c *FakeRuntimeClient) Converse(ctx context.Context, params *bedrockruntime.ConverseInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseOutput, error) {
+	return nil, fmt.Errorf("Converseには対応していません")
+}
+
+func (c *FakeRuntimeClient) ConverseStream(ctx context.Context, params *bedrockruntime.ConverseStreamInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseStreamOutput, error) {
+	return nil, fmt.Errorf("ストリーミングには対応していません")
+}
+
+// AWSの接続先の設定のテスト
+func TestLoadAWSConfig(t *testing.T) {
+	useMockRuntimeClient(t)
+	t.Setenv("AWS_REGION", "ap-northeast-1")
+	t.Setenv("AWS_PROFILE", "")
+
+	// 指定がない場合はAWSの設定に従う
+	cfg, err := loadAWSConfig(context.Background(), ClientOptions{})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if cfg.Region != "ap-northeast-1" {
+		t.Errorf("リージョンが期待通りではありません: %s", cfg.Region)
+	}
+
+	// リージョンとロールの指定
+	cfg, err = loadAWSConfig(context.Background(), ClientOptions{
+		Region:        "us-west-2",
+		AssumeRoleARN: "arn:aws:iam::123456789012:role/BedrockRole",
+	})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if cfg.Region != "us-west-2" {
+		t.Errorf("指定したリージョンが使用されていません: %s", cfg.Region)
+	}
+	cache, ok := cfg.Credentials.(*aws.CredentialsCache)
+	if !ok || !cache.IsCredentialsProvider(&stscreds.AssumeRoleProvider{}) {
+		t.Errorf("ロールを引き受ける認証情報が設定されていません: %T", cfg.Credentials)
+	}
+
+	// 存在しないプロファイル
+	if _, err := loadAWSConfig(context.Background(), ClientOptions{Profile: "no-such-profile"}); err == nil {
+		t.Error("存在しないプロファイルでエラーが発生しませんでした")
+	}
+}
+
+// 再試行の対象となるエラーの判定のテスト
+func TestIsRetryableError(t *testing.T) {
+	testCases := []struct {
+		name   string
+		err    error
+		expect bool
+	}{
+		{name: "スロットリング", err: &types.ThrottlingException{Message: aws.String("rate exceeded")}, expect: true},
+		{name: "モデルの準備中", err: &types.ModelNotReadyException{Message: aws.String("not ready")}, expect: true},
+		{name: "サービス利用不可", err: &types.ServiceUnavailableException{Message: aws.String("unavailable")}, expect: true},
+		{name: "ラップされたスロットリング", err: fmt.Errorf("呼び出しエラー: %w", &types.ThrottlingException{}), expect: true},
+		{name: "入力の検証エラー", err: &types.ValidationException{Message: aws.String("invalid")}, expect: false},
+		{name: "アクセス拒否", err: &types.AccessDeniedException{Message: aws.String("denied")}, expect: false},
+		{name: "APIエラー以外", err: errors.New("unknown"), expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := isRetryableError(tc.err); actual != tc.expect {
+				t.Errorf("判定が期待通りではありません。期待: %v, 実際: %v", tc.expect, actual)
+			}
+		})
+	}
+}
+
+// 再試行の待ち時間が上限を超えないかのテスト
+func TestBackoffDelay(t *testing.T) {
+	opts := ClientOptions{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+
+	for attempt := 0; attempt < 40; attempt++ {
+		limit := opts.MaxDelay
+		if attempt < 4 {
+			limit = opts.BaseDelay << attempt
+		}
+		for i := 0; i < 20; i++ {
+			delay := backoffDelay(opts, attempt)
+			if delay < 0 || delay > limit {
+				t.Fatalf("%d 回目の待ち時間が範囲外です: %v（上限: %v）", attempt, delay, limit)
+			}
+		}
+	}
+}
+
+// 一時的なエラーで再試行し、回答を取得できるかのテスト
+func TestProcessPromptRetry(t *testing.T) {
+	throttling := &types.ThrottlingException{Message: aws.String("rate exceeded")}
+	body := `{"content":[{"type":"text","text":"再試行後の回答"}],"usage":{"input_tokens":3,"output_tokens":5}}`
+
+	testCases := []struct {
+		name        string
+		failures    []error
+		maxRetries  int
+		expectCalls int
+		expectError bool
+	}{
+		{name: "再試行で成功", failures: []error{throttling, &types.ServiceUnavailableException{}}, maxRetries: 3, expectCalls: 3},
+		{name: "再試行回数の上限", failures: []error{throttling, throttling, throttling}, maxRetries: 2, expectCalls: 3, expectError: true},
+		{name: "再試行しないエラー", failures: []error{&types.ValidationException{Message: aws.String("invalid")}}, maxRetries: 3, expectCalls: 1, expectError: true},
+		{name: "再試行なし", failures: []error{throttling}, maxRetries: 0, expectCalls: 1, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			client := &FakeRuntimeClient{failures: tc.failures, body: body}
+			var stderr bytes.Buffer
+			opts := AskOptions{
+				LLMModel: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+				Prompt:   "test",
+				NoStream: true,
+				Output:   io.Discard,
+				Client:   ClientOptions{MaxRetries: tc.maxRetries, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond, ErrOutput: &stderr},
+			}
+
+			response, err := processPrompt(context.Background(), opts, client, []Message{{Role: RoleUser, Content: "test"}})
+			if client.calls != tc.expectCalls {
+				t.Errorf("呼び出し回数が期待通りではありません。期待: %d, 実際: %d", tc.expectCalls, client.calls)
+			}
+			// 再試行のたびに、指定した出力先へ通知する
+			if notices := strings.Count(stderr.String(), "再試行します"); notices != tc.expectCalls-1 {
+				t.Errorf("再試行の通知の件数が期待通りではありません。期待: %d, 実際: %d\n%s", tc.expectCalls-1, notices, stderr.String())
+			}
+			if tc.expectError {
+				if err == nil {
+					t.Error("エラーが期待されましたが、発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if response.Text != "再試行後の回答" {
+				t.Errorf("回答が期待通りではありません: %s", response.Text)
+			}
+		})
+	}
+}
+
+// 再試行の待機中にキャンセルされた場合に直ちに終了するかのテスト
+func TestProcessPromptRetryCanceled(t *testing.T) {
+	client := &FakeRuntimeClient{failures: []error{&types.ThrottlingException{}}, body: `{"content":[{"type":"text","text":"回答"}]}`}
+	opts := AskOptions{
+		LLMModel: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+		Prompt:   "test",
+		NoStream: true,
+		Output:   io.Discard,
+		Client:   ClientOptions{MaxRetries: 3, BaseDelay: time.Hour, MaxDelay: time.Hour, ErrOutput: io.Discard},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	_, err := processPrompt(ctx, opts, client, []Message{{Role: RoleUser, Content: "test"}})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("キャンセルのエラーが期待されましたが、%v が返されました", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("キャンセル後も待機が続きました: %v", elapsed)
+	}
+}
+
+// タイムアウトした場合にタイムアウトのエラーが返されるかのテスト
+func TestProcessPromptTimeout(t *testing.T) {
+	client := &FakeRuntimeClient{failures: []error{&types.ThrottlingException{}}, body: `{"content":[{"type":"text","text":"回答"}]}`}
+	opts := AskOptions{
+		LLMModel: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+		Prompt:   "test",
+		NoStream: true,
+		Output:   io.Discard,
+		Client:   ClientOptions{Timeout: 50 * time.Millisecond, MaxRetries: 3, BaseDelay: time.Hour, MaxDelay: time.Hour, ErrOutput: io.Discard},
+	}
+
+	_, err := processPrompt(context.Background(), opts, client, []Message{{Role: RoleUser, Content: "test"}})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("タイムアウトのエラーが期待されましたが、%v が返されました", err)
+	}
+}
@@ -0,0 +1,642 @@
+package llm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultModelID は、設定ファイルでデフォルトのモデルが指定されていない場合に使用するモデルIDです
+const DefaultModelID = "anthropic.claude-3-5-sonnet-20240620-v1:0"
+
+// 設定ファイルのファイル名
+const (
+	userConfigFileName = "config.yaml"   // ユーザーごとの設定（設定ディレクトリ配下）
+	repoConfigFileName = ".hiracli.yaml" // リポジトリごとの設定（リポジトリのルートまたはその配下）
+)
+
+// 組み込みのモデルのエイリアス
+var builtinModelAliases = map[string]string{
+	"sonnet":    "anthropic.claude-3-5-sonnet-20240620-v1:0",
+	"sonnet-v2": "anthropic.claude-3-5-sonnet-20241022-v2:0",
+	"haiku":     "anthropic.claude-3-haiku-20240307-v1:0",
+	"opus":      "anthropic.claude-3-opus-20240229-v1:0",
+	"titan":     "amazon.titan-text-express-v1",
+	"llama":     "meta.llama3-8b-instruct-v1:0",
+	"mistral":   "mistral.mistral-large-2402-v1:0",
+	"command-r": "cohere.command-r-v1:0",
+	"jamba":     "ai21.jamba-1-5-mini-v1:0",
+}
+
+// エイリアスが別のエイリアスを指す場合に解決をたどる回数の上限
+const maxAliasDepth = 10
+
+// 使用するプロファイルを指定する環境変数
+const profileEnv = "HIRACLI_PROFILE"
+
+// 設定元の表示名
+const (
+	sourceDefault = "default" // 組み込みのデフォルト値
+	sourceEnv     = "env"     // 環境変数（"env 変数名" の形式で表示）
+	sourceFlag    = "flag"    // コマンドラインのフラグ（"flag --名前" の形式で表示）
+)
+
+// settingKey は、設定ファイル・環境変数・フラグで指定できる設定項目を定義する構造体です
+type settingKey struct {
+	name string // 設定ファイルのキー
+	env  string // 設定を上書きする環境変数
+}
+
+// 設定項目（config list で表示する順）
+var settingKeys = []settingKey{
+	{name: "default_model", env: "HIRACLI_DEFAULT_MODEL"},
+	{name: "aws_profile", env: "AWS_PROFILE"},
+	{name: "region", env: "AWS_REGION"},
+	{name: "assume_role_arn", env: "HIRACLI_ASSUME_ROLE_ARN"},
+	{name: "lang", env: "HIRACLI_LANG"},
+	{name: "max_tokens", env: "HIRACLI_MAX_TOKENS"},
+	{name: "max_input_tokens", env: "HIRACLI_MAX_INPUT_TOKENS"},
+	{name: "model_cache_ttl", env: "HIRACLI_MODEL_CACHE_TTL"},
+	{name: "tokenizer", env: "HIRACLI_TOKENIZER"},
+}
+
+// Settings は、プロファイルごとに切り替えられる設定項目を定義する構造体です
+type Settings struct {
+	DefaultModel   string `yaml:"default_model,omitempty"`    // デフォルトのモデル（モデルIDまたはエイリアス）
+	AWSProfile     string `yaml:"aws_profile,omitempty"`      // AWSの名前付きプロファイル
+	Region         string `yaml:"region,omitempty"`           // AWSのリージョン
+	AssumeRoleARN  string `yaml:"assume_role_arn,omitempty"`  // Bedrockの呼び出しに引き受けるIAMロールのARN
+	Lang           string `yaml:"lang,omitempty"`             // 回答やコミットメッセージの言語
+	MaxTokens      int    `yaml:"max_tokens,omitempty"`       // 最大出力トークン数（0の場合はデフォルト）
+	MaxInputTokens int    `yaml:"max_input_tokens,omitempty"` // flatten-srcの最大トークン数
+	ModelCacheTTL  string `yaml:"model_cache_ttl,omitempty"`  // モデル一覧のキャッシュの有効期限（0の場合はキャッシュを使用しない）
+	Tokenizer      string `yaml:"tokenizer,omitempty"`        // flatten-srcとcount-tokensで使用するトークナイザー
+}
+
+// defaultSettings は、組み込みのデフォルトの設定を返す関数です
+func defaultSettings() Settings {
+	return Settings{
+		DefaultModel:   DefaultModelID,
+		Lang:           "日本語",
+		MaxInputTokens: 200000,
+		ModelCacheTTL:  "24h",
+		Tokenizer:      DefaultTokenizer,
+	}
+}
+
+// CacheTTL は、モデル一覧のキャッシュの有効期限を返します（未設定の場合は24時間）
+func (s *Settings) CacheTTL() time.Duration {
+	ttl, err := time.ParseDuration(s.ModelCacheTTL)
+	if err != nil {
+		return DefaultModelCacheTTL
+	}
+	return ttl
+}
+
+// value は、設定キーに対応する値を文字列で返します（未設定の場合は空文字列）
+func (s *Settings) value(key string) string {
+	switch key {
+	case "default_model":
+		return s.DefaultModel
+	case "aws_profile":
+		return s.AWSProfile
+	case "region":
+		return s.Region
+	case "assume_role_arn":
+		return s.AssumeRoleARN
+	case "lang":
+		return s.Lang
+	case "max_tokens":
+		return formatIntSetting(s.MaxTokens)
+	case "max_input_tokens":
+		return formatIntSetting(s.MaxInputTokens)
+	case "model_cache_ttl":
+		return s.ModelCacheTTL
+	case "tokenizer":
+		return s.Tokenizer
+	}
+	return ""
+}
+
+// set は、設定キーに対応する値を文字列から設定します
+func (s *Settings) set(key, value string) error {
+	switch key {
+	case "default_model":
+		s.DefaultModel = value
+	case "aws_profile":
+		s.AWSProfile = value
+	case "region":
+		s.Region = value
+	case "assume_role_arn":
+		if value != "" && !arn.IsARN(value) {
+			return fmt.Errorf("%s にはIAMロールのARNを指定してください: %s", key, value)
+		}
+		s.AssumeRoleARN = value
+	case "lang":
+		s.Lang = value
+	case "max_tokens":
+		return parseIntSetting(key, value, &s.MaxTokens)
+	case "max_input_tokens":
+		return parseIntSetting(key, value, &s.MaxInputTokens)
+	case "model_cache_ttl":
+		if ttl, err := time.ParseDuration(value); value != "" && (err != nil || ttl < 0) {
+			return fmt.Errorf("%s には0以上の期間を指定してください（例: 24h, 30m、0でキャッシュを使用しない）: %s", key, value)
+		}
+		s.ModelCacheTTL = value
+	case "tokenizer":
+		if err := ValidateTokenizer(value); err != nil {
+			return err
+		}
+		s.Tokenizer = value
+	default:
+		return fmt.Errorf("不明な設定キーです: %s", key)
+	}
+	return nil
+}
+
+// formatIntSetting は、整数の設定値を文字列に変換します（0の場合は未設定として空文字列）
+func formatIntSetting(value int) string {
+	if value == 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+// parseIntSetting は、整数の設定値を解析します（空文字列の場合は0）
+func parseIntSetting(key, value string, dst *int) error {
+	if value == "" {
+		*dst = 0
+		return nil
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 {
+		return fmt.Errorf("%s には0以上の整数を指定してください: %s", key, value)
+	}
+	*dst = v
+	return nil
+}
+
+// isSettingKey は、プロファイルで切り替えられる設定キーかどうかを返します
+func isSettingKey(key string) bool {
+	for _, k := range settingKeys {
+		if k.name == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Config は、設定ファイルの内容を定義する構造体です
+type Config struct {
+	Settings `yaml:",inline"`
+	Profile  string              `yaml:"profile,omitempty"`  // 使用するプロファイル名
+	Profiles map[string]Settings `yaml:"profiles,omitempty"` // 名前付きプロファイル（プロファイル名: 設定）
+	Aliases  map[string]string   `yaml:"aliases,omitempty"`  // モデルのエイリアス（エイリアス: モデルIDまたはエイリアス）
+}
+
+// configKeys は、設定ファイルに記述されているキーを定義する構造体です
+// 0や空文字列を指定して下位の設定を上書きできるように、値の有無ではなくキーの有無で判断します
+type configKeys struct {
+	Profiles map[string]map[string]interface{} `yaml:"profiles"`
+	Settings map[string]interface{}            `yaml:",inline"`
+}
+
+// has は、トップレベルの設定にキーが記述されているかを返します
+func (k configKeys) has(key string) bool {
+	_, ok := k.Settings[key]
+	return ok
+}
+
+// ModelAlias は、エイリアスと対応するモデルIDを定義する構造体です
+type ModelAlias struct {
+	Name    string // エイリアス
+	ModelID string // 解決後のモデルID
+	Source  string // 定義元（組み込みの場合は空、設定ファイルの場合はそのパス）
+}
+
+// ConfigEntry は、config list で表示する設定項目と値、設定元を定義する構造体です
+type ConfigEntry struct {
+	Key    string
+	Value  string
+	Source string
+}
+
+// profileLayer は、設定ファイルに定義されたプロファイルの設定を保持する構造体です
+type profileLayer struct {
+	name     string
+	settings Settings
+	source   string
+}
+
+// LoadedConfig は、デフォルト値・設定ファイル・プロファイル・環境変数を重ねた設定を保持する構造体です
+type LoadedConfig struct {
+	Settings                        // 各層を重ねた設定値
+	Profile       string            // 使用しているプロファイル名（使用していない場合は空）
+	Aliases       map[string]string // 設定ファイルのモデルのエイリアス
+	Files         []string          // 読み込んだ設定ファイル（優先度の低い順）
+	profileSource string            // プロファイルを指定した設定元
+	profiles      []profileLayer    // 設定ファイルに定義されたプロファイル（優先度の低い順）
+	sources       map[string]string // 設定キーごとの設定元
+	aliasSources  map[string]string // エイリアスごとの定義元の設定ファイル
+}
+
+// UserConfigPath は、ユーザーごとの設定ファイルのパスを返す関数です
+func UserConfigPath() (string, error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, userConfigFileName), nil
+}
+
+// FindRepoConfig は、dirから親ディレクトリへ順にリポジトリの設定ファイルを探す関数です
+// Gitリポジトリのルートまで探しても見つからない場合は空文字列を返します
+func FindRepoConfig(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		path := filepath.Join(dir, repoConfigFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadConfig は、ユーザーの設定ファイル、カレントディレクトリのリポジトリの設定ファイル、環境変数を重ねた設定を読み込む関数です
+// 優先度は、組み込みのデフォルト値 < ユーザーの設定 < リポジトリの設定 < 環境変数 の順です
+// プロファイルの設定は、そのプロファイルを定義した設定ファイルの設定より優先します
+// profileには --config-profile で指定されたプロファイル名を渡します（空の場合は環境変数または設定ファイルの指定）
+func LoadConfig(profile string) (*LoadedConfig, error) {
+	var paths []string
+	if path, err := UserConfigPath(); err == nil {
+		paths = append(paths, path)
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if path := FindRepoConfig(wd); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return loadConfig(paths, profile, os.LookupEnv)
+}
+
+// loadConfig は、設定ファイルを順に読み込み、後のファイルの設定で上書きしてから、環境変数を適用する関数です
+// 使用するプロファイルの設定は、各設定ファイルの設定の直後に重ねます
+// 使用するプロファイルは、引数 > 環境変数 > 設定ファイルの profile キー の順に決まります
+// 存在しないファイルは無視します
+func loadConfig(paths []string, profile string, lookupEnv func(string) (string, bool)) (*LoadedConfig, error) {
+	loaded := &LoadedConfig{
+		Settings:     defaultSettings(),
+		sources:      map[string]string{},
+		aliasSources: map[string]string{},
+	}
+	for _, key := range settingKeys {
+		loaded.sources[key.name] = sourceDefault
+	}
+
+	// プロファイルを決めるために、先にすべての設定ファイルを読み込む
+	configs := make([]Config, 0, len(paths))
+	keys := make([]configKeys, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("設定ファイルの読み込みエラー: %v", err)
+		}
+
+		var config Config
+		var present configKeys
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("設定ファイルの解析エラー（%s）: %v", path, err)
+		}
+		if err := yaml.Unmarshal(data, &present); err != nil {
+			return nil, fmt.Errorf("設定ファイルの解析エラー（%s）: %v", path, err)
+		}
+		loaded.Files = append(loaded.Files, path)
+		configs = append(configs, config)
+		keys = append(keys, present)
+
+		if present.has("profile") {
+			loaded.Profile = config.Profile
+			loaded.profileSource = path
+		}
+	}
+	if name, ok := lookupEnv(profileEnv); ok {
+		loaded.Profile = name
+		loaded.profileSource = sourceEnv + " " + profileEnv
+	}
+	if profile != "" {
+		loaded.Profile = profile
+		loaded.profileSource = sourceFlag + " --config-profile"
+	}
+
+	found := false
+	for i, config := range configs {
+		path := loaded.Files[i]
+		if err := loaded.merge(config.Settings, keys[i].Settings, path); err != nil {
+			return nil, err
+		}
+		for _, name := range sortedKeys(config.Profiles) {
+			layer := profileLayer{
+				name:     name,
+				settings: config.Profiles[name],
+				source:   fmt.Sprintf("%s (profiles.%s)", path, name),
+			}
+			loaded.profiles = append(loaded.profiles, layer)
+			if name == loaded.Profile {
+				if err := loaded.merge(layer.settings, keys[i].Profiles[name], layer.source); err != nil {
+					return nil, err
+				}
+				found = true
+			}
+		}
+		for name, model := range config.Aliases {
+			if loaded.Aliases == nil {
+				loaded.Aliases = map[string]string{}
+			}
+			loaded.Aliases[name] = model
+			loaded.aliasSources[name] = path
+		}
+	}
+	if loaded.Profile != "" && !found {
+		return nil, fmt.Errorf("プロファイルが定義されていません: %s（%s）", loaded.Profile, loaded.profileSource)
+	}
+
+	for _, key := range settingKeys {
+		if value, ok := lookupEnv(key.env); ok {
+			if err := loaded.Override(key.name, value, sourceEnv+" "+key.env); err != nil {
+				return nil, fmt.Errorf("環境変数 %s の値が不正です: %v", key.env, err)
+			}
+		}
+	}
+
+	return loaded, nil
+}
+
+// merge は、設定ファイルに記述されている項目のみを上書きし、設定元を記録します
+// presentは、設定ファイルに記述されているキーです（0や空文字列の値も上書きします）
+func (c *LoadedConfig) merge(settings Settings, present map[string]interface{}, source string) error {
+	for _, key := range settingKeys {
+		if _, ok := present[key.name]; !ok {
+			continue
+		}
+		if err := c.Settings.set(key.name, settings.value(key.name)); err != nil {
+			return fmt.Errorf("設定ファイルの値が不正です（%s）: %v", source, err)
+		}
+		c.sources[key.name] = source
+	}
+	return nil
+}
+
+// Override は、設定キーの値を上書きし、設定元を記録します
+// コマンドラインのフラグで指定された値を反映する場合に使用します
+func (c *LoadedConfig) Override(key, value, source string) error {
+	if !isSettingKey(key) {
+		return fmt.Errorf("不明な設定キーです: %s", key)
+	}
+	if err := c.Settings.set(key, value); err != nil {
+		return err
+	}
+	c.sources[key] = source
+	return nil
+}
+
+// OverrideFlag は、コマンドラインのフラグで指定された値で設定キーの値を上書きします
+func (c *LoadedConfig) OverrideFlag(key, flagName, value string) error {
+	return c.Override(key, value, sourceFlag+" --"+flagName)
+}
+
+// Get は、設定キーの値と設定元を返します
+// 設定キーのほかに、profile と aliases.<エイリアス> を指定できます
+func (c *LoadedConfig) Get(key string) (string, string, error) {
+	switch {
+	case key == "profile":
+		return c.Profile, c.profileSource, nil
+	case strings.HasPrefix(key, "aliases."):
+		name := strings.TrimPrefix(key, "aliases.")
+		if target, ok := c.Aliases[name]; ok {
+			return target, c.aliasSources[name], nil
+		}
+		if target, ok := builtinModelAliases[name]; ok {
+			return target, "builtin", nil
+		}
+		return "", "", fmt.Errorf("エイリアスが定義されていません: %s", name)
+	case isSettingKey(key):
+		return c.Settings.value(key), c.sources[key], nil
+	}
+	return "", "", fmt.Errorf("不明な設定キーです: %s", key)
+}
+
+// Entries は、使用しているプロファイルと設定項目の値、設定元を返します
+func (c *LoadedConfig) Entries() []ConfigEntry {
+	entries := []ConfigEntry{{Key: "profile", Value: c.Profile, Source: c.profileSource}}
+	for _, key := range settingKeys {
+		entries = append(entries, ConfigEntry{Key: key.name, Value: c.Settings.value(key.name), Source: c.sources[key.name]})
+	}
+	return entries
+}
+
+// ProfileNames は、設定ファイルに定義されたプロファイル名を名前順に返します
+func (c *LoadedConfig) ProfileNames() []string {
+	names := map[string]bool{}
+	for _, layer := range c.profiles {
+		names[layer.name] = true
+	}
+	return sortedKeys(names)
+}
+
+// ResolveModel は、モデルの指定をモデルIDに解決します
+// 空の場合はデフォルトのモデルを使用し、エイリアスの場合は対応するモデルIDを返します
+// エイリアスでない場合は、モデルIDとしてそのまま返します
+func (c *LoadedConfig) ResolveModel(name string) (string, error) {
+	if name == "" {
+		name = c.DefaultModel
+	}
+	if name == "" {
+		return DefaultModelID, nil
+	}
+
+	for depth := 0; depth < maxAliasDepth; depth++ {
+		target, ok := c.lookupAlias(name)
+		if !ok {
+			return name, nil
+		}
+		name = target
+	}
+	return "", fmt.Errorf("モデルのエイリアスが循環しています: %s", name)
+}
+
+// lookupAlias は、エイリアスに対応するモデルの指定を返します
+// 設定ファイルのエイリアスは組み込みのエイリアスより優先されます
+func (c *LoadedConfig) lookupAlias(name string) (string, bool) {
+	if target, ok := c.Aliases[name]; ok {
+		return target, true
+	}
+	target, ok := builtinModelAliases[name]
+	return target, ok
+}
+
+// ModelAliases は、組み込みと設定ファイルのエイリアスを名前順に返します
+func (c *LoadedConfig) ModelAliases() ([]ModelAlias, error) {
+	names := map[string]bool{}
+	for name := range builtinModelAliases {
+		names[name] = true
+	}
+	for name := range c.Aliases {
+		names[name] = true
+	}
+
+	aliases := make([]ModelAlias, 0, len(names))
+	for name := range names {
+		modelID, err := c.ResolveModel(name)
+		if err != nil {
+			return nil, err
+		}
+		aliases = append(aliases, ModelAlias{Name: name, ModelID: modelID, Source: c.aliasSources[name]})
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	return aliases, nil
+}
+
+// RepoConfigPath は、dirに対応するリポジトリの設定ファイルのパスを返す関数です
+// 設定ファイルがない場合は、Gitリポジトリのルート（リポジトリ外の場合はdir）に作成するパスを返します
+func RepoConfigPath(dir string) (string, error) {
+	if path := FindRepoConfig(dir); path != "" {
+		return path, nil
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", fmt.Errorf("ディレクトリの取得エラー: %v", err)
+	}
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, ".git")); err == nil {
+			return filepath.Join(current, repoConfigFileName), nil
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return filepath.Join(dir, repoConfigFileName), nil
+		}
+		current = parent
+	}
+}
+
+// SetConfigValue は、設定ファイルの設定キーに値を書き込む関数です
+// profileを指定した場合は、そのプロファイルの設定として書き込みます
+// 既存のコメントや他の設定は保持します
+func SetConfigValue(path, profile, key, value string) error {
+	var keys []string
+	switch {
+	case profile != "" && !isSettingKey(key):
+		return fmt.Errorf("プロファイルに設定できないキーです: %s", key)
+	case profile != "":
+		keys = []string{"profiles", profile, key}
+	case key == "profile":
+		keys = []string{key}
+	case strings.HasPrefix(key, "aliases.") && key != "aliases.":
+		keys = []string{"aliases", strings.TrimPrefix(key, "aliases.")}
+	case isSettingKey(key):
+		keys = []string{key}
+	default:
+		return fmt.Errorf("不明な設定キーです: %s", key)
+	}
+
+	// 書き込む前に値を検証する
+	tag := "!!str"
+	if isSettingKey(key) {
+		var settings Settings
+		if err := settings.set(key, value); err != nil {
+			return err
+		}
+		if key == "max_tokens" || key == "max_input_tokens" {
+			tag = "!!int"
+		}
+	}
+
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("設定ファイルの読み込みエラー: %v", err)
+	}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("設定ファイルの解析エラー（%s）: %v", path, err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if err := setYAMLValue(doc.Content[0], keys, &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}); err != nil {
+		return fmt.Errorf("設定ファイルの更新エラー（%s）: %v", path, err)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("設定ファイルの書き込みエラー: %v", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("設定ファイルの書き込みエラー: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("設定ディレクトリの作成エラー: %v", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("設定ファイルの書き込みエラー: %v", err)
+	}
+	return nil
+}
+
+// setYAMLValue は、マッピングのキーをたどって値を設定します
+// 途中のマッピングがない場合は作成します
+func setYAMLValue(mapping *yaml.Node, keys []string, value *yaml.Node) error {
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("マッピングではありません（%d行目）", mapping.Line)
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != keys[0] {
+			continue
+		}
+		if len(keys) == 1 {
+			// 値に付いていたコメントは残す
+			old := mapping.Content[i+1]
+			value.HeadComment, value.LineComment, value.FootComment = old.HeadComment, old.LineComment, old.FootComment
+			mapping.Content[i+1] = value
+			return nil
+		}
+		child := mapping.Content[i+1]
+		if child.Kind == yaml.ScalarNode && child.Tag == "!!null" {
+			*child = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		return setYAMLValue(child, keys[1:], value)
+	}
+
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: keys[0]}
+	if len(keys) == 1 {
+		mapping.Content = append(mapping.Content, keyNode, value)
+		return nil
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mapping.Content = append(mapping.Content, keyNode, child)
+	return setYAMLValue(child, keys[1:], value)
+}
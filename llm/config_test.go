@@ -0,0 +1,364 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// noEnv は、環境変数が設定されていない状態を表します
+func noEnv(string) (string, bool) {
+	return "", false
+}
+
+// envMap は、マップの内容を環境変数として返す関数を作成します
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := env[key]
+		return value, ok
+	}
+}
+
+// writeConfigFile は、テスト用の設定ファイルを作成します
+func writeConfigFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// モデルの指定の解決のテスト
+func TestResolveModel(t *testing.T) {
+	dir := t.TempDir()
+	userConfig := filepath.Join(dir, "user", "config.yaml")
+	repoConfig := filepath.Join(dir, "repo", ".hiracli.yaml")
+	writeConfigFile(t, userConfig, `
+default_model: haiku
+aliases:
+  fast: haiku
+  mine: amazon.titan-text-premier-v1:0
+  loop-a: loop-b
+  loop-b: loop-a
+`)
+	writeConfigFile(t, repoConfig, `
+aliases:
+  mine: meta.llama3-70b-instruct-v1:0
+`)
+
+	testCases := []struct {
+		name        string
+		paths       []string
+		model       string
+		expect      string
+		expectError bool
+	}{
+		{name: "設定ファイルなしのデフォルト", model: "", expect: DefaultModelID},
+		{name: "組み込みのエイリアス", model: "titan", expect: "amazon.titan-text-express-v1"},
+		{name: "モデルID", model: "cohere.command-r-plus-v1:0", expect: "cohere.command-r-plus-v1:0"},
+		{name: "設定ファイルのデフォルト", paths: []string{userConfig}, model: "", expect: "anthropic.claude-3-haiku-20240307-v1:0"},
+		{name: "エイリアスを指すエイリアス", paths: []string{userConfig}, model: "fast", expect: "anthropic.claude-3-haiku-20240307-v1:0"},
+		{name: "ユーザーのエイリアス", paths: []string{userConfig}, model: "mine", expect: "amazon.titan-text-premier-v1:0"},
+		{name: "リポジトリの設定で上書き", paths: []string{userConfig, repoConfig}, model: "mine", expect: "meta.llama3-70b-instruct-v1:0"},
+		{name: "存在しない設定ファイル", paths: []string{filepath.Join(dir, "none.yaml")}, model: "", expect: DefaultModelID},
+		{name: "循環するエイリアス", paths: []string{userConfig}, model: "loop-a", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := loadConfig(tc.paths, "", noEnv)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			actual, err := config.ResolveModel(tc.model)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("エラーが期待されましたが、%s が返されました", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if actual != tc.expect {
+				t.Errorf("モデルIDが期待通りではありません。期待: %s, 実際: %s", tc.expect, actual)
+			}
+		})
+	}
+}
+
+// 設定の優先順位とプロファイルのテスト
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	userConfig := filepath.Join(dir, "user", "config.yaml")
+	repoConfig := filepath.Join(dir, "repo", ".hiracli.yaml")
+	writeConfigFile(t, userConfig, `
+region: ap-northeast-1
+lang: English
+max_tokens: 2000
+profiles:
+  work:
+    aws_profile: work
+    region: us-west-2
+    default_model: haiku
+`)
+	writeConfigFile(t, repoConfig, `
+lang: 日本語
+profiles:
+  work:
+    max_tokens: 4000
+`)
+	modelConfig := filepath.Join(dir, "model", ".hiracli.yaml")
+	writeConfigFile(t, modelConfig, `
+default_model: sonnet
+`)
+	invalidConfig := filepath.Join(dir, "invalid", ".hiracli.yaml")
+	writeConfigFile(t, invalidConfig, `
+tokenizer: unknown
+`)
+	clearConfig := filepath.Join(dir, "clear", ".hiracli.yaml")
+	writeConfigFile(t, clearConfig, `
+region: ""
+max_tokens: 0
+profiles:
+  work:
+    aws_profile: ""
+`)
+
+	testCases := []struct {
+		name          string
+		paths         []string
+		profile       string
+		env           map[string]string
+		expect        map[string]string
+		expectSources map[string]string
+		expectError   bool
+	}{
+		{
+			name:          "組み込みのデフォルト",
+			expect:        map[string]string{"default_model": DefaultModelID, "lang": "日本語", "max_input_tokens": "200000", "model_cache_ttl": "24h", "tokenizer": "cl100k", "region": ""},
+			expectSources: map[string]string{"default_model": "default", "lang": "default"},
+		},
+		{
+			name:          "リポジトリの設定で上書き",
+			paths:         []string{userConfig, repoConfig},
+			expect:        map[string]string{"region": "ap-northeast-1", "lang": "日本語", "max_tokens": "2000"},
+			expectSources: map[string]string{"region": userConfig, "lang": repoConfig},
+		},
+		{
+			name:  "環境変数で指定したプロファイル",
+			paths: []string{userConfig, repoConfig},
+			env:   map[string]string{"HIRACLI_PROFILE": "work"},
+			expect: map[string]string{
+				"profile": "work", "aws_profile": "work", "region": "us-west-2",
+				"default_model": "haiku", "lang": "日本語", "max_tokens": "4000",
+			},
+			expectSources: map[string]string{"profile": "env HIRACLI_PROFILE", "max_tokens": repoConfig + " (profiles.work)"},
+		},
+		{
+			name:          "環境変数はプロファイルより優先",
+			paths:         []string{userConfig},
+			env:           map[string]string{"HIRACLI_PROFILE": "work", "AWS_REGION": "eu-west-1", "HIRACLI_MAX_TOKENS": "500"},
+			expect:        map[string]string{"aws_profile": "work", "region": "eu-west-1", "max_tokens": "500"},
+			expectSources: map[string]string{"region": "env AWS_REGION"},
+		},
+		{
+			name:          "ユーザーの設定のプロファイルよりリポジトリの設定を優先",
+			paths:         []string{userConfig, modelConfig},
+			env:           map[string]string{"HIRACLI_PROFILE": "work"},
+			expect:        map[string]string{"default_model": "sonnet", "region": "us-west-2"},
+			expectSources: map[string]string{"default_model": modelConfig, "region": userConfig + " (profiles.work)"},
+		},
+		{
+			name:          "フラグで指定したプロファイルは環境変数より優先",
+			paths:         []string{userConfig},
+			profile:       "work",
+			env:           map[string]string{"HIRACLI_PROFILE": "home"},
+			expect:        map[string]string{"profile": "work", "aws_profile": "work"},
+			expectSources: map[string]string{"profile": "flag --config-profile"},
+		},
+		{
+			name:          "0や空文字列で上書き",
+			paths:         []string{userConfig, clearConfig},
+			env:           map[string]string{"HIRACLI_PROFILE": "work"},
+			expect:        map[string]string{"region": "", "max_tokens": "", "aws_profile": ""},
+			expectSources: map[string]string{"region": clearConfig, "max_tokens": clearConfig, "aws_profile": clearConfig + " (profiles.work)"},
+		},
+		{
+			name:          "環境変数の0や空文字列で上書き",
+			paths:         []string{userConfig},
+			env:           map[string]string{"AWS_REGION": "", "HIRACLI_MAX_TOKENS": "0"},
+			expect:        map[string]string{"region": "", "max_tokens": ""},
+			expectSources: map[string]string{"region": "env AWS_REGION", "max_tokens": "env HIRACLI_MAX_TOKENS"},
+		},
+		{name: "定義されていないプロファイル", paths: []string{userConfig}, env: map[string]string{"HIRACLI_PROFILE": "home"}, expectError: true},
+		{name: "不正な環境変数の値", env: map[string]string{"HIRACLI_MAX_TOKENS": "many"}, expectError: true},
+		{name: "不正な設定ファイルの値", paths: []string{invalidConfig}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			config, err := loadConfig(tc.paths, tc.profile, envMap(tc.env))
+			if tc.expectError {
+				if err == nil {
+					t.Error("エラーが期待されましたが、発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			for key, expect := range tc.expect {
+				if value, _, err := config.Get(key); err != nil || value != expect {
+					t.Errorf("%s が期待通りではありません。期待: %q, 実際: %q（%v）", key, expect, value, err)
+				}
+			}
+			for key, expect := range tc.expectSources {
+				if _, source, _ := config.Get(key); source != expect {
+					t.Errorf("%s の設定元が期待通りではありません。期待: %q, 実際: %q", key, expect, source)
+				}
+			}
+		})
+	}
+
+	// フラグの値は環境変数より優先
+	config, err := loadConfig([]string{userConfig}, "", envMap(map[string]string{"HIRACLI_LANG": "Français"}))
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if err := config.OverrideFlag("lang", "lang", "English"); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if value, source, _ := config.Get("lang"); value != "English" || source != "flag --lang" {
+		t.Errorf("フラグの値が反映されていません: %q（%s）", value, source)
+	}
+}
+
+// 設定ファイルへの書き込みのテスト
+func TestSetConfigValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hiracli", "config.yaml")
+
+	// 設定ファイルがない場合は作成する
+	if err := SetConfigValue(path, "", "region", "us-east-1"); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	// 既存のコメントを保持する
+	writeConfigFile(t, path, "# 個人の設定\nregion: us-east-1 # 東海岸\nprofiles:\n")
+	steps := []struct {
+		profile string
+		key     string
+		value   string
+	}{
+		{key: "region", value: "ap-northeast-1"},
+		{key: "max_tokens", value: "2048"},
+		{key: "aliases.fast", value: "haiku"},
+		{profile: "work", key: "aws_profile", value: "work"},
+		{profile: "work", key: "lang", value: "on"},
+		{key: "profile", value: "work"},
+	}
+	for _, step := range steps {
+		if err := SetConfigValue(path, step.profile, step.key, step.value); err != nil {
+			t.Fatalf("%s の書き込みで予期せぬエラー: %v", step.key, err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "# 個人の設定") || !strings.Contains(string(data), "# 東海岸") {
+		t.Errorf("コメントが保持されていません:\n%s", data)
+	}
+
+	config, err := loadConfig([]string{path}, "", noEnv)
+	if err != nil {
+		t.Fatalf("書き込んだ設定ファイルの読み込みエラー: %v\n%s", err, data)
+	}
+	expect := map[string]string{
+		"region": "ap-northeast-1", "max_tokens": "2048", "aliases.fast": "haiku",
+		"profile": "work", "aws_profile": "work", "lang": "on",
+	}
+	for key, value := range expect {
+		if actual, _, _ := config.Get(key); actual != value {
+			t.Errorf("%s が期待通りではありません。期待: %q, 実際: %q", key, value, actual)
+		}
+	}
+
+	// 不正なキーと値
+	invalid := []struct {
+		profile string
+		key     string
+		value   string
+	}{
+		{key: "unknown", value: "x"},
+		{key: "max_tokens", value: "-1"},
+		{key: "model_cache_ttl", value: "soon"},
+		{key: "tokenizer", value: "claude"},
+		{key: "assume_role_arn", value: "BedrockRole"},
+		{profile: "work", key: "aliases.fast", value: "haiku"},
+	}
+	for _, tc := range invalid {
+		if err := SetConfigValue(path, tc.profile, tc.key, tc.value); err == nil {
+			t.Errorf("%s=%s でエラーが期待されましたが、発生しませんでした", tc.key, tc.value)
+		}
+	}
+}
+
+// エイリアスの一覧のテスト
+func TestModelAliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfigFile(t, path, "aliases:\n  sonnet: sonnet-v2\n  mine: amazon.titan-text-premier-v1:0\n")
+
+	config, err := loadConfig([]string{path}, "", noEnv)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	aliases, err := config.ModelAliases()
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	found := map[string]ModelAlias{}
+	for _, alias := range aliases {
+		found[alias.Name] = alias
+	}
+	if len(found) != len(builtinModelAliases)+1 {
+		t.Errorf("エイリアスの件数が期待通りではありません: %d", len(found))
+	}
+	if alias := found["sonnet"]; alias.ModelID != builtinModelAliases["sonnet-v2"] || alias.Source != path {
+		t.Errorf("上書きしたエイリアスが期待通りではありません: %+v", alias)
+	}
+	if alias := found["haiku"]; alias.Source != "" {
+		t.Errorf("組み込みのエイリアスの定義元が期待通りではありません: %+v", alias)
+	}
+}
+
+// リポジトリの設定ファイルの検索のテスト
+func TestFindRepoConfig(t *testing.T) {
+	root := t.TempDir()
+	repo := filepath.Join(root, "repo")
+	sub := filepath.Join(repo, "cmd", "app")
+	if err := os.MkdirAll(sub, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(repo, ".git"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// リポジトリの外にある設定ファイルは使用しない
+	writeConfigFile(t, filepath.Join(root, ".hiracli.yaml"), "default_model: titan\n")
+	if path := FindRepoConfig(sub); path != "" {
+		t.Errorf("リポジトリの外の設定ファイルが見つかりました: %s", path)
+	}
+
+	writeConfigFile(t, filepath.Join(repo, ".hiracli.yaml"), "default_model: haiku\n")
+	if path := FindRepoConfig(sub); path != filepath.Join(repo, ".hiracli.yaml") {
+		t.Errorf("リポジトリの設定ファイルが見つかりません: %s", path)
+	}
+}
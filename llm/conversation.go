@@ -0,0 +1,123 @@
+package llm
+
+import (
+	"strings"
+)
+
+// モデルIDのプレフィックスごとのコンテキストウィンドウ（トークン数）の目安
+var contextWindows = map[string]int{
+	"anthropic.":                200000,
+	"anthropic.claude-instant":  100000,
+	"amazon.titan-text":         8000,
+	"amazon.titan-text-lite":    4000,
+	"amazon.titan-text-premier": 32000,
+	"meta.llama":                8000,
+	"meta.llama3-1":             128000,
+	"meta.llama3-2":             128000,
+	"meta.llama3-3":             128000,
+	"mistral.":                  32000,
+	"mistral.mistral-large":     128000,
+	"cohere.command":            4000,
+	"cohere.command-r":          128000,
+	"ai21.j2":                   8000,
+	"ai21.jamba":                256000,
+}
+
+// コンテキストウィンドウが不明なモデルに使用するデフォルト値
+const defaultContextWindow = 8000
+
+// ContextWindow は、モデルIDに対応するコンテキストウィンドウのトークン数を返す関数です
+// 複数のプレフィックスに一致する場合は、最も長いプレフィックスを優先します
+// クロスリージョン推論プロファイルのIDは、元のモデルIDで検索します
+func ContextWindow(modelID string) int {
+	modelID = BaseModelID(modelID)
+
+	var matched string
+	for prefix := range contextWindows {
+		if strings.HasPrefix(modelID, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+
+	if matched == "" {
+		return defaultContextWindow
+	}
+
+	return contextWindows[matched]
+}
+
+// Conversation は、対話モードでの会話履歴を管理する構造体です
+type Conversation struct {
+	Messages []Message
+}
+
+// AddUser は、ユーザーの入力を会話履歴に追加します
+func (c *Conversation) AddUser(content string) {
+	c.Messages = append(c.Messages, Message{Role: RoleUser, Content: content})
+}
+
+// AddUserWithAttachments は、添付ファイルを含むユーザーの入力を会話履歴に追加します
+// 添付ファイルは入力のテキストより前に配置します
+func (c *Conversation) AddUserWithAttachments(content string, attachments []ContentBlock) {
+	if len(attachments) == 0 {
+		c.AddUser(content)
+		return
+	}
+	blocks := append(append([]ContentBlock{}, attachments...), TextBlock(content))
+	c.Messages = append(c.Messages, NewMessage(RoleUser, blocks...))
+}
+
+// AddAssistant は、モデルの回答を会話履歴に追加します
+func (c *Conversation) AddAssistant(content string) {
+	c.Messages = append(c.Messages, Message{Role: RoleAssistant, Content: content})
+}
+
+// Reset は、会話履歴をすべて削除します
+func (c *Conversation) Reset() {
+	c.Messages = nil
+}
+
+// Undo は、最後のやり取り（ユーザーの入力とそれに対する回答）を削除します
+// 削除するやり取りがない場合はfalseを返します
+func (c *Conversation) Undo() bool {
+	if len(c.Messages) == 0 {
+		return false
+	}
+
+	// 末尾の回答を削除
+	if c.Messages[len(c.Messages)-1].Role == RoleAssistant {
+		c.Messages = c.Messages[:len(c.Messages)-1]
+	}
+
+	// 対応するユーザーの入力を削除
+	if len(c.Messages) > 0 && c.Messages[len(c.Messages)-1].Role == RoleUser {
+		c.Messages = c.Messages[:len(c.Messages)-1]
+	}
+
+	return true
+}
+
+// EstimatedTokens は、会話履歴全体の推定トークン数を返します
+func (c *Conversation) EstimatedTokens() int {
+	tokens := 0
+	for _, message := range c.Messages {
+		tokens += estimateTokens(message.Content)
+	}
+	return tokens
+}
+
+// Trim は、推定トークン数が上限を超えている間、古いやり取りから順に削除します
+// 最後のユーザー入力は常に残します。削除したメッセージ数を返します
+func (c *Conversation) Trim(maxTokens int) int {
+	removed := 0
+	for c.EstimatedTokens() > maxTokens && len(c.Messages) > 1 {
+		// ユーザーの入力とそれに対する回答をまとめて削除する
+		n := 1
+		if len(c.Messages) > 2 && c.Messages[1].Role == RoleAssistant {
+			n = 2
+		}
+		c.Messages = c.Messages[n:]
+		removed += n
+	}
+	return removed
+}
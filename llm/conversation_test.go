@@ -0,0 +1,109 @@
+package llm
+
+import (
+	"strings"
+	"testing"
+)
+
+// Conversationの追加・取り消し・リセットのテスト
+func TestConversation(t *testing.T) {
+	var conversation Conversation
+
+	if conversation.Undo() {
+		t.Errorf("空の会話履歴の取り消しはfalseを返すべきです")
+	}
+
+	conversation.AddUser("質問1")
+	conversation.AddAssistant("回答1")
+	conversation.AddUser("質問2")
+	conversation.AddAssistant("回答2")
+
+	if len(conversation.Messages) != 4 {
+		t.Fatalf("メッセージ数が期待通りではありません。期待: 4, 実際: %d", len(conversation.Messages))
+	}
+
+	// 最後のやり取りを取り消す
+	if !conversation.Undo() {
+		t.Fatalf("取り消しに失敗しました")
+	}
+	if len(conversation.Messages) != 2 || conversation.Messages[1].Content != "回答1" {
+		t.Errorf("取り消し後の会話履歴が期待通りではありません: %+v", conversation.Messages)
+	}
+
+	// 回答がまだないユーザー入力のみの取り消し
+	conversation.AddUser("質問3")
+	conversation.Undo()
+	if len(conversation.Messages) != 2 {
+		t.Errorf("回答のない入力の取り消し後の会話履歴が期待通りではありません: %+v", conversation.Messages)
+	}
+
+	conversation.Reset()
+	if len(conversation.Messages) != 0 {
+		t.Errorf("リセット後に会話履歴が残っています: %+v", conversation.Messages)
+	}
+}
+
+// Conversationのトリミングのテスト
+func TestConversationTrim(t *testing.T) {
+	var conversation Conversation
+	long := strings.Repeat("word ", 100)
+
+	for i := 0; i < 5; i++ {
+		conversation.AddUser(long)
+		conversation.AddAssistant(long)
+	}
+	conversation.AddUser("最後の質問")
+
+	// 上限内であれば削除しない
+	if removed := conversation.Trim(1000000); removed != 0 {
+		t.Errorf("上限内の会話履歴が削除されました: %d 件", removed)
+	}
+
+	budget := estimateTokens(long)*4 + estimateTokens("最後の質問")
+	removed := conversation.Trim(budget)
+	if removed == 0 {
+		t.Fatalf("上限を超えた会話履歴が削除されていません")
+	}
+	if removed%2 != 0 {
+		t.Errorf("やり取り単位で削除されていません: %d 件", removed)
+	}
+	if conversation.EstimatedTokens() > budget {
+		t.Errorf("トリミング後も上限を超えています: %d > %d", conversation.EstimatedTokens(), budget)
+	}
+
+	// 先頭はユーザー入力、末尾は最後の質問のまま
+	if conversation.Messages[0].Role != RoleUser {
+		t.Errorf("トリミング後の先頭メッセージがユーザー入力ではありません: %+v", conversation.Messages[0])
+	}
+	if last := conversation.Messages[len(conversation.Messages)-1]; last.Content != "最後の質問" {
+		t.Errorf("最後の質問が削除されました: %+v", last)
+	}
+
+	// 上限が極端に小さくても最後のユーザー入力は残す
+	conversation.Trim(0)
+	if len(conversation.Messages) != 1 || conversation.Messages[0].Content != "最後の質問" {
+		t.Errorf("最後のユーザー入力が残っていません: %+v", conversation.Messages)
+	}
+}
+
+// ContextWindowのテスト
+func TestContextWindow(t *testing.T) {
+	testCases := []struct {
+		modelID  string
+		expected int
+	}{
+		{"anthropic.claude-3-5-sonnet-20240620-v1:0", 200000},
+		{"anthropic.claude-instant-v1", 100000},
+		{"amazon.titan-text-express-v1", 8000},
+		{"meta.llama3-1-70b-instruct-v1:0", 128000},
+		{"cohere.command-r-plus-v1:0", 128000},
+		{"us.meta.llama3-1-70b-instruct-v1:0", 128000},
+		{"unknown.model-v1", defaultContextWindow},
+	}
+
+	for _, tc := range testCases {
+		if actual := ContextWindow(tc.modelID); actual != tc.expected {
+			t.Errorf("%s のコンテキストウィンドウが期待通りではありません。期待: %d, 実際: %d", tc.modelID, tc.expected, actual)
+		}
+	}
+}
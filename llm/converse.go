@@ -0,0 +1,295 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+	"github.com/aws/smithy-go"
+)
+
+// モデルの呼び出しに使用するAPI
+const (
+	APIInvoke   = "invoke"   // モデルファミリーごとのJSONを送信するInvokeModel
+	APIConverse = "converse" // モデルに依存しないメッセージ形式のConverse
+)
+
+// ValidateAPI は、APIの指定が有効かを検証する関数です
+func ValidateAPI(api string) error {
+	switch api {
+	case "", APIInvoke, APIConverse:
+		return nil
+	}
+	return fmt.Errorf("不明なAPIです: %s（%s または %s を指定してください）", api, APIInvoke, APIConverse)
+}
+
+// buildConverseInput は、共通のリクエスト内容からConverseの入力を構築する関数です
+// baseModelIDは、送信するパラメータの判定に使用する元の基盤モデルのIDです
+func buildConverseInput(modelID, baseModelID string, req ModelRequest) (*bedrockruntime.ConverseInput, error) {
+	messages := make([]types.Message, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		var content []types.ContentBlock
+		for _, block := range message.ContentBlocks() {
+			converted, err := toConverseContentBlock(block)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, converted)
+		}
+		messages = append(messages, types.Message{
+			Role:    types.ConversationRole(message.Role),
+			Content: content,
+		})
+	}
+
+	input := &bedrockruntime.ConverseInput{
+		ModelId:         aws.String(modelID),
+		Messages:        messages,
+		InferenceConfig: converseInferenceConfig(req.Params),
+	}
+	if req.System != "" {
+		input.System = []types.SystemContentBlock{&types.SystemContentBlockMemberText{Value: req.System}}
+	}
+
+	if len(req.Tools) > 0 {
+		input.ToolConfig = converseToolConfig(req.Tools)
+	}
+
+	// top-kはConverseの共通パラメータにないため、対応しているモデルにのみ個別に送信する
+	// 推論プロファイルのIDやARNは、元のモデルIDで判定する
+	if req.Params.TopK != nil && strings.HasPrefix(baseModelID, "anthropic.") {
+		input.AdditionalModelRequestFields = document.NewLazyDocument(map[string]interface{}{"top_k": *req.Params.TopK})
+	}
+
+	return input, nil
+}
+
+// converseToolConfig は、ツールの定義をConverseの形式に変換する関数です
+func converseToolConfig(tools []Tool) *types.ToolConfiguration {
+	config := &types.ToolConfiguration{}
+	for _, tool := range tools {
+		config.Tools = append(config.Tools, &types.ToolMemberToolSpec{Value: types.ToolSpecification{
+			Name:        aws.String(tool.Name),
+			Description: aws.String(tool.Description),
+			InputSchema: &types.ToolInputSchemaMemberJson{Value: document.NewLazyDocument(tool.InputSchema)},
+		}})
+	}
+	return config
+}
+
+// converseInferenceConfig は、推論パラメータをConverseの形式に変換する関数です
+func converseInferenceConfig(params InferenceParams) *types.InferenceConfiguration {
+	config := &types.InferenceConfiguration{
+		MaxTokens:     aws.Int32(int32(maxTokensOrDefault(params.MaxTokens))),
+		StopSequences: params.StopSequences,
+	}
+	if params.Temperature != nil {
+		config.Temperature = aws.Float32(float32(*params.Temperature))
+	}
+	if params.TopP != nil {
+		config.TopP = aws.Float32(float32(*params.TopP))
+	}
+	return config
+}
+
+// toConverseContentBlock は、コンテンツブロックをConverseの形式に変換する関数です
+func toConverseContentBlock(block ContentBlock) (types.ContentBlock, error) {
+	switch block.Type {
+	case BlockText:
+		return &types.ContentBlockMemberText{Value: block.Text}, nil
+	case BlockImage:
+		return &types.ContentBlockMemberImage{Value: types.ImageBlock{
+			Format: types.ImageFormat(block.Format),
+			Source: &types.ImageSourceMemberBytes{Value: block.Data},
+		}}, nil
+	case BlockDocument:
+		return &types.ContentBlockMemberDocument{Value: types.DocumentBlock{
+			Format: types.DocumentFormat(block.Format),
+			Name:   aws.String(block.Name),
+			Source: &types.DocumentSourceMemberBytes{Value: block.Data},
+		}}, nil
+	case BlockToolUse:
+		var input interface{}
+		if len(block.Input) > 0 {
+			if err := json.Unmarshal(block.Input, &input); err != nil {
+				return nil, fmt.Errorf("ツール入力の解析エラー: %v", err)
+			}
+		}
+		return &types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+			ToolUseId: aws.String(block.ToolUseID),
+			Name:      aws.String(block.Name),
+			Input:     document.NewLazyDocument(input),
+		}}, nil
+	case BlockToolResult:
+		status := types.ToolResultStatusSuccess
+		if block.IsError {
+			status = types.ToolResultStatusError
+		}
+		return &types.ContentBlockMemberToolResult{Value: types.ToolResultBlock{
+			ToolUseId: aws.String(block.ToolUseID),
+			Content:   []types.ToolResultContentBlock{&types.ToolResultContentBlockMemberText{Value: block.Text}},
+			Status:    status,
+		}}, nil
+	}
+	return nil, fmt.Errorf("未対応のコンテンツブロックです: %s", block.Type)
+}
+
+// fromConverseContentBlocks は、Converseのコンテンツブロックから回答テキストとテキスト以外のブロックを取り出す関数です
+func fromConverseContentBlocks(content []types.ContentBlock) (string, []ContentBlock, error) {
+	var text strings.Builder
+	var blocks []ContentBlock
+	for _, block := range content {
+		switch b := block.(type) {
+		case *types.ContentBlockMemberText:
+			text.WriteString(b.Value)
+		case *types.ContentBlockMemberToolUse:
+			var input json.RawMessage
+			if b.Value.Input != nil {
+				data, err := b.Value.Input.MarshalSmithyDocument()
+				if err != nil {
+					return "", nil, fmt.Errorf("ツール入力の解析エラー: %v", err)
+				}
+				input = data
+			}
+			blocks = append(blocks, ToolUseBlock(aws.ToString(b.Value.ToolUseId), aws.ToString(b.Value.Name), input))
+		}
+	}
+	return text.String(), blocks, nil
+}
+
+// parseConverseOutput は、Converseの出力から共通のレスポンス内容を取り出す関数です
+func parseConverseOutput(output *bedrockruntime.ConverseOutput) (*ModelResponse, error) {
+	message, ok := output.Output.(*types.ConverseOutputMemberMessage)
+	if !ok {
+		return nil, fmt.Errorf("レスポンスにメッセージが含まれていません")
+	}
+
+	text, blocks, err := fromConverseContentBlocks(message.Value.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	response := &ModelResponse{
+		Text:       text,
+		Blocks:     blocks,
+		StopReason: string(output.StopReason),
+		Truncated:  output.StopReason == types.StopReasonMaxTokens,
+	}
+	if output.Usage != nil {
+		response.Usage = Usage{
+			InputTokens:  int(aws.ToInt32(output.Usage.InputTokens)),
+			OutputTokens: int(aws.ToInt32(output.Usage.OutputTokens)),
+		}
+	}
+	return response, nil
+}
+
+// streamingToolUse は、ストリーミング中に受信しているツール呼び出しを保持する構造体です
+type streamingToolUse struct {
+	id    string
+	name  string
+	input strings.Builder
+}
+
+// readConverseStream は、ConverseStreamのイベントストリームを読み取り、
+// 回答の差分を受信するたびに出力先へ書き出す関数です
+// 戻り値のModelResponseには、途中でエラーになった場合もそれまでに受信した回答が含まれます
+func readConverseStream(ctx context.Context, stream bedrockruntime.ConverseStreamOutputReader, out io.Writer) (*ModelResponse, error) {
+	defer stream.Close()
+
+	var answer strings.Builder
+	var usage Usage
+	var stopReason types.StopReason
+	toolUses := map[int32]*streamingToolUse{}
+	events := stream.Events()
+
+	// result は、ここまでに受信した内容をModelResponseにまとめる
+	result := func() *ModelResponse {
+		// ツール呼び出しはコンテンツブロックの順序で返す
+		indexes := make([]int32, 0, len(toolUses))
+		for index := range toolUses {
+			indexes = append(indexes, index)
+		}
+		sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+
+		var blocks []ContentBlock
+		for _, index := range indexes {
+			toolUse := toolUses[index]
+			input := json.RawMessage(toolUse.input.String())
+			if len(input) == 0 {
+				input = json.RawMessage("{}")
+			}
+			blocks = append(blocks, ToolUseBlock(toolUse.id, toolUse.name, input))
+		}
+
+		return &ModelResponse{
+			Text:       answer.String(),
+			Blocks:     blocks,
+			Usage:      usage,
+			StopReason: string(stopReason),
+			Truncated:  stopReason == types.StopReasonMaxTokens,
+		}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return result(), fmt.Errorf("ストリーミングを中断しました: %w", ctx.Err())
+		case event, ok := <-events:
+			if !ok {
+				// ストリームの終了時に受信エラーがないか確認
+				if err := stream.Err(); err != nil {
+					return result(), fmt.Errorf("ストリーミング中のエラー: %w", err)
+				}
+				return result(), nil
+			}
+
+			switch e := event.(type) {
+			case *types.ConverseStreamOutputMemberContentBlockStart:
+				if start, ok := e.Value.Start.(*types.ContentBlockStartMemberToolUse); ok {
+					toolUses[aws.ToInt32(e.Value.ContentBlockIndex)] = &streamingToolUse{
+						id:   aws.ToString(start.Value.ToolUseId),
+						name: aws.ToString(start.Value.Name),
+					}
+				}
+			case *types.ConverseStreamOutputMemberContentBlockDelta:
+				switch delta := e.Value.Delta.(type) {
+				case *types.ContentBlockDeltaMemberText:
+					answer.WriteString(delta.Value)
+					fmt.Fprint(out, delta.Value)
+				case *types.ContentBlockDeltaMemberToolUse:
+					if toolUse, ok := toolUses[aws.ToInt32(e.Value.ContentBlockIndex)]; ok {
+						toolUse.input.WriteString(aws.ToString(delta.Value.Input))
+					}
+				}
+			case *types.ConverseStreamOutputMemberMessageStop:
+				stopReason = e.Value.StopReason
+			case *types.ConverseStreamOutputMemberMetadata:
+				if e.Value.Usage != nil {
+					usage = Usage{
+						InputTokens:  int(aws.ToInt32(e.Value.Usage.InputTokens)),
+						OutputTokens: int(aws.ToInt32(e.Value.Usage.OutputTokens)),
+					}
+				}
+			}
+		}
+	}
+}
+
+// isConverseUnsupported は、モデルがConverse APIやその機能に対応していないことを示すエラーかを返す関数です
+func isConverseUnsupported(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "ValidationException" {
+		return false
+	}
+	message := strings.ToLower(apiErr.ErrorMessage())
+	return strings.Contains(message, "doesn't support") || strings.Contains(message, "does not support") || strings.Contains(message, "not supported")
+}
@@ -0,0 +1,250 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// モックのConverseStreamのイベントストリーム
+type MockConverseStreamReader struct {
+	events chan types.ConverseStreamOutput
+	err    error // ストリームの終了時に返す受信エラー
+}
+
+// イベントを順に送信するモックのイベントストリームを作成
+func newMockConverseStreamReader(events []types.ConverseStreamOutput) *MockConverseStreamReader {
+	ch := make(chan types.ConverseStreamOutput, len(events))
+	for _, event := range events {
+		ch <- event
+	}
+	close(ch)
+	return &MockConverseStreamReader{events: ch}
+}
+
+func (m *MockConverseStreamReader) Events() <-chan types.ConverseStreamOutput {
+	return m.events
+}
+
+func (m *MockConverseStreamReader) Close() error {
+	return nil
+}
+
+func (m *MockConverseStreamReader) Err() error {
+	return m.err
+}
+
+// 共通のリクエスト内容からConverseの入力を構築するテスト
+func TestBuildConverseInput(t *testing.T) {
+	temperature := 0.3
+	topK := 50
+	req := ModelRequest{
+		System: "システムプロンプト",
+		Messages: []Message{
+			NewMessage(RoleUser, TextBlock("この画像は？"), ImageBlock("png", []byte("image")), DocumentBlock("spec", "pdf", []byte("pdf"))),
+			NewMessage(RoleAssistant, ToolUseBlock("tool-1", "read_file", json.RawMessage(`{"path":"main.go"}`))),
+			NewMessage(RoleUser, ToolResultBlock("tool-1", "package main", false)),
+		},
+		Params: InferenceParams{MaxTokens: 2048, Temperature: &temperature, TopK: &topK, StopSequences: []string{"END"}},
+	}
+
+	input, err := buildConverseInput("anthropic.claude-3-5-sonnet-20240620-v1:0", BaseModelID("anthropic.claude-3-5-sonnet-20240620-v1:0"), req)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if aws.ToString(input.ModelId) != "anthropic.claude-3-5-sonnet-20240620-v1:0" {
+		t.Errorf("モデルIDが期待通りではありません: %s", aws.ToString(input.ModelId))
+	}
+	if len(input.System) != 1 {
+		t.Errorf("システムプロンプトが設定されていません: %+v", input.System)
+	}
+	if aws.ToInt32(input.InferenceConfig.MaxTokens) != 2048 || aws.ToFloat32(input.InferenceConfig.Temperature) != 0.3 || input.InferenceConfig.TopP != nil {
+		t.Errorf("推論パラメータが期待通りではありません: %+v", input.InferenceConfig)
+	}
+	if input.AdditionalModelRequestFields == nil {
+		t.Error("top-kが追加のリクエストフィールドに設定されていません")
+	}
+
+	if len(input.Messages) != 3 {
+		t.Fatalf("メッセージ数が期待通りではありません: %d", len(input.Messages))
+	}
+
+	first := input.Messages[0]
+	if first.Role != types.ConversationRoleUser || len(first.Content) != 3 {
+		t.Fatalf("1番目のメッセージが期待通りではありません: %+v", first)
+	}
+	if _, ok := first.Content[0].(*types.ContentBlockMemberText); !ok {
+		t.Errorf("テキストブロックが変換されていません: %T", first.Content[0])
+	}
+	if image, ok := first.Content[1].(*types.ContentBlockMemberImage); !ok || image.Value.Format != types.ImageFormatPng {
+		t.Errorf("画像ブロックが変換されていません: %T", first.Content[1])
+	}
+	if doc, ok := first.Content[2].(*types.ContentBlockMemberDocument); !ok || aws.ToString(doc.Value.Name) != "spec" {
+		t.Errorf("ドキュメントブロックが変換されていません: %T", first.Content[2])
+	}
+
+	toolUse, ok := input.Messages[1].Content[0].(*types.ContentBlockMemberToolUse)
+	if !ok || aws.ToString(toolUse.Value.Name) != "read_file" {
+		t.Errorf("ツール呼び出しブロックが変換されていません: %T", input.Messages[1].Content[0])
+	}
+
+	toolResult, ok := input.Messages[2].Content[0].(*types.ContentBlockMemberToolResult)
+	if !ok || aws.ToString(toolResult.Value.ToolUseId) != "tool-1" || toolResult.Value.Status != types.ToolResultStatusSuccess {
+		t.Errorf("ツール実行結果ブロックが変換されていません: %+v", input.Messages[2].Content[0])
+	}
+
+	// クロスリージョン推論プロファイルのIDでも元のモデルで判定すること
+	input, err = buildConverseInput("us.anthropic.claude-3-5-sonnet-20240620-v1:0", BaseModelID("us.anthropic.claude-3-5-sonnet-20240620-v1:0"), req)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if input.AdditionalModelRequestFields == nil {
+		t.Error("推論プロファイルのIDでtop-kが追加のリクエストフィールドに設定されていません")
+	}
+
+	// top-kに対応していないモデルには送信しないこと
+	input, err = buildConverseInput("meta.llama3-8b-instruct-v1:0", BaseModelID("meta.llama3-8b-instruct-v1:0"), req)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if input.AdditionalModelRequestFields != nil {
+		t.Error("top-kに対応していないモデルに追加のリクエストフィールドが設定されています")
+	}
+}
+
+// Converseの出力の解析のテスト
+func TestParseConverseOutput(t *testing.T) {
+	output := &bedrockruntime.ConverseOutput{
+		Output: &types.ConverseOutputMemberMessage{Value: types.Message{
+			Role: types.ConversationRoleAssistant,
+			Content: []types.ContentBlock{
+				&types.ContentBlockMemberText{Value: "ファイルを読みます"},
+				&types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+					ToolUseId: aws.String("tool-1"),
+					Name:      aws.String("read_file"),
+					Input:     document.NewLazyDocument(map[string]interface{}{"path": "main.go"}),
+				}},
+			},
+		}},
+		StopReason: types.StopReasonToolUse,
+		Usage:      &types.TokenUsage{InputTokens: aws.Int32(100), OutputTokens: aws.Int32(20)},
+	}
+
+	response, err := parseConverseOutput(output)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if response.Text != "ファイルを読みます" {
+		t.Errorf("回答が期待通りではありません: %s", response.Text)
+	}
+	if response.Usage.InputTokens != 100 || response.Usage.OutputTokens != 20 {
+		t.Errorf("トークン数が期待通りではありません: %+v", response.Usage)
+	}
+	if response.StopReason != "tool_use" || response.Truncated {
+		t.Errorf("終了理由が期待通りではありません: %s", response.StopReason)
+	}
+	if len(response.Blocks) != 1 || response.Blocks[0].Name != "read_file" || string(response.Blocks[0].Input) != `{"path":"main.go"}` {
+		t.Errorf("ツール呼び出しが期待通りではありません: %+v", response.Blocks)
+	}
+}
+
+// ConverseStreamのイベントストリームの読み取りのテスト
+func TestReadConverseStream(t *testing.T) {
+	stream := newMockConverseStreamReader([]types.ConverseStreamOutput{
+		&types.ConverseStreamOutputMemberMessageStart{Value: types.MessageStartEvent{Role: types.ConversationRoleAssistant}},
+		&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+			ContentBlockIndex: aws.Int32(0),
+			Delta:             &types.ContentBlockDeltaMemberText{Value: "こんにちは、"},
+		}},
+		&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+			ContentBlockIndex: aws.Int32(0),
+			Delta:             &types.ContentBlockDeltaMemberText{Value: "Converseです"},
+		}},
+		&types.ConverseStreamOutputMemberContentBlockStart{Value: types.ContentBlockStartEvent{
+			ContentBlockIndex: aws.Int32(1),
+			Start:             &types.ContentBlockStartMemberToolUse{Value: types.ToolUseBlockStart{ToolUseId: aws.String("tool-1"), Name: aws.String("read_file")}},
+		}},
+		&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+			ContentBlockIndex: aws.Int32(1),
+			Delta:             &types.ContentBlockDeltaMemberToolUse{Value: types.ToolUseBlockDelta{Input: aws.String(`{"path":`)}},
+		}},
+		&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+			ContentBlockIndex: aws.Int32(1),
+			Delta:             &types.ContentBlockDeltaMemberToolUse{Value: types.ToolUseBlockDelta{Input: aws.String(`"main.go"}`)}},
+		}},
+		&types.ConverseStreamOutputMemberMessageStop{Value: types.MessageStopEvent{StopReason: types.StopReasonMaxTokens}},
+		&types.ConverseStreamOutputMemberMetadata{Value: types.ConverseStreamMetadataEvent{
+			Usage: &types.TokenUsage{InputTokens: aws.Int32(10), OutputTokens: aws.Int32(5)},
+		}},
+	})
+
+	var out bytes.Buffer
+	response, err := readConverseStream(context.Background(), stream, &out)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if out.String() != "こんにちは、Converseです" || response.Text != "こんにちは、Converseです" {
+		t.Errorf("回答が期待通りではありません。出力: %s, 回答: %s", out.String(), response.Text)
+	}
+	if response.Usage.InputTokens != 10 || response.Usage.OutputTokens != 5 {
+		t.Errorf("トークン数が期待通りではありません: %+v", response.Usage)
+	}
+	if !response.Truncated {
+		t.Error("回答が途切れたことが検出されていません")
+	}
+	if len(response.Blocks) != 1 || string(response.Blocks[0].Input) != `{"path":"main.go"}` {
+		t.Errorf("ツール呼び出しが期待通りではありません: %+v", response.Blocks)
+	}
+}
+
+// ConverseStreamの受信中にエラーが発生した場合のテスト
+func TestReadConverseStreamError(t *testing.T) {
+	stream := newMockConverseStreamReader([]types.ConverseStreamOutput{
+		&types.ConverseStreamOutputMemberContentBlockDelta{Value: types.ContentBlockDeltaEvent{
+			ContentBlockIndex: aws.Int32(0),
+			Delta:             &types.ContentBlockDeltaMemberText{Value: "途中まで"},
+		}},
+	})
+	stream.err = &types.ThrottlingException{Message: aws.String("rate exceeded")}
+
+	response, err := readConverseStream(context.Background(), stream, io.Discard)
+	if err == nil {
+		t.Fatal("エラーが期待されましたが、発生しませんでした")
+	}
+	// 再試行の判定のため、元のエラーを参照できる
+	if !isRetryableError(err) {
+		t.Errorf("受信エラーが再試行の対象として判定されていません: %v", err)
+	}
+	if response.Text != "途中まで" {
+		t.Errorf("受信済みの回答が保持されていません: %s", response.Text)
+	}
+}
+
+// コンテンツブロックからのメッセージ作成のテスト
+func TestNewMessage(t *testing.T) {
+	text := NewMessage(RoleUser, TextBlock("こんにちは"), TextBlock("、世界"))
+	if text.Content != "こんにちは、世界" || text.Blocks != nil || text.HasNonText() {
+		t.Errorf("テキストのみのメッセージが期待通りではありません: %+v", text)
+	}
+	if blocks := text.ContentBlocks(); len(blocks) != 1 || blocks[0].Text != "こんにちは、世界" {
+		t.Errorf("テキストのみのメッセージのブロックが期待通りではありません: %+v", blocks)
+	}
+
+	image := NewMessage(RoleUser, TextBlock("この画像は？"), ImageBlock("png", []byte("image")))
+	if image.Content != "この画像は？" || len(image.Blocks) != 2 || !image.HasNonText() {
+		t.Errorf("画像を含むメッセージが期待通りではありません: %+v", image)
+	}
+
+	if blocks := (Message{Role: RoleUser}).ContentBlocks(); blocks != nil {
+		t.Errorf("空のメッセージにブロックがあります: %+v", blocks)
+	}
+}
@@ -0,0 +1,173 @@
+package llm
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// globPattern は、--include と --exclude に指定するglobパターンを定義する構造体です
+// / を含まないパターンはファイル名に、含むパターンはベースディレクトリからの相対パスに一致します
+// 末尾が / のパターンはディレクトリに一致し、そのディレクトリ以下のファイルを対象にします
+type globPattern struct {
+	segments []string // パターンを / で分割したもの
+	anchored bool     // / を含むパターン（末尾の / を除く）
+	dirOnly  bool     // 末尾が / のパターン
+}
+
+// fileFilter は、flatten-srcで対象にするファイルを選択する、コンパイル済みの条件です
+type fileFilter struct {
+	pattern    *regexp.Regexp   // --pattern の正規表現（ファイルの絶対パスに一致）
+	extensions []*regexp.Regexp // --extension のワイルドカード（ファイル名に一致、いずれか）
+	includes   []globPattern    // --include のglobパターン（いずれか）
+	excludes   []globPattern    // --exclude と ! で始まる --include のglobパターン
+}
+
+// newFileFilter は、オプションの条件をコンパイルしてfileFilterを作成する関数です
+func newFileFilter(opts FlattenOptions) (*fileFilter, error) {
+	pattern, err := regexp.Compile(opts.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("正規表現パターンのコンパイルエラー: %v", err)
+	}
+	filter := &fileFilter{pattern: pattern}
+
+	// 拡張子はカンマ区切りで複数指定できる（例: *.go,*.md）
+	for _, ext := range strings.Split(opts.Extension, ",") {
+		ext = strings.TrimSpace(ext)
+		if ext == "" {
+			continue
+		}
+		extRe, err := regexp.Compile(convertWildcardToRegexp(ext))
+		if err != nil {
+			return nil, fmt.Errorf("拡張子パターンのコンパイルエラー（%s）: %v", ext, err)
+		}
+		filter.extensions = append(filter.extensions, extRe)
+	}
+
+	for _, include := range opts.Includes {
+		if exclude, ok := strings.CutPrefix(include, "!"); ok {
+			glob, err := compileGlob(exclude)
+			if err != nil {
+				return nil, err
+			}
+			filter.excludes = append(filter.excludes, glob)
+			continue
+		}
+		glob, err := compileGlob(include)
+		if err != nil {
+			return nil, err
+		}
+		filter.includes = append(filter.includes, glob)
+	}
+	for _, exclude := range opts.Excludes {
+		glob, err := compileGlob(exclude)
+		if err != nil {
+			return nil, err
+		}
+		filter.excludes = append(filter.excludes, glob)
+	}
+	return filter, nil
+}
+
+// Match は、ファイルが条件に一致するかを返します
+// absPathはファイルの絶対パス、relはベースディレクトリからのスラッシュ区切りの相対パスです
+func (f *fileFilter) Match(absPath, rel string) bool {
+	if !f.pattern.MatchString(absPath) {
+		return false
+	}
+
+	if len(f.extensions) > 0 {
+		name := path.Base(rel)
+		matched := false
+		for _, ext := range f.extensions {
+			if ext.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	if len(f.includes) > 0 {
+		matched := false
+		for _, glob := range f.includes {
+			if glob.match(rel) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+
+	return !f.Excluded(rel, false)
+}
+
+// Excluded は、ファイルまたはディレクトリが除外のパターンに一致するかを返します
+// 一致したディレクトリは探索しません
+func (f *fileFilter) Excluded(rel string, isDir bool) bool {
+	for _, glob := range f.excludes {
+		if glob.matchPath(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileGlob は、globパターンを検証してglobPatternに変換する関数です
+// ** は0個以上のディレクトリに一致します
+func compileGlob(pattern string) (globPattern, error) {
+	// 先頭の / は、ファイル名ではなくベースディレクトリからの相対パスに一致させるために指定できる
+	trimmed := strings.TrimPrefix(pattern, "./")
+	dirOnly := strings.HasSuffix(trimmed, "/")
+	trimmed = strings.TrimSuffix(trimmed, "/")
+	anchored := strings.Contains(trimmed, "/")
+	trimmed = strings.TrimPrefix(trimmed, "/")
+	if trimmed == "" {
+		return globPattern{}, fmt.Errorf("globパターンが空です: %q", pattern)
+	}
+
+	glob := globPattern{segments: strings.Split(trimmed, "/"), anchored: anchored, dirOnly: dirOnly}
+	for _, segment := range glob.segments {
+		if _, err := path.Match(segment, ""); err != nil {
+			return globPattern{}, fmt.Errorf("globパターンが不正です（%s）: %v", pattern, err)
+		}
+	}
+	return glob, nil
+}
+
+// match は、ベースディレクトリからの相対パスのファイルがパターンに一致するかを返します
+func (g globPattern) match(rel string) bool {
+	return g.matchPath(rel, false)
+}
+
+// matchPath は、ベースディレクトリからの相対パスのファイルまたはディレクトリがパターンに一致するかを返します
+// ディレクトリのパターンは、一致するディレクトリとその中のファイルとディレクトリに一致します
+func (g globPattern) matchPath(rel string, isDir bool) bool {
+	if !g.dirOnly {
+		return g.matchName(rel)
+	}
+	parts := strings.Split(rel, "/")
+	dirs := len(parts)
+	if !isDir {
+		dirs-- // ファイル自体はディレクトリのパターンに一致しない
+	}
+	for i := 1; i <= dirs; i++ {
+		if g.matchName(strings.Join(parts[:i], "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchName は、パスがパターンに一致するかを返します（/ を含まないパターンは最後の要素のみで判定します）
+func (g globPattern) matchName(rel string) bool {
+	if !g.anchored {
+		return matchSegments(g.segments, []string{path.Base(rel)})
+	}
+	return matchSegments(g.segments, strings.Split(rel, "/"))
+}
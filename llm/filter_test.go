@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ファイルを選択する条件のテスト
+func TestFileFilter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		opts   FlattenOptions
+		rel    string
+		expect bool
+	}{
+		{name: "条件なし", rel: "main.go", expect: true},
+		{name: "複数の拡張子", opts: FlattenOptions{Extension: "*.go, *.md"}, rel: "docs/README.md", expect: true},
+		{name: "複数の拡張子に一致しない", opts: FlattenOptions{Extension: "*.go,*.md"}, rel: "web/app.js", expect: false},
+		{name: "ファイル名のglob", opts: FlattenOptions{Includes: []string{"*.go"}}, rel: "llm/git/git_diff.go", expect: true},
+		{name: "**のglob", opts: FlattenOptions{Includes: []string{"llm/**/*.go"}}, rel: "llm/git/git_diff.go", expect: true},
+		{name: "**のglobに一致しない", opts: FlattenOptions{Includes: []string{"llm/**/*.go"}}, rel: "cmd/hiracli/main.go", expect: false},
+		{name: "いずれかのinclude", opts: FlattenOptions{Includes: []string{"cmd/**", "*.md"}}, rel: "cmd/hiracli/main.go", expect: true},
+		{name: "!で始まるinclude", opts: FlattenOptions{Includes: []string{"**/*.go", "!**/*_test.go"}}, rel: "llm/ask_test.go", expect: false},
+		{name: "exclude", opts: FlattenOptions{Extension: "*.go", Excludes: []string{"*_test.go"}}, rel: "llm/ask_test.go", expect: false},
+		{name: "先頭の/のexclude", opts: FlattenOptions{Excludes: []string{"/main.go"}}, rel: "cmd/main.go", expect: true},
+		{name: "末尾が/のexclude", opts: FlattenOptions{Excludes: []string{"vendor/"}}, rel: "vendor/lib/lib.go", expect: false},
+		{name: "末尾が/のexcludeは深い階層のディレクトリにも一致", opts: FlattenOptions{Excludes: []string{"vendor/"}}, rel: "web/vendor/app.js", expect: false},
+		{name: "末尾が/のexcludeはファイルに一致しない", opts: FlattenOptions{Excludes: []string{"vendor/"}}, rel: "docs/vendor", expect: true},
+		{name: "末尾が/のinclude", opts: FlattenOptions{Includes: []string{"src/"}}, rel: "src/app/main.go", expect: true},
+		{name: "末尾が/の/を含むinclude", opts: FlattenOptions{Includes: []string{"cmd/hiracli/"}}, rel: "cmd/hiracli/main.go", expect: true},
+		{name: "末尾が/の/を含むincludeに一致しない", opts: FlattenOptions{Includes: []string{"cmd/hiracli/"}}, rel: "tools/cmd/hiracli/main.go", expect: false},
+		{name: "正規表現と組み合わせる", opts: FlattenOptions{Pattern: "provider_", Includes: []string{"llm/*.go"}}, rel: "llm/ask.go", expect: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filter, err := newFileFilter(tc.opts)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if actual := filter.Match("/src/"+tc.rel, tc.rel); actual != tc.expect {
+				t.Errorf("判定が期待通りではありません。期待: %v, 実際: %v", tc.expect, actual)
+			}
+		})
+	}
+
+	// 末尾が / の除外パターンに一致するディレクトリは探索しない
+	filter, err := newFileFilter(FlattenOptions{Excludes: []string{"vendor/"}})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if !filter.Excluded("vendor", true) || filter.Excluded("vendor", false) {
+		t.Error("末尾が / の除外パターンがディレクトリのみに一致していません")
+	}
+
+	// 不正なパターンは探索の前にエラーにする
+	for _, opts := range []FlattenOptions{
+		{Pattern: "("},
+		{Includes: []string{"src/[a-"}},
+		{Excludes: []string{"/"}},
+	} {
+		if _, err := newFileFilter(opts); err == nil {
+			t.Errorf("エラーが期待されましたが、発生しませんでした: %+v", opts)
+		}
+	}
+}
+
+// globパターンに従ったファイルの収集のテスト
+func TestFindFlattenFilesGlob(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFiles(t, dir, map[string]string{
+		"go.mod":                         "module example\n",
+		"README.md":                      "# example\n",
+		"services/billing/api.go":        "package billing\n",
+		"services/billing/api_test.go":   "package billing\n",
+		"services/billing/docs/usage.md": "# usage\n",
+		"services/auth/auth.go":          "package auth\n",
+		"vendor/lib/lib.go":              "package lib\n",
+	})
+
+	opts := FlattenOptions{
+		DepthLimit: 10,
+		NoIgnore:   true,
+		Extension:  "*.go,*.md",
+		Includes:   []string{"services/billing/**", "*.md", "!**/*_test.go"},
+		Excludes:   []string{"docs"},
+	}
+	files, _, err := findFlattenFiles(dir, opts)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	var actual []string
+	for _, file := range files {
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual = append(actual, filepath.ToSlash(rel))
+	}
+	expect := []string{"README.md", "services/billing/api.go"}
+	if strings.Join(actual, " ") != strings.Join(expect, " ") {
+		t.Errorf("収集したファイルが期待通りではありません。\n期待: %v\n実際: %v", expect, actual)
+	}
+}
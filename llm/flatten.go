@@ -3,23 +3,35 @@ package llm
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
-	"unicode/utf8"
+	"unicode"
 )
 
 // FlattenOptions は、flatten-srcコマンドのオプションを定義する構造体です
 type FlattenOptions struct {
-	Pattern        string // ファイルマッチングの正規表現パターン
-	Extension      string // ファイル拡張子でのフィルタリング（*.goなど）
-	MaxInputTokens int    // 最大トークン数（デフォルト: 200000）
-	DepthLimit     int    // サブディレクトリの探索深さ制限（デフォルト: 10）
-	CurrentTokens  int    // 現在のトークン数をトラッキング
-	IncludedFiles  int    // 処理したファイル数
-	DebugMode      bool   // デバッグモードフラグ
-	BasePath       string // ベースディレクトリ
+	Pattern        string    // ファイルマッチングの正規表現パターン
+	Extension      string    // ファイル拡張子でのフィルタリング（*.goなど、カンマ区切りで複数指定可）
+	Includes       []string  // 対象にするファイルのglobパターン（いずれかに一致、! で始まるものは除外）
+	Excludes       []string  // 除外するファイルとディレクトリのglobパターン
+	MaxInputTokens int       // 最大トークン数（デフォルト: 200000）
+	DepthLimit     int       // サブディレクトリの探索深さ制限（デフォルト: 10）
+	CurrentTokens  int       // 現在のトークン数をトラッキング
+	IncludedFiles  int       // 処理したファイル数
+	DebugMode      bool      // デバッグモードフラグ
+	BasePath       string    // ベースディレクトリ
+	NoIgnore       bool      // .gitignoreや.hiracliignoreなどの無視ファイルを使用しない
+	Hidden         bool      // 隠しファイルと隠しディレクトリも対象にする（.gitは常に除外）
+	GitFiles       string    // Gitから取得するファイル一覧（tracked、changed、staged）
+	Since          string    // 指定したGitの参照から変更されたファイルのみを対象にする
+	Tokenizer      string    // トークン数を数えるトークナイザー（空の場合はデフォルト）
+	Budget         string    // トークン数の制限を超える場合の扱い（skip、stop、truncate、デフォルト: skip）
+	Order          string    // ファイルを含める優先順位（path、recent、size、デフォルト: path）
+	Weights        []string  // パスの重み（glob=重み、重みが大きいファイルを優先する）
+	Output         io.Writer // 出力先（nilの場合はos.Stdout）
 }
 
 // FlattenSrc は、指定したパターンに一致するファイルを見つけ、
@@ -34,6 +46,18 @@ func FlattenSrc(opts FlattenOptions) error {
 		opts.DepthLimit = 10
 	}
 
+	if opts.Budget == "" {
+		opts.Budget = BudgetSkip
+	}
+
+	if opts.Order == "" {
+		opts.Order = OrderPath
+	}
+
+	if err := ValidateFlattenBudget(opts.Budget, opts.Order, opts.Weights); err != nil {
+		return err
+	}
+
 	// ベースディレクトリを設定
 	baseDir := opts.BasePath
 	if baseDir == "" {
@@ -45,169 +69,242 @@ func FlattenSrc(opts FlattenOptions) error {
 		}
 	}
 
-	// 正規表現パターンのコンパイル
-	pattern, err := regexp.Compile(opts.Pattern)
+	tokenizer, err := NewTokenizer(opts.Tokenizer)
 	if err != nil {
-		return fmt.Errorf("正規表現パターンのコンパイルエラー: %v", err)
+		return err
+	}
+
+	// ファイルを収集
+	files, ignoredCount, err := findFlattenFiles(baseDir, opts)
+	if err != nil {
+		return err
 	}
 
 	// 結果を格納する文字列ビルダー
 	var result strings.Builder
 
-	// ファイルを収集
-	var files []string
-	err = filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
+	// ファイルが見つからなかった場合のメッセージ
+	if len(files) == 0 {
+		return fmt.Errorf("指定した条件に一致するファイルが見つかりませんでした")
+	}
 
-		// 相対パスの取得
-		relPath, err := filepath.Rel(baseDir, path)
-		if err != nil {
-			return err
-		}
+	weights, err := parsePathWeights(opts.Weights)
+	if err != nil {
+		return err
+	}
 
-		// ディレクトリの場合は深さをチェック
-		if info.IsDir() {
-			// カレントディレクトリの場合はスキップしない
-			if path == baseDir {
-				return nil
-			}
+	// 優先順位の順に、トークン数の制限に収まるファイルを読み込んで選ぶ
+	load := func(file *flattenFile) bool {
+		return loadFlattenFile(file, tokenizer, opts.DebugMode)
+	}
+	candidates := newFlattenFiles(baseDir, files, weights)
+	if opts.Order == OrderSize {
+		// トークン数の少ない順に並べるため、すべて読み込む
+		candidates = loadAllFlattenFiles(candidates, load)
+	}
+	orderFlattenFiles(candidates, opts.Order)
+	included, omissions := budgetFlattenFiles(candidates, opts.Budget, opts.MaxInputTokens, tokenizer, load)
 
-			// ディレクトリの深さを計算
-			depth := strings.Count(relPath, string(os.PathSeparator)) + 1
-			if depth > opts.DepthLimit {
-				fmt.Fprintf(os.Stderr, "深さ制限によりスキップ: %s (深さ: %d)\n", relPath, depth)
-				return filepath.SkipDir
-			}
-			return nil
-		}
+	for _, file := range included {
+		// ファイルパスとコンテンツをフォーマット
+		result.WriteString(fmt.Sprintf("### %s\n```\n%s\n```\n\n", file.relPath, file.content))
 
-		// 隠しディレクトリ内のファイルはスキップ
-		pathParts := strings.Split(relPath, string(os.PathSeparator))
-		for _, part := range pathParts {
-			if strings.HasPrefix(part, ".") && part != "." && part != ".." {
-				return nil
-			}
-		}
+		// トークン数と処理ファイル数を更新
+		opts.CurrentTokens += file.tokens
+		opts.IncludedFiles++
+	}
 
-		// パターンと拡張子のフィルタリング
-		// パターンマッチングをチェック
-		patternMatched := pattern.MatchString(path)
+	// 省略または切り詰めたファイルの一覧
+	writeFlattenManifest(&result, omissions, opts.MaxInputTokens, tokenizer)
 
-		// 拡張子マッチングをチェック
-		extensionMatched := true
-		if opts.Extension != "" {
-			// ワイルドカードパターンを正規表現に変換
-			extPattern := convertWildcardToRegexp(opts.Extension)
-			extRe, err := regexp.Compile(extPattern)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "警告: 拡張子パターンが不正です: %v\n", err)
-				extensionMatched = false
-			} else {
-				extensionMatched = extRe.MatchString(filepath.Base(path))
+	// 結果の表示
+	output := opts.Output
+	if output == nil {
+		output = os.Stdout
+	}
+	fmt.Fprintln(output, result.String())
+
+	if len(omissions) > 0 {
+		truncatedCount := 0
+		for _, omission := range omissions {
+			if omission.included > 0 {
+				truncatedCount++
 			}
 		}
+		fmt.Fprintf(os.Stderr, "警告: トークン制限（%d）により、%d 件のファイルを省略し、%d 件のファイルを切り詰めました（一覧は出力の末尾を参照）\n",
+			opts.MaxInputTokens, len(omissions)-truncatedCount, truncatedCount)
+	}
 
-		// 両方の条件を満たす場合にファイルを追加
-		if patternMatched && extensionMatched {
-			files = append(files, path)
+	// 統計情報の表示（デバッグモード時のみ）
+	if opts.DebugMode {
+		fmt.Fprintf(os.Stderr, "統計情報:\n")
+		fmt.Fprintf(os.Stderr, "- 処理したファイル数: %d\n", opts.IncludedFiles)
+		fmt.Fprintf(os.Stderr, "- 使用トークン数（%s）: %d / %d\n", tokenizer.Name(), opts.CurrentTokens, opts.MaxInputTokens)
+		fmt.Fprintf(os.Stderr, "- 探索深さ制限: %d\n", opts.DepthLimit)
+		fmt.Fprintf(os.Stderr, "- トークン制限の扱い: %s（優先順位: %s）\n", opts.Budget, opts.Order)
+		if !opts.NoIgnore {
+			fmt.Fprintf(os.Stderr, "- 無視ファイルにより除外: %d\n", ignoredCount)
+		}
+		fmt.Fprintf(os.Stderr, "- 検索ディレクトリ: %s\n", opts.BasePath)
+		if opts.Pattern != "" {
+			fmt.Fprintf(os.Stderr, "- 検索パターン: %s\n", opts.Pattern)
+		}
+		if opts.Extension != "" {
+			fmt.Fprintf(os.Stderr, "- 拡張子フィルタ: %s\n", opts.Extension)
+		}
+		if opts.GitFiles != "" {
+			fmt.Fprintf(os.Stderr, "- Gitのファイル一覧: %s\n", opts.GitFiles)
+		}
+		if opts.Since != "" {
+			fmt.Fprintf(os.Stderr, "- 変更の基準: %s\n", opts.Since)
+		}
+		if len(opts.Includes) > 0 {
+			fmt.Fprintf(os.Stderr, "- 対象パターン: %s\n", strings.Join(opts.Includes, ", "))
 		}
+		if len(opts.Excludes) > 0 {
+			fmt.Fprintf(os.Stderr, "- 除外パターン: %s\n", strings.Join(opts.Excludes, ", "))
+		}
+	}
 
-		return nil
-	})
+	return nil
+}
 
+// findFlattenFiles は、ベースディレクトリから条件に一致するファイルを探し、
+// ファイルのパスと無視ファイルにより除外したファイルとディレクトリの数を返す関数です
+// Gitのファイル一覧が指定されている場合は、ディレクトリを探索せずにGitから対象のファイルを取得します
+func findFlattenFiles(baseDir string, opts FlattenOptions) ([]string, int, error) {
+	// 条件は探索の前に一度だけコンパイルする
+	filter, err := newFileFilter(opts)
 	if err != nil {
-		return fmt.Errorf("ファイル検索エラー: %v", err)
+		return nil, 0, err
 	}
+	selector := &fileSelector{baseDir: baseDir, opts: opts, filter: filter}
 
-	// ファイルが見つからなかった場合のメッセージ
-	if len(files) == 0 {
-		return fmt.Errorf("指定したパターン '%s' に一致するファイルが見つかりませんでした", opts.Pattern)
+	// 無視ファイルの読み込み
+	// Gitから取得したファイル一覧には、Gitの除外設定を適用しない（.hiracliignoreのみ適用する）
+	gitFiles := opts.GitFiles != "" || opts.Since != ""
+	if !opts.NoIgnore {
+		selector.ignore, err = newIgnoreMatcher(baseDir, !gitFiles)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if gitFiles {
+		files, err := selector.selectGitFiles()
+		return files, selector.ignoredCount, err
 	}
 
-	// ファイル内容の処理
-	for _, file := range files {
-		relPath, err := filepath.Rel(baseDir, file)
+	var files []string
+	err = filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
-			continue
+			return err
+		}
+
+		// カレントディレクトリの場合はスキップしない
+		if path == baseDir {
+			return nil
 		}
 
-		// ファイルの読み込み
-		content, err := os.ReadFile(file)
+		// 相対パスの取得
+		relPath, err := filepath.Rel(baseDir, path)
 		if err != nil {
-			if opts.DebugMode {
-				fmt.Fprintf(os.Stderr, "警告: ファイル '%s' の読み込みエラー: %v\n", relPath, err)
-			}
-			continue
+			return err
 		}
 
-		// UTF-8でない場合はスキップ
-		if !utf8.Valid(content) {
-			if opts.DebugMode {
-				fmt.Fprintf(os.Stderr, "警告: ファイル '%s' はUTF-8でないためスキップします\n", relPath)
+		// 除外するファイルとディレクトリをスキップ
+		if selector.skip(path, relPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
-			continue
+			return nil
 		}
 
-		// ファイルの内容をトークン数に変換（簡易的な推定）
-		fileContent := string(content)
-		fileTokens := estimateTokens(fileContent)
-
-		// トークン数の制限をチェック
-		if opts.CurrentTokens+fileTokens > opts.MaxInputTokens {
-			if opts.IncludedFiles > 0 {
-				if opts.DebugMode {
-					fmt.Fprintf(os.Stderr, "警告: トークン制限（%d）に達したため、一部のファイルは含まれていません\n", opts.MaxInputTokens)
-					fmt.Fprintf(os.Stderr, "処理したファイル数: %d\n", opts.IncludedFiles)
-				}
-				break
-			} else {
-				if opts.DebugMode {
-					fmt.Fprintf(os.Stderr, "警告: 最初のファイル '%s' が大きすぎます（推定 %d トークン）\n", relPath, fileTokens)
-				}
-				// 最初のファイルが大きすぎる場合でも、一部だけでも含める
-				fileContent = truncateContent(fileContent, opts.MaxInputTokens)
-				fileTokens = opts.MaxInputTokens
+		// ディレクトリの場合は深さをチェック
+		if info.IsDir() {
+			// ディレクトリの深さを計算
+			depth := strings.Count(relPath, string(os.PathSeparator)) + 1
+			if depth > opts.DepthLimit {
+				fmt.Fprintf(os.Stderr, "深さ制限によりスキップ: %s (深さ: %d)\n", relPath, depth)
+				return filepath.SkipDir
 			}
+			if selector.ignore != nil {
+				return selector.ignore.loadDir(path)
+			}
+			return nil
 		}
 
-		// ファイルパスとコンテンツをフォーマット
-		result.WriteString(fmt.Sprintf("### %s\n```\n%s\n```\n\n", relPath, fileContent))
+		// パターン、拡張子、globパターンのフィルタリング
+		if filter.Match(path, filepath.ToSlash(relPath)) {
+			files = append(files, path)
+		}
 
-		// トークン数と処理ファイル数を更新
-		opts.CurrentTokens += fileTokens
-		opts.IncludedFiles++
+		return nil
+	})
 
-		if opts.CurrentTokens >= opts.MaxInputTokens {
-			break
-		}
+	if err != nil {
+		return nil, 0, fmt.Errorf("ファイル検索エラー: %v", err)
 	}
+	return files, selector.ignoredCount, nil
+}
 
-	// 結果の表示
-	fmt.Println(result.String())
+// fileSelector は、flatten-srcで対象にするファイルを選択する構造体です
+type fileSelector struct {
+	baseDir      string
+	opts         FlattenOptions
+	filter       *fileFilter
+	ignore       *ignoreMatcher // 無視ファイルを使用しない場合はnil
+	ignoredCount int            // 無視ファイルにより除外したファイルとディレクトリの数
+}
 
-	// 統計情報の表示（デバッグモード時のみ）
-	if opts.DebugMode {
-		fmt.Fprintf(os.Stderr, "統計情報:\n")
-		fmt.Fprintf(os.Stderr, "- 処理したファイル数: %d\n", opts.IncludedFiles)
-		fmt.Fprintf(os.Stderr, "- 使用トークン数（推定）: %d / %d\n", opts.CurrentTokens, opts.MaxInputTokens)
-		fmt.Fprintf(os.Stderr, "- 探索深さ制限: %d\n", opts.DepthLimit)
-		fmt.Fprintf(os.Stderr, "- 検索ディレクトリ: %s\n", opts.BasePath)
-		if opts.Pattern != "" {
-			fmt.Fprintf(os.Stderr, "- 検索パターン: %s\n", opts.Pattern)
+// skip は、ファイルまたはディレクトリを対象から除外するかを返します
+// 除外したディレクトリの中は探索しません
+func (s *fileSelector) skip(path, relPath string, isDir bool) bool {
+	// .git はワークツリーやサブモジュールではファイルのため、ファイルでも除外する
+	name := filepath.Base(path)
+	if name == ".git" {
+		return true
+	}
+	if !s.opts.Hidden && strings.HasPrefix(name, ".") {
+		return true
+	}
+	if isDir && s.filter.Excluded(filepath.ToSlash(relPath), true) {
+		if s.opts.DebugMode {
+			fmt.Fprintf(os.Stderr, "除外パターンによりスキップ: %s\n", relPath)
 		}
-		if opts.Extension != "" {
-			fmt.Fprintf(os.Stderr, "- 拡張子フィルタ: %s\n", opts.Extension)
+		return true
+	}
+	if s.ignore != nil && s.ignore.Ignored(path, isDir) {
+		if s.opts.DebugMode {
+			fmt.Fprintf(os.Stderr, "無視ファイルによりスキップ: %s\n", relPath)
 		}
+		s.ignoredCount++
+		return true
 	}
-
-	return nil
+	return false
 }
 
 // estimateTokens は文字列のトークン数を推定する関数
 // 簡易的な推定方法として、単語数とソースコードの特殊文字を考慮して計算
+// 日本語などの空白で区切らない文字は、単語ではなく文字ごとに数える
 func estimateTokens(text string) int {
+	// 漢字は1文字あたり約1.25トークン、かなや全角の記号は約1トークン
+	han, cjk := 0, 0
+	if strings.IndexFunc(text, isCJK) >= 0 {
+		text = strings.Map(func(r rune) rune {
+			if !isCJK(r) {
+				return r
+			}
+			if unicode.Is(unicode.Han, r) {
+				han++
+			} else {
+				cjk++
+			}
+			// 前後の英数字と別の単語として数えるため、空白に置き換える
+			return ' '
+		}, text)
+	}
+
 	// 単語数をカウント
 	words := len(strings.Fields(text))
 
@@ -226,24 +323,24 @@ func estimateTokens(text string) int {
 	// 実際のトークナイズはモデルによって異なりますが、これはおおよその推定値
 	tokens := words + (symbols / 2) + newlines
 
-	// 最低でも文字数の1/4はトークンとしてカウント
-	minTokens := len(text) / 4
+	// 最低でも文字数の1/4はトークンとしてカウント（CJKの文字を置き換えた空白は除く）
+	minTokens := (len(text) - han - cjk) / 4
 	if tokens < minTokens {
 		tokens = minTokens
 	}
 
-	return tokens
+	return tokens + han*5/4 + cjk
 }
 
-// truncateContent は、コンテンツをトークン制限に合わせて切り詰める関数
-func truncateContent(content string, maxTokens int) string {
+// truncateContent は、コンテンツをトークン制限に合わせて切り詰め、切り詰めた内容とそのトークン数を返す関数
+func truncateContent(content string, maxTokens int, tokenizer Tokenizer) (string, int) {
 	scanner := bufio.NewScanner(strings.NewReader(content))
 	var truncated strings.Builder
 	currentTokens := 0
 
 	for scanner.Scan() {
 		line := scanner.Text()
-		lineTokens := estimateTokens(line)
+		lineTokens := tokenizer.CountTokens(line + "\n")
 
 		if currentTokens+lineTokens > maxTokens {
 			truncated.WriteString("... (内容が長すぎるため切り詰められました)\n")
@@ -255,7 +352,7 @@ func truncateContent(content string, maxTokens int) string {
 		currentTokens += lineTokens
 	}
 
-	return truncated.String()
+	return truncated.String(), currentTokens
 }
 
 // convertWildcardToRegexp は、ワイルドカードパターンを正規表現パターンに変換する関数です
@@ -2,6 +2,7 @@ package git
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os/exec"
 
@@ -11,6 +12,16 @@ import (
 type GitDiffOptions struct {
 	LLMModel string
 	Cached   bool
+	NoStream bool
+	Template string            // プロンプトテンプレート名（デフォルト: diff-comment）
+	Lang     string            // コミットメッセージの言語（デフォルト: 日本語）
+	System   string            // システムプロンプト（テンプレートのsystemブロックより優先）
+	Vars     map[string]string // テンプレートに渡す任意の変数
+
+	Params       llm.InferenceParams // 推論パラメータ
+	AutoContinue int                 // 回答が途切れた場合に続きを自動取得する回数
+	Client       llm.ClientOptions   // タイムアウトと再試行の設定
+	API          string              // モデルの呼び出しに使用するAPI（invoke または converse）
 }
 
 func GetGitDiff(cached bool) (string, error) {
@@ -28,7 +39,7 @@ func GetGitDiff(cached bool) (string, error) {
 	return out.String(), nil
 }
 
-func GitDiffComment(opts GitDiffOptions) error {
+func GitDiffComment(ctx context.Context, opts GitDiffOptions) error {
 	diff, err := GetGitDiff(opts.Cached)
 	if err != nil {
 		return err
@@ -41,19 +52,50 @@ func GitDiffComment(opts GitDiffOptions) error {
 		return fmt.Errorf("git diffの結果が空です。変更がありません")
 	}
 
-	var diffType string
+	templateName := opts.Template
+	if templateName == "" {
+		templateName = "diff-comment"
+	}
+	lang := opts.Lang
+	if lang == "" {
+		lang = "日本語"
+	}
+
+	vars := map[string]string{}
+	for key, value := range opts.Vars {
+		vars[key] = value
+	}
 	if opts.Cached {
-		diffType = " --cached"
+		vars["DiffType"] = " --cached"
+	}
+
+	rendered, err := llm.RenderTemplate(templateName, llm.TemplateData{
+		Diff: diff,
+		Lang: lang,
+		Vars: vars,
+	})
+	if err != nil {
+		return err
+	}
+
+	system := opts.System
+	if system == "" {
+		system = rendered.System
 	}
-	prompt := fmt.Sprintf(`# git diff%s
-%s
-日本語のコミットメッセージを作って`, diffType, diff)
 
 	askOpts := llm.AskOptions{
 		LLMModel:  opts.LLMModel,
 		DebugMode: false,
-		Prompt:    prompt,
+		Prompt:    rendered.Prompt,
+		NoStream:  opts.NoStream,
+		System:    system,
+		Command:   "git diff-comment",
+
+		Params:       opts.Params,
+		AutoContinue: opts.AutoContinue,
+		Client:       opts.Client,
+		API:          opts.API,
 	}
 
-	return llm.Ask(askOpts)
+	return llm.Ask(ctx, askOpts)
 }
@@ -0,0 +1,139 @@
+package llm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Gitから取得するファイル一覧の種類
+const (
+	GitFilesTracked = "tracked" // Gitで管理されているファイル
+	GitFilesChanged = "changed" // HEADから変更されたファイル（ステージングの有無を問わず、未追跡のファイルを含む）
+	GitFilesStaged  = "staged"  // ステージングされたファイル
+)
+
+// ValidateGitFiles は、Gitから取得するファイル一覧の指定を検証する関数です
+func ValidateGitFiles(gitFiles, since string) error {
+	switch gitFiles {
+	case "", GitFilesTracked, GitFilesChanged, GitFilesStaged:
+	default:
+		return fmt.Errorf("不正なGitのファイル一覧です: %s（tracked、changed、staged のいずれかを指定してください）", gitFiles)
+	}
+	if gitFiles != "" && since != "" {
+		return fmt.Errorf("--since は --git-tracked、--git-changed、--git-staged と同時に指定できません")
+	}
+	if strings.HasPrefix(since, "-") {
+		return fmt.Errorf("不正なGitの参照です: %s", since)
+	}
+	return nil
+}
+
+// gitFileList は、ベースディレクトリ以下のGitのファイル一覧をベースディレクトリからの相対パスで返す関数です
+// 削除されたファイルは含みません
+func gitFileList(baseDir, gitFiles, since string) ([]string, error) {
+	if err := ValidateGitFiles(gitFiles, since); err != nil {
+		return nil, err
+	}
+
+	// -z で区切ることで、空白や日本語を含むパスを引用符なしで取得する
+	var commands [][]string
+	switch {
+	case since != "":
+		commands = [][]string{{"diff", "--name-only", "-z", "--relative", "--diff-filter=d", since, "--"}}
+	case gitFiles == GitFilesTracked:
+		commands = [][]string{{"ls-files", "-z"}}
+	case gitFiles == GitFilesChanged:
+		commands = [][]string{
+			{"diff", "--name-only", "-z", "--relative", "--diff-filter=d", "HEAD", "--"},
+			{"ls-files", "-z", "--others", "--exclude-standard"},
+		}
+	case gitFiles == GitFilesStaged:
+		commands = [][]string{{"diff", "--cached", "--name-only", "-z", "--relative", "--diff-filter=d"}}
+	}
+
+	seen := map[string]bool{}
+	var files []string
+	for _, args := range commands {
+		output, err := runGit(baseDir, args...)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range strings.Split(output, "\x00") {
+			if name != "" && !seen[name] {
+				seen[name] = true
+				files = append(files, filepath.FromSlash(name))
+			}
+		}
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// runGit は、ディレクトリでgitコマンドを実行して標準出力を返す関数です
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %sの実行に失敗しました: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %sの実行に失敗しました: %v", args[0], err)
+	}
+	return out.String(), nil
+}
+
+// selectGitFiles は、Gitから取得したファイル一覧から条件に一致するファイルを選択します
+// 隠しファイル、除外パターン、無視ファイルの条件は、ファイルとその親ディレクトリに適用します
+func (s *fileSelector) selectGitFiles() ([]string, error) {
+	relPaths, err := gitFileList(s.baseDir, s.opts.GitFiles, s.opts.Since)
+	if err != nil {
+		return nil, err
+	}
+
+	skippedDirs := map[string]bool{} // 親ディレクトリの判定結果（trueは除外）
+	var files []string
+	for _, relPath := range relPaths {
+		path := filepath.Join(s.baseDir, relPath)
+
+		// 親ディレクトリを上から順に判定し、無視ファイルを読み込む
+		skipped := false
+		parts := strings.Split(relPath, string(os.PathSeparator))
+		for i := 1; i < len(parts) && !skipped; i++ {
+			dirRel := filepath.Join(parts[:i]...)
+			skip, ok := skippedDirs[dirRel]
+			if !ok {
+				dirPath := filepath.Join(s.baseDir, dirRel)
+				skip = s.skip(dirPath, dirRel, true)
+				if !skip && s.ignore != nil {
+					if err := s.ignore.loadDir(dirPath); err != nil {
+						return nil, err
+					}
+				}
+				skippedDirs[dirRel] = skip
+			}
+			skipped = skip
+		}
+		if skipped || s.skip(path, relPath, false) {
+			continue
+		}
+
+		// 削除されたファイルやサブモジュールは対象にしない
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		if s.filter.Match(path, filepath.ToSlash(relPath)) {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,156 @@
+package llm
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitForTest は、テスト用のリポジトリでgitコマンドを実行する関数です
+func gitForTest(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false"}, args...)...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s の実行エラー: %v\n%s", strings.Join(args, " "), err, output)
+	}
+}
+
+// Gitから取得したファイル一覧によるファイルの収集のテスト
+func TestFindFlattenFilesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("gitがインストールされていません")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	repo := t.TempDir()
+	gitForTest(t, repo, "init", "-q", "-b", "main")
+	writeTestFiles(t, repo, map[string]string{
+		".gitignore":     "*.log\n",
+		".hiracliignore": "docs/\n",
+		"vendor.log":     "tracked log\n",
+		"main.go":        "package main\n",
+		"README.md":      "# example\n",
+		"old.go":         "package main\n",
+		"lib/util.go":    "package lib\n",
+		"lib/helper.go":  "package lib\n",
+		"docs/design.md": "# design\n",
+	})
+	gitForTest(t, repo, "add", ".")
+	gitForTest(t, repo, "add", "-f", "vendor.log") // .gitignoreに一致するが管理されているファイル
+	gitForTest(t, repo, "commit", "-q", "-m", "initial")
+	gitForTest(t, repo, "tag", "v1")
+
+	// コミット済みの変更、ステージングした変更、作業ツリーの変更、未追跡のファイル、削除したファイル
+	writeTestFiles(t, repo, map[string]string{"lib/util.go": "package lib\n\nfunc A() {}\n"})
+	gitForTest(t, repo, "commit", "-q", "-am", "update util")
+	writeTestFiles(t, repo, map[string]string{
+		"README.md":     "# example\n\nupdated\n",
+		"lib/helper.go": "package lib\n\nfunc B() {}\n",
+		"lib/new.go":    "package lib\n",
+		"debug.log":     "log\n",
+	})
+	gitForTest(t, repo, "add", "lib/helper.go")
+	gitForTest(t, repo, "rm", "-q", "old.go")
+
+	testCases := []struct {
+		name   string
+		base   string
+		opts   FlattenOptions
+		expect []string
+	}{
+		{
+			name:   "Gitで管理されているファイル（.gitignoreは適用せず.hiracliignoreのみ適用）",
+			base:   repo,
+			opts:   FlattenOptions{GitFiles: GitFilesTracked, Hidden: true},
+			expect: []string{".gitignore", ".hiracliignore", "README.md", "lib/helper.go", "lib/util.go", "main.go", "vendor.log"},
+		},
+		{
+			name:   "無視ファイルを使用しない",
+			base:   repo,
+			opts:   FlattenOptions{GitFiles: GitFilesTracked, NoIgnore: true},
+			expect: []string{"README.md", "docs/design.md", "lib/helper.go", "lib/util.go", "main.go", "vendor.log"},
+		},
+		{
+			name:   "HEADから変更されたファイルと未追跡のファイル",
+			base:   repo,
+			opts:   FlattenOptions{GitFiles: GitFilesChanged},
+			expect: []string{"README.md", "lib/helper.go", "lib/new.go"},
+		},
+		{
+			name:   "ステージングされたファイル",
+			base:   repo,
+			opts:   FlattenOptions{GitFiles: GitFilesStaged},
+			expect: []string{"lib/helper.go"},
+		},
+		{
+			name:   "参照から変更されたファイルを拡張子で絞り込む",
+			base:   repo,
+			opts:   FlattenOptions{Since: "v1", Extension: "*.go"},
+			expect: []string{"lib/helper.go", "lib/util.go"},
+		},
+		{
+			name:   "サブディレクトリ以下のみ",
+			base:   filepath.Join(repo, "lib"),
+			opts:   FlattenOptions{GitFiles: GitFilesTracked, Excludes: []string{"helper.go"}},
+			expect: []string{"util.go"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files, _, err := findFlattenFiles(tc.base, tc.opts)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			var actual []string
+			for _, file := range files {
+				rel, err := filepath.Rel(tc.base, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual = append(actual, filepath.ToSlash(rel))
+			}
+			if strings.Join(actual, " ") != strings.Join(tc.expect, " ") {
+				t.Errorf("収集したファイルが期待通りではありません。\n期待: %v\n実際: %v", tc.expect, actual)
+			}
+		})
+	}
+
+	// 存在しない参照やGitリポジトリ外ではエラー
+	if _, _, err := findFlattenFiles(repo, FlattenOptions{Since: "no-such-ref"}); err == nil {
+		t.Error("存在しない参照でエラーが期待されました")
+	}
+	if _, _, err := findFlattenFiles(t.TempDir(), FlattenOptions{GitFiles: GitFilesTracked}); err == nil {
+		t.Error("Gitリポジトリ外でエラーが期待されました")
+	}
+}
+
+// Gitのファイル一覧の指定の検証のテスト
+func TestValidateGitFiles(t *testing.T) {
+	testCases := []struct {
+		name        string
+		gitFiles    string
+		since       string
+		expectError bool
+	}{
+		{name: "指定なし"},
+		{name: "changed", gitFiles: GitFilesChanged},
+		{name: "since", since: "origin/main"},
+		{name: "不正な種類", gitFiles: "modified", expectError: true},
+		{name: "同時に指定", gitFiles: GitFilesStaged, since: "main", expectError: true},
+		{name: "オプションのような参照", since: "--output=/tmp/x", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateGitFiles(tc.gitFiles, tc.since)
+			if (err != nil) != tc.expectError {
+				t.Errorf("エラーの有無が期待通りではありません: %v", err)
+			}
+		})
+	}
+}
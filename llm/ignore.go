@@ -0,0 +1,327 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// HiracliIgnoreFile は、hiracliのみで除外するファイルを指定する無視ファイルの名前です
+// .gitignoreと同じ書式で、同じディレクトリの.gitignoreより優先されます
+const HiracliIgnoreFile = ".hiracliignore"
+
+// ignoreRule は、無視ファイルの1行のパターンを定義する構造体です
+type ignoreRule struct {
+	segments []string // パターンを / で分割したもの
+	negate   bool     // ! で始まるパターン（除外の取り消し）
+	dirOnly  bool     // / で終わるパターン（ディレクトリのみに一致）
+	anchored bool     // / を含むパターン（無視ファイルのあるディレクトリからの相対パスに一致）
+	base     string   // 無視ファイルのあるディレクトリ（ルートからの相対パス、ルートは空文字列）
+}
+
+// ignoreMatcher は、.gitignore、.git/info/exclude、グローバルな除外設定、.hiracliignoreに従って
+// ファイルを除外するかを判定する構造体です
+type ignoreMatcher struct {
+	root      string                  // 相対パスの基準になるディレクトリ（Gitリポジトリ内の場合はそのルート）
+	fileNames []string                // 各ディレクトリで読み込む無視ファイルの名前
+	global    []ignoreRule            // グローバルな除外設定と.git/info/excludeのパターン
+	dirs      map[string][]ignoreRule // ディレクトリごとの.gitignoreと.hiracliignoreのパターン
+}
+
+// newIgnoreMatcher は、baseDirの探索に使用するignoreMatcherを作成する関数です
+// baseDirがGitリポジトリ内にある場合は、リポジトリのルートからbaseDirまでの無視ファイルも読み込みます
+// gitignoreがfalseの場合は、Gitの除外設定を使用せず、.hiracliignoreのみを読み込みます
+// （Gitから取得したファイル一覧には、Gitの除外設定に一致していても管理されているファイルが含まれるため）
+func newIgnoreMatcher(baseDir string, gitignore bool) (*ignoreMatcher, error) {
+	baseDir, err := filepath.Abs(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("パスの解決エラー: %v", err)
+	}
+
+	m := &ignoreMatcher{root: baseDir, fileNames: []string{HiracliIgnoreFile}, dirs: map[string][]ignoreRule{}}
+	if gitignore {
+		m.fileNames = []string{".gitignore", HiracliIgnoreFile}
+		if excludesFile := globalExcludesFile(baseDir); excludesFile != "" {
+			rules, err := readIgnoreFile(excludesFile, "")
+			if err != nil {
+				return nil, err
+			}
+			m.global = append(m.global, rules...)
+		}
+	}
+
+	gitRoot := findGitRoot(baseDir)
+	if gitRoot == "" {
+		return m, m.loadDir(baseDir)
+	}
+
+	m.root = gitRoot
+	if gitignore {
+		rules, err := readIgnoreFile(filepath.Join(gitCommonDir(gitRoot), "info", "exclude"), "")
+		if err != nil {
+			return nil, err
+		}
+		m.global = append(m.global, rules...)
+	}
+
+	// リポジトリのルートからbaseDirまでの各ディレクトリの無視ファイルを読み込む
+	rel, err := filepath.Rel(gitRoot, baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("パスの解決エラー: %v", err)
+	}
+	dir := gitRoot
+	if err := m.loadDir(dir); err != nil {
+		return nil, err
+	}
+	if rel != "." {
+		for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+			dir = filepath.Join(dir, part)
+			if err := m.loadDir(dir); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// loadDir は、ディレクトリの無視ファイル（.gitignoreと.hiracliignore）を読み込みます
+func (m *ignoreMatcher) loadDir(dir string) error {
+	rel, err := m.rel(dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.dirs[rel]; ok {
+		return nil
+	}
+
+	var rules []ignoreRule
+	for _, name := range m.fileNames {
+		fileRules, err := readIgnoreFile(filepath.Join(dir, name), rel)
+		if err != nil {
+			return err
+		}
+		rules = append(rules, fileRules...)
+	}
+	m.dirs[rel] = rules
+	return nil
+}
+
+// Ignored は、パスが除外されるかを返します
+// 親ディレクトリが除外される場合は探索しないため、親ディレクトリの判定は行いません
+func (m *ignoreMatcher) Ignored(filePath string, isDir bool) bool {
+	rel, err := m.rel(filePath)
+	if err != nil || rel == "" {
+		return false
+	}
+
+	// 後に評価したパターンほど優先する（グローバル < ルート < サブディレクトリ）
+	ignored := false
+	match := func(rules []ignoreRule) {
+		for _, rule := range rules {
+			if rule.match(rel, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	match(m.global)
+	match(m.dirs[""])
+	for i := 0; i < len(rel); i++ {
+		if rel[i] == '/' {
+			match(m.dirs[rel[:i]])
+		}
+	}
+	return ignored
+}
+
+// rel は、ルートからのスラッシュ区切りの相対パスを返します（ルート自身は空文字列）
+func (m *ignoreMatcher) rel(filePath string) (string, error) {
+	abs, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("パスの解決エラー: %v", err)
+	}
+	rel, err := filepath.Rel(m.root, abs)
+	if err != nil {
+		return "", fmt.Errorf("パスの解決エラー: %v", err)
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// match は、ルートからの相対パスがパターンに一致するかを返します
+func (r ignoreRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.base != "" {
+		if !strings.HasPrefix(rel, r.base+"/") {
+			return false
+		}
+		rel = rel[len(r.base)+1:]
+	}
+	if !r.anchored {
+		return matchSegments(r.segments, []string{path.Base(rel)})
+	}
+	return matchSegments(r.segments, strings.Split(rel, "/"))
+}
+
+// matchSegments は、パスの各要素がパターンの各要素に一致するかを返す関数です
+// ** は0個以上のディレクトリに一致します（末尾の ** はその中のすべてに一致します）
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			if len(pattern) == 1 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(pattern[1:], parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], parts[0]); err != nil || !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
+
+// parseIgnoreLine は、無視ファイルの1行をパターンに変換する関数です
+// 空行とコメントの場合はfalseを返します
+func parseIgnoreLine(line, base string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	// エスケープされていない末尾の空白は無視する
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{base: base}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	// 先頭または途中に / を含むパターンは、無視ファイルのあるディレクトリからの相対パスに一致する
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.segments = strings.Split(line, "/")
+	return rule, true
+}
+
+// readIgnoreFile は、無視ファイルを読み込んでパターンの一覧を返す関数です
+// ファイルがない場合は空の一覧を返します
+func readIgnoreFile(filePath, base string) ([]ignoreRule, error) {
+	data, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("無視ファイルの読み込みエラー（%s）: %v", filePath, err)
+	}
+
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if rule, ok := parseIgnoreLine(scanner.Text(), base); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+// findGitRoot は、dirを含むGitリポジトリのルートを返す関数です
+// ワークツリーやサブモジュールのように .git がファイルの場合も、そのディレクトリをルートとします
+// Gitリポジトリ内でない場合は空文字列を返します
+func findGitRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// gitCommonDir は、Gitリポジトリのルートの .git が指す、info/exclude などを含むGitディレクトリを返す関数です
+// ワークツリーやサブモジュールでは、.git はGitディレクトリの場所（gitdir: パス）を記述したファイルです
+func gitCommonDir(root string) string {
+	dotGit := filepath.Join(root, ".git")
+	info, err := os.Stat(dotGit)
+	if err != nil || info.IsDir() {
+		return dotGit
+	}
+
+	data, err := os.ReadFile(dotGit)
+	if err != nil {
+		return dotGit
+	}
+	dir, ok := strings.CutPrefix(strings.TrimSpace(string(data)), "gitdir:")
+	if !ok {
+		return dotGit
+	}
+	dir = strings.TrimSpace(dir)
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(root, dir)
+	}
+
+	// ワークツリーのGitディレクトリは、commondir に本体のGitディレクトリを記述している
+	if data, err := os.ReadFile(filepath.Join(dir, "commondir")); err == nil {
+		common := strings.TrimSpace(string(data))
+		if !filepath.IsAbs(common) {
+			common = filepath.Join(dir, common)
+		}
+		return common
+	}
+	return dir
+}
+
+// globalExcludesFile は、Gitのグローバルな除外設定のファイルパスを返す関数です
+// リポジトリの設定も参照するため、baseDirでgitを実行します
+// core.excludesFile が設定されていない場合は $XDG_CONFIG_HOME/git/ignore を返します
+func globalExcludesFile(baseDir string) string {
+	cmd := exec.Command("git", "config", "--path", "--get", "core.excludesFile")
+	cmd.Dir = baseDir
+	if out, err := cmd.Output(); err == nil {
+		if file := strings.TrimSpace(string(out)); file != "" {
+			return file
+		}
+	}
+
+	configDir := os.Getenv("XDG_CONFIG_HOME")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		configDir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(configDir, "git", "ignore")
+}
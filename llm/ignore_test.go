@@ -0,0 +1,230 @@
+package llm
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles は、ディレクトリにファイルを作成する関数です
+func writeTestFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// 無視ファイルのパターンの一致のテスト
+func TestIgnoreRuleMatch(t *testing.T) {
+	testCases := []struct {
+		name   string
+		line   string
+		base   string
+		path   string
+		isDir  bool
+		expect bool
+	}{
+		{name: "ファイル名", line: "*.log", path: "logs/app.log", expect: true},
+		{name: "ディレクトリのみ", line: "build/", path: "build", expect: false},
+		{name: "ディレクトリのみ（ディレクトリ）", line: "build/", path: "src/build", isDir: true, expect: true},
+		{name: "先頭の/", line: "/vendor", path: "vendor", isDir: true, expect: true},
+		{name: "先頭の/はサブディレクトリに一致しない", line: "/vendor", path: "src/vendor", isDir: true, expect: false},
+		{name: "途中の/", line: "docs/*.md", path: "docs/a.md", expect: true},
+		{name: "途中の/は深い階層に一致しない", line: "docs/*.md", path: "docs/sub/a.md", expect: false},
+		{name: "先頭の**", line: "**/gen/*.go", path: "a/b/gen/x.go", expect: true},
+		{name: "途中の**", line: "docs/**/*.svg", path: "docs/a/b/c.svg", expect: true},
+		{name: "途中の**は0個のディレクトリに一致", line: "docs/**/*.svg", path: "docs/c.svg", expect: true},
+		{name: "末尾の**", line: "tmp/**", path: "tmp/a/b", expect: true},
+		{name: "末尾の**はディレクトリ自身に一致しない", line: "tmp/**", path: "tmp", isDir: true, expect: false},
+		{name: "サブディレクトリの無視ファイル", line: "/out", base: "web", path: "web/out", isDir: true, expect: true},
+		{name: "サブディレクトリの無視ファイルは外に適用しない", line: "out", base: "web", path: "api/out", isDir: true, expect: false},
+		{name: "エスケープした#", line: `\#notes`, path: "#notes", expect: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			rule, ok := parseIgnoreLine(tc.line, tc.base)
+			if !ok {
+				t.Fatalf("パターンとして解析されませんでした: %q", tc.line)
+			}
+			if actual := rule.match(tc.path, tc.isDir); actual != tc.expect {
+				t.Errorf("一致の判定が期待通りではありません。期待: %v, 実際: %v", tc.expect, actual)
+			}
+		})
+	}
+
+	for _, line := range []string{"", "   ", "# コメント", "/"} {
+		if _, ok := parseIgnoreLine(line, ""); ok {
+			t.Errorf("パターンとして解析されるべきではありません: %q", line)
+		}
+	}
+}
+
+// 無視ファイルに従ったファイルの収集のテスト
+func TestFindFlattenFilesIgnore(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	writeTestFiles(t, home, map[string]string{".config/git/ignore": "*.swp\n"})
+
+	repo := t.TempDir()
+	writeTestFiles(t, repo, map[string]string{
+		".git/info/exclude":         "local/\n",
+		".gitignore":                "node_modules/\n/bin\n*.gen.go\n!keep.gen.go\n",
+		".hiracliignore":            "testdata/\n",
+		".env":                      "SECRET=1\n",
+		".github/workflows/ci.yml":  "on: push\n",
+		"main.go":                   "package main\n",
+		"main.go.swp":               "swap\n",
+		"keep.gen.go":               "package main\n",
+		"api.gen.go":                "package main\n",
+		"bin/hiracli":               "binary\n",
+		"node_modules/pkg/index.js": "module.exports = {}\n",
+		"local/notes.md":            "memo\n",
+		"testdata/input.txt":        "data\n",
+		"web/.gitignore":            "dist/\n!important.log\n",
+		"web/app.js":                "console.log(1)\n",
+		"web/dist/app.min.js":       "x\n",
+		"web/important.log":         "log\n",
+		"web/debug.log":             "log\n",
+		"cmd/bin/tool.go":           "package main\n",
+	})
+	writeTestFiles(t, repo, map[string]string{"web/.hiracliignore": "*.log\n"})
+
+	testCases := []struct {
+		name   string
+		base   string
+		opts   FlattenOptions
+		expect []string
+	}{
+		{
+			name:   "無視ファイルに従う",
+			base:   repo,
+			expect: []string{"cmd/bin/tool.go", "keep.gen.go", "main.go", "web/app.js"},
+		},
+		{
+			name:   "サブディレクトリから探索してもリポジトリの無視ファイルに従う",
+			base:   filepath.Join(repo, "web"),
+			expect: []string{"app.js"},
+		},
+		{
+			name:   "隠しファイルも対象にする",
+			base:   repo,
+			opts:   FlattenOptions{Hidden: true},
+			expect: []string{".env", ".github/workflows/ci.yml", ".gitignore", ".hiracliignore", "cmd/bin/tool.go", "keep.gen.go", "main.go", "web/.gitignore", "web/.hiracliignore", "web/app.js"},
+		},
+		{
+			name: "無視ファイルを使用しない",
+			base: repo,
+			opts: FlattenOptions{NoIgnore: true},
+			expect: []string{
+				"api.gen.go", "bin/hiracli", "cmd/bin/tool.go", "keep.gen.go", "local/notes.md", "main.go", "main.go.swp",
+				"node_modules/pkg/index.js", "testdata/input.txt", "web/app.js", "web/debug.log", "web/dist/app.min.js", "web/important.log",
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.DepthLimit = 10
+			files, _, err := findFlattenFiles(tc.base, tc.opts)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			var actual []string
+			for _, file := range files {
+				rel, err := filepath.Rel(tc.base, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual = append(actual, filepath.ToSlash(rel))
+			}
+			if strings.Join(actual, " ") != strings.Join(tc.expect, " ") {
+				t.Errorf("収集したファイルが期待通りではありません。\n期待: %v\n実際: %v", tc.expect, actual)
+			}
+		})
+	}
+}
+
+// .git がファイルのワークツリーと、リポジトリの core.excludesFile のテスト
+func TestFindFlattenFilesWorktree(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(home, ".config"))
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	// ワークツリーの .git は、本体のGitディレクトリ配下を指すファイル
+	main := t.TempDir()
+	writeTestFiles(t, main, map[string]string{
+		".git/info/exclude":           "local/\n",
+		".git/worktrees/wt/commondir": "../..\n",
+	})
+	worktree := t.TempDir()
+	writeTestFiles(t, worktree, map[string]string{
+		".git":           "gitdir: " + filepath.Join(main, ".git", "worktrees", "wt") + "\n",
+		".gitignore":     "*.log\n",
+		"main.go":        "package main\n",
+		"debug.log":      "log\n",
+		"local/notes.md": "memo\n",
+		"sub/a.go":       "package sub\n",
+		"sub/trace.log":  "log\n",
+	})
+
+	testCases := []struct {
+		name   string
+		base   string
+		expect []string
+	}{
+		{name: "ワークツリーのルート", base: worktree, expect: []string{".gitignore", "main.go", "sub/a.go"}},
+		{name: "ワークツリーのサブディレクトリ", base: filepath.Join(worktree, "sub"), expect: []string{"a.go"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			files, _, err := findFlattenFiles(tc.base, FlattenOptions{DepthLimit: 10, Hidden: true})
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			var actual []string
+			for _, file := range files {
+				rel, err := filepath.Rel(tc.base, file)
+				if err != nil {
+					t.Fatal(err)
+				}
+				actual = append(actual, filepath.ToSlash(rel))
+			}
+			if strings.Join(actual, " ") != strings.Join(tc.expect, " ") {
+				t.Errorf("収集したファイルが期待通りではありません。\n期待: %v\n実際: %v", tc.expect, actual)
+			}
+		})
+	}
+
+	// core.excludesFile はカレントディレクトリではなく、探索するリポジトリの設定を使用する
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("gitがインストールされていません")
+	}
+	repo := t.TempDir()
+	excludes := filepath.Join(t.TempDir(), "excludes")
+	writeTestFiles(t, filepath.Dir(excludes), map[string]string{"excludes": "*.secret\n"})
+	gitForTest(t, repo, "init", "-q")
+	gitForTest(t, repo, "config", "core.excludesFile", excludes)
+	writeTestFiles(t, repo, map[string]string{"main.go": "package main\n", "token.secret": "x\n"})
+
+	files, _, err := findFlattenFiles(repo, FlattenOptions{DepthLimit: 10})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(files) != 1 || filepath.Base(files[0]) != "main.go" {
+		t.Errorf("リポジトリの core.excludesFile が適用されていません: %v", files)
+	}
+}
@@ -2,16 +2,29 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+	"gopkg.in/yaml.v3"
 )
 
 // BedrockClientAPI はBedrock APIのインターフェースです（テスト用にモック可能）
 type BedrockClientAPI interface {
 	ListFoundationModels(ctx context.Context, params *bedrock.ListFoundationModelsInput, optFns ...func(*bedrock.Options)) (*bedrock.ListFoundationModelsOutput, error)
+	GetFoundationModel(ctx context.Context, params *bedrock.GetFoundationModelInput, optFns ...func(*bedrock.Options)) (*bedrock.GetFoundationModelOutput, error)
+	ListInferenceProfiles(ctx context.Context, params *bedrock.ListInferenceProfilesInput, optFns ...func(*bedrock.Options)) (*bedrock.ListInferenceProfilesOutput, error)
+	GetInferenceProfile(ctx context.Context, params *bedrock.GetInferenceProfileInput, optFns ...func(*bedrock.Options)) (*bedrock.GetInferenceProfileOutput, error)
+	ListProvisionedModelThroughputs(ctx context.Context, params *bedrock.ListProvisionedModelThroughputsInput, optFns ...func(*bedrock.Options)) (*bedrock.ListProvisionedModelThroughputsOutput, error)
+	GetProvisionedModelThroughput(ctx context.Context, params *bedrock.GetProvisionedModelThroughputInput, optFns ...func(*bedrock.Options)) (*bedrock.GetProvisionedModelThroughputOutput, error)
 }
 
 // デフォルトのBedrockクライアント生成関数
@@ -19,43 +32,417 @@ var newBedrockClient = func(cfg interface{}) BedrockClientAPI {
 	return bedrock.NewFromConfig(cfg.(aws.Config))
 }
 
-// ListModels は、利用可能なLLMモデルの一覧を表示する関数です
-func ListModels() error {
+// モデル一覧の出力形式
+const (
+	ListOutputTable = "table" // 表形式（デフォルト）
+	ListOutputJSON  = "json"  // JSON形式
+	ListOutputYAML  = "yaml"  // YAML形式
+	ListOutputIDs   = "ids"   // モデルIDのみを1行ずつ
+)
+
+// モデル一覧の並べ替えのキー
+var listSortKeys = []string{"id", "name", "provider"}
+
+// ListOptions は、モデル一覧の絞り込みと並べ替え、出力形式を定義する構造体です
+// キャッシュを使用できるよう、モデル一覧はすべて取得してから絞り込みます
+type ListOptions struct {
+	Provider       string // プロバイダー名（大文字小文字を区別しない）
+	OutputModality string // 出力モダリティ（TEXT、IMAGE、EMBEDDINGなど）
+	InputModality  string // 入力モダリティ（TEXT、IMAGEなど）
+	InferenceType  string // 推論タイプ（ON_DEMAND または PROVISIONED）
+	Customization  string // カスタマイズの種類（FINE_TUNINGなど）
+	SortBy         string // 並べ替えのキー（id、name、provider。空の場合はid）
+	Format         string // 出力形式（table、json、yaml、ids。空の場合はtable）
+	CheckAccess    bool   // アカウントでのモデルアクセスの状態を取得するかどうか
+	Profiles       bool   // 基盤モデルの代わりに推論プロファイルを一覧表示するかどうか
+	Provisioned    bool   // 基盤モデルの代わりにプロビジョンドスループットを一覧表示するかどうか
+
+	CacheTTL  time.Duration // モデル一覧のキャッシュの有効期限（0の場合はキャッシュを使用しない）
+	Refresh   bool          // キャッシュが有効期限内でもAPIから取得し直すかどうか
+	CacheOnly bool          // APIを呼び出さず、期限切れを含めてキャッシュのみを使用するかどうか（シェル補完用）
+
+	Output    io.Writer // 出力先（nilの場合は標準出力）
+	ErrOutput io.Writer // 警告の出力先（nilの場合は標準エラー出力）
+}
+
+// output は、一覧の出力先を返します
+func (opts ListOptions) output() io.Writer {
+	if opts.Output == nil {
+		return os.Stdout
+	}
+	return opts.Output
+}
+
+// errOutput は、警告の出力先を返します
+func (opts ListOptions) errOutput() io.Writer {
+	if opts.ErrOutput == nil {
+		return os.Stderr
+	}
+	return opts.ErrOutput
+}
+
+// hiracliでの対応状況
+const (
+	SupportInvoke      = "invoke"      // モデルファミリーがあり、InvokeModelとConverse APIで呼び出せる
+	SupportConverse    = "converse"    // モデルファミリーがないため、Converse APIでのみ呼び出せる
+	SupportUnsupported = "unsupported" // テキストを生成しないため、hiracliでは扱えない
+)
+
+// ModelInfo は、一覧に表示するモデルの情報を定義する構造体です
+type ModelInfo struct {
+	ID               string   `json:"model_id" yaml:"model_id"`
+	Name             string   `json:"name" yaml:"name"`
+	Provider         string   `json:"provider" yaml:"provider"`
+	InputModalities  []string `json:"input_modalities" yaml:"input_modalities"`
+	OutputModalities []string `json:"output_modalities" yaml:"output_modalities"`
+	InferenceTypes   []string `json:"inference_types" yaml:"inference_types"`
+	Customizations   []string `json:"customizations,omitempty" yaml:"customizations,omitempty"`
+	Streaming        bool     `json:"streaming" yaml:"streaming"`
+	Lifecycle        string   `json:"lifecycle,omitempty" yaml:"lifecycle,omitempty"` // ACTIVE または LEGACY
+	Support          string   `json:"support" yaml:"support"`                         // hiracliでの対応状況
+	Family           string   `json:"family,omitempty" yaml:"family,omitempty"`       // InvokeModelで使用するモデルファミリー
+	Access           string   `json:"access,omitempty" yaml:"access,omitempty"`       // モデルアクセスの状態（CheckAccessの場合のみ）
+}
+
+// Validate は、絞り込みの条件と出力形式を検証し、大文字小文字を正規化します
+func (opts *ListOptions) Validate() error {
+	opts.OutputModality = strings.ToUpper(opts.OutputModality)
+	opts.InputModality = strings.ToUpper(opts.InputModality)
+	opts.InferenceType = strings.ToUpper(strings.ReplaceAll(opts.InferenceType, "-", "_"))
+	opts.Customization = strings.ToUpper(strings.ReplaceAll(opts.Customization, "-", "_"))
+
+	if opts.InferenceType != "" && !containsEnum(types.InferenceType("").Values(), opts.InferenceType) {
+		return fmt.Errorf("不明な推論タイプです: %s（%s のいずれかを指定してください）", opts.InferenceType, joinEnum(types.InferenceType("").Values()))
+	}
+	if opts.Customization != "" && !containsEnum(types.ModelCustomization("").Values(), opts.Customization) {
+		return fmt.Errorf("不明なカスタマイズの種類です: %s（%s のいずれかを指定してください）", opts.Customization, joinEnum(types.ModelCustomization("").Values()))
+	}
+	if opts.SortBy != "" && !containsEnum(listSortKeys, opts.SortBy) {
+		return fmt.Errorf("不明な並べ替えのキーです: %s（%s のいずれかを指定してください）", opts.SortBy, strings.Join(listSortKeys, ", "))
+	}
+	switch opts.Format {
+	case "", ListOutputTable, ListOutputJSON, ListOutputYAML, ListOutputIDs:
+	default:
+		return fmt.Errorf("不明な出力形式です: %s（table, json, yaml, ids のいずれかを指定してください）", opts.Format)
+	}
+
+	// 推論プロファイルとプロビジョンドスループットはアカウントごとに異なるため、キャッシュせずに取得する
+	if opts.Profiles || opts.Provisioned {
+		switch {
+		case opts.Profiles && opts.Provisioned:
+			return fmt.Errorf("推論プロファイルとプロビジョンドスループットは同時に一覧表示できません")
+		case opts.OutputModality != "" || opts.InputModality != "" || opts.InferenceType != "" || opts.Customization != "":
+			return fmt.Errorf("推論プロファイルとプロビジョンドスループットはモダリティ・推論タイプ・カスタマイズで絞り込めません（プロバイダーでのみ絞り込めます）")
+		case opts.CheckAccess || opts.CacheOnly:
+			return fmt.Errorf("推論プロファイルとプロビジョンドスループットではモデルアクセスの状態とキャッシュを使用できません")
+		}
+	}
+	return nil
+}
+
+// ListModels は、利用可能なLLMモデルの一覧を絞り込み、並べ替えて表示する関数です
+// 各モデルには、hiracliでの対応状況とライフサイクル、指定された場合はモデルアクセスの状態を付けます
+func ListModels(ctx context.Context, clientOpts ClientOptions, opts ListOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if clientOpts.ErrOutput == nil {
+		clientOpts.ErrOutput = opts.ErrOutput
+	}
+
+	ctx, cancel := withTimeout(ctx, clientOpts)
+	defer cancel()
+
 	// AWSの設定を読み込み
-	cfg, err := config.LoadDefaultConfig(context.TODO())
+	cfg, err := loadAWSConfig(ctx, clientOpts)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case opts.Profiles:
+		return listInferenceProfiles(ctx, newBedrockClient(cfg), clientOpts, opts)
+	case opts.Provisioned:
+		return listProvisionedModels(ctx, newBedrockClient(cfg), clientOpts, opts)
+	}
+
+	models, err := loadModels(ctx, cfg, clientOpts, opts)
+	if err != nil {
+		return err
+	}
+
+	models = filterModels(models, opts)
+	if opts.CheckAccess {
+		annotateAccess(ctx, newModelAccessClient(cfg), clientOpts, models, opts.errOutput())
+	}
+	sortModels(models, opts.SortBy)
+	return writeModels(opts.output(), models, opts.Format, opts.CheckAccess)
+}
+
+// loadModels は、キャッシュまたはAPIからモデルの一覧を取得する関数です
+// キャッシュを使用しない場合は、APIで絞り込める条件を指定して取得します
+// キャッシュを使用する場合は、リージョンのすべてのモデルを取得してキャッシュを更新します（キャッシュの更新に失敗しても一覧は表示します）
+func loadModels(ctx context.Context, cfg aws.Config, clientOpts ClientOptions, opts ListOptions) ([]ModelInfo, error) {
+	if opts.CacheTTL <= 0 && !opts.CacheOnly {
+		return fetchModels(ctx, cfg, clientOpts, listModelsInput(opts))
+	}
+
+	cache, err := DefaultModelCache(cfg.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CacheOnly {
+		models, _, err := cache.Load()
+		if err != nil {
+			return nil, err
+		}
+		if models == nil {
+			return nil, fmt.Errorf("モデル一覧のキャッシュがありません（hiracli llm list で作成できます）")
+		}
+		return models, nil
+	}
+
+	if !opts.Refresh {
+		models, err := cache.LoadFresh(opts.CacheTTL, time.Now())
+		if err != nil {
+			fmt.Fprintf(opts.errOutput(), "警告: %v\n", err)
+		}
+		if models != nil {
+			return models, nil
+		}
+	}
+
+	models, err := fetchModels(ctx, cfg, clientOpts, &bedrock.ListFoundationModelsInput{})
 	if err != nil {
-		return fmt.Errorf("AWS設定の読み込みエラー: %v", err)
+		return nil, err
+	}
+	if err := cache.Save(cfg.Region, models, time.Now()); err != nil {
+		fmt.Fprintf(opts.errOutput(), "警告: %v\n", err)
+	}
+	return models, nil
+}
+
+// listModelsInput は、APIで絞り込める条件を指定したモデル一覧の取得のリクエストを作成する関数です
+// 入力モダリティはAPIで絞り込めないため、filterModelsで絞り込みます
+func listModelsInput(opts ListOptions) *bedrock.ListFoundationModelsInput {
+	input := &bedrock.ListFoundationModelsInput{
+		ByOutputModality:    types.ModelModality(opts.OutputModality),
+		ByInferenceType:     types.InferenceType(opts.InferenceType),
+		ByCustomizationType: types.ModelCustomization(opts.Customization),
 	}
+	if opts.Provider != "" {
+		input.ByProvider = aws.String(opts.Provider)
+	}
+	return input
+}
 
+// fetchModels は、APIでモデルの一覧を取得する関数です
+func fetchModels(ctx context.Context, cfg aws.Config, clientOpts ClientOptions, input *bedrock.ListFoundationModelsInput) ([]ModelInfo, error) {
 	// Bedrockクライアントの作成
 	bedrockClient := newBedrockClient(cfg)
 
-	// 利用可能なモデルの取得
-	output, err := bedrockClient.ListFoundationModels(context.TODO(), &bedrock.ListFoundationModelsInput{})
+	// 利用可能なモデルの取得（一時的なエラーの場合は再試行）
+	var output *bedrock.ListFoundationModelsOutput
+	err := withRetry(ctx, clientOpts, func(ctx context.Context) error {
+		var err error
+		output, err = bedrockClient.ListFoundationModels(ctx, input)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("モデル一覧の取得エラー: %v", err)
+		return nil, callError(ctx, clientOpts, "モデル一覧の取得", err)
 	}
 
-	// モデル情報の表示
-	fmt.Println("\n利用可能なLLMモデル:")
-	for _, model := range output.ModelSummaries {
-		fmt.Printf("\nモデル: %s\n", *model.ModelId)
-		if model.ModelName != nil {
-			fmt.Printf("名前: %s\n", *model.ModelName)
+	models := make([]ModelInfo, 0, len(output.ModelSummaries))
+	for _, summary := range output.ModelSummaries {
+		models = append(models, newModelInfo(summary))
+	}
+	return models, nil
+}
+
+// newModelInfo は、APIのモデルの概要から一覧に表示する情報を作成する関数です
+func newModelInfo(summary types.FoundationModelSummary) ModelInfo {
+	info := ModelInfo{
+		ID:               aws.ToString(summary.ModelId),
+		Name:             aws.ToString(summary.ModelName),
+		Provider:         aws.ToString(summary.ProviderName),
+		InputModalities:  enumStrings(summary.InputModalities),
+		OutputModalities: enumStrings(summary.OutputModalities),
+		InferenceTypes:   enumStrings(summary.InferenceTypesSupported),
+		Customizations:   enumStrings(summary.CustomizationsSupported),
+		Streaming:        aws.ToBool(summary.ResponseStreamingSupported),
+	}
+	if summary.ModelLifecycle != nil {
+		info.Lifecycle = string(summary.ModelLifecycle.Status)
+	}
+	info.Support, info.Family = modelSupport(info)
+	return info
+}
+
+// modelSupport は、モデルのhiracliでの対応状況と、InvokeModelで使用するモデルファミリーを返す関数です
+func modelSupport(model ModelInfo) (string, string) {
+	if !containsEnum(model.OutputModalities, string(types.ModelModalityText)) {
+		return SupportUnsupported, ""
+	}
+	family, err := FindModelFamily(model.ID)
+	if err != nil {
+		return SupportConverse, ""
+	}
+	return SupportInvoke, family.Name()
+}
+
+// filterModels は、指定された条件でモデルを絞り込む関数です
+func filterModels(models []ModelInfo, opts ListOptions) []ModelInfo {
+	filtered := models[:0]
+	for _, model := range models {
+		switch {
+		case opts.Provider != "" && !strings.EqualFold(model.Provider, opts.Provider):
+		case opts.OutputModality != "" && !containsEnum(model.OutputModalities, opts.OutputModality):
+		case opts.InputModality != "" && !containsEnum(model.InputModalities, opts.InputModality):
+		case opts.InferenceType != "" && !containsEnum(model.InferenceTypes, opts.InferenceType):
+		case opts.Customization != "" && !containsEnum(model.Customizations, opts.Customization):
+		default:
+			filtered = append(filtered, model)
 		}
-		if model.ProviderName != nil {
-			fmt.Printf("プロバイダー: %s\n", *model.ProviderName)
+	}
+	return filtered
+}
+
+// sortModels は、指定したキーでモデルを並べ替える関数です
+// キーが同じ場合はモデルIDの順に並べます
+func sortModels(models []ModelInfo, sortBy string) {
+	sortList(models, sortBy, func(model ModelInfo) (string, string, string) {
+		return model.ID, model.Name, model.Provider
+	})
+}
+
+// sortList は、一覧をid・name・providerのいずれかのキーで並べ替える関数です
+// キーが同じ場合はidの順に並べます
+func sortList[T any](items []T, sortBy string, keys func(T) (id, name, provider string)) {
+	key := func(item T) string {
+		id, name, provider := keys(item)
+		switch sortBy {
+		case "name":
+			return strings.ToLower(name)
+		case "provider":
+			return strings.ToLower(provider)
 		}
-		if model.InputModalities != nil {
-			fmt.Printf("入力モダリティ: %v\n", model.InputModalities)
+		return id
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		if ki, kj := key(items[i]), key(items[j]); ki != kj {
+			return ki < kj
 		}
-		if model.OutputModalities != nil {
-			fmt.Printf("出力モダリティ: %v\n", model.OutputModalities)
+		idI, _, _ := keys(items[i])
+		idJ, _, _ := keys(items[j])
+		return idI < idJ
+	})
+}
+
+// writeModels は、モデルの一覧を指定した形式で出力する関数です
+// 表形式では、withAccessの場合のみモデルアクセスの列を表示します
+func writeModels(w io.Writer, models []ModelInfo, format string, withAccess bool) error {
+	header := "MODEL ID\tNAME\tPROVIDER\tINPUT\tOUTPUT\tINFERENCE\tLIFECYCLE\tHIRACLI"
+	if withAccess {
+		header += "\tACCESS"
+	}
+	return writeList(w, models, format, header, func(model ModelInfo) string {
+		return model.ID
+	}, func(model ModelInfo) []string {
+		row := []string{
+			model.ID,
+			model.Name,
+			model.Provider,
+			strings.Join(model.InputModalities, ","),
+			strings.Join(model.OutputModalities, ","),
+			strings.Join(model.InferenceTypes, ","),
+			valueOrDash(model.Lifecycle),
+			supportLabel(model.Support, model.Family),
 		}
-		if len(model.CustomizationsSupported) > 0 {
-			fmt.Printf("カスタマイズ可能: %v\n", model.CustomizationsSupported)
+		if withAccess {
+			row = append(row, valueOrDash(model.Access))
 		}
-	}
+		return row
+	})
+}
 
+// writeList は、一覧を指定した形式で出力する関数です
+// idsの場合はidの値を1行ずつ、表形式の場合は見出しとrowの値を出力します
+func writeList[T any](w io.Writer, items []T, format, header string, id func(T) string, row func(T) []string) error {
+	switch format {
+	case ListOutputJSON:
+		// 空の一覧もnullではなく空の配列として出力する
+		if items == nil {
+			items = []T{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(items); err != nil {
+			return fmt.Errorf("一覧の出力エラー: %v", err)
+		}
+	case ListOutputYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(items); err != nil {
+			return fmt.Errorf("一覧の出力エラー: %v", err)
+		}
+		return encoder.Close()
+	case ListOutputIDs:
+		for _, item := range items {
+			fmt.Fprintln(w, id(item))
+		}
+	default:
+		// 全角文字はtabwriterで桁が揃わないため、見出しは英字で出力する
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, header)
+		for _, item := range items {
+			fmt.Fprintln(tw, strings.Join(row(item), "\t"))
+		}
+		return tw.Flush()
+	}
 	return nil
 }
+
+// supportLabel は、表形式で表示するhiracliでの対応状況を返します
+// InvokeModelで呼び出せる場合はモデルファミリー名を表示します
+func supportLabel(support, family string) string {
+	switch support {
+	case SupportInvoke:
+		return family
+	case SupportConverse:
+		return SupportConverse
+	}
+	return "-"
+}
+
+// valueOrDash は、空の値を "-" として返します
+func valueOrDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// enumStrings は、APIの列挙型のスライスを文字列のスライスに変換する関数です
+func enumStrings[T ~string](values []T) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		result = append(result, string(value))
+	}
+	return result
+}
+
+// containsEnum は、列挙型のスライスに値が含まれるかを返す関数です
+func containsEnum[T ~string](values []T, value string) bool {
+	for _, v := range values {
+		if string(v) == value {
+			return true
+		}
+	}
+	return false
+}
+
+// joinEnum は、列挙型の値をカンマ区切りで連結する関数です
+func joinEnum[T ~string](values []T) string {
+	return strings.Join(enumStrings(values), ", ")
+}
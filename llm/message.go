@@ -0,0 +1,112 @@
+package llm
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// メッセージの送信者を表すロール
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// コンテンツブロックの種類
+const (
+	BlockText       = "text"
+	BlockImage      = "image"
+	BlockDocument   = "document"
+	BlockToolUse    = "tool_use"
+	BlockToolResult = "tool_result"
+)
+
+// ContentBlock は、メッセージを構成するコンテンツブロックを定義する構造体です
+// Typeに応じて使用するフィールドが異なります
+type ContentBlock struct {
+	Type      string          `json:"type"`
+	Text      string          `json:"text,omitempty"`        // text、tool_result: テキスト
+	Format    string          `json:"format,omitempty"`      // image、document: 形式（png、pdfなど）
+	Name      string          `json:"name,omitempty"`        // document: ファイル名、tool_use: ツール名
+	Data      []byte          `json:"data,omitempty"`        // image、document: ファイルの内容
+	ToolUseID string          `json:"tool_use_id,omitempty"` // tool_use、tool_result: ツール呼び出しのID
+	Input     json.RawMessage `json:"input,omitempty"`       // tool_use: ツールへの入力（JSON）
+	IsError   bool            `json:"is_error,omitempty"`    // tool_result: ツールの実行に失敗した場合にtrue
+}
+
+// TextBlock は、テキストのコンテンツブロックを作成する関数です
+func TextBlock(text string) ContentBlock {
+	return ContentBlock{Type: BlockText, Text: text}
+}
+
+// ImageBlock は、画像のコンテンツブロックを作成する関数です
+func ImageBlock(format string, data []byte) ContentBlock {
+	return ContentBlock{Type: BlockImage, Format: format, Data: data}
+}
+
+// DocumentBlock は、ドキュメントのコンテンツブロックを作成する関数です
+func DocumentBlock(name, format string, data []byte) ContentBlock {
+	return ContentBlock{Type: BlockDocument, Name: name, Format: format, Data: data}
+}
+
+// ToolUseBlock は、モデルによるツール呼び出しのコンテンツブロックを作成する関数です
+func ToolUseBlock(id, name string, input json.RawMessage) ContentBlock {
+	return ContentBlock{Type: BlockToolUse, ToolUseID: id, Name: name, Input: input}
+}
+
+// ToolResultBlock は、ツールの実行結果のコンテンツブロックを作成する関数です
+func ToolResultBlock(toolUseID, text string, isError bool) ContentBlock {
+	return ContentBlock{Type: BlockToolResult, ToolUseID: toolUseID, Text: text, IsError: isError}
+}
+
+// Message は、会話の1メッセージを定義する構造体です
+// テキストのみのメッセージはContentだけを使用し、画像やツール呼び出しを含む場合はBlocksも使用します
+type Message struct {
+	Role    string         `json:"role"`             // RoleUser または RoleAssistant
+	Content string         `json:"content"`          // メッセージ本文（テキストブロックを連結したもの）
+	Blocks  []ContentBlock `json:"blocks,omitempty"` // テキスト以外を含む場合のコンテンツブロック
+}
+
+// NewMessage は、コンテンツブロックからメッセージを作成する関数です
+// テキストのみの場合はBlocksを使用せず、Contentにテキストを設定します
+func NewMessage(role string, blocks ...ContentBlock) Message {
+	message := Message{Role: role, Content: blocksText(blocks)}
+	for _, block := range blocks {
+		if block.Type != BlockText {
+			message.Blocks = blocks
+			break
+		}
+	}
+	return message
+}
+
+// ContentBlocks は、メッセージのコンテンツブロックを返します
+func (m Message) ContentBlocks() []ContentBlock {
+	if len(m.Blocks) > 0 {
+		return m.Blocks
+	}
+	if m.Content == "" {
+		return nil
+	}
+	return []ContentBlock{TextBlock(m.Content)}
+}
+
+// HasNonText は、メッセージにテキスト以外のコンテンツブロックが含まれるかを返します
+func (m Message) HasNonText() bool {
+	for _, block := range m.Blocks {
+		if block.Type != BlockText {
+			return true
+		}
+	}
+	return false
+}
+
+// blocksText は、コンテンツブロックのうちテキストを連結して返す関数です
+func blocksText(blocks []ContentBlock) string {
+	var text strings.Builder
+	for _, block := range blocks {
+		if block.Type == BlockText {
+			text.WriteString(block.Text)
+		}
+	}
+	return text.String()
+}
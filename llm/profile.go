@@ -0,0 +1,256 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+)
+
+// InferenceProfileInfo は、一覧に表示する推論プロファイルの情報を定義する構造体です
+type InferenceProfileInfo struct {
+	ID      string   `json:"inference_profile_id" yaml:"inference_profile_id"`
+	ARN     string   `json:"arn" yaml:"arn"`
+	Name    string   `json:"name" yaml:"name"`
+	Type    string   `json:"type" yaml:"type"`     // SYSTEM_DEFINED または APPLICATION
+	Status  string   `json:"status" yaml:"status"` // ACTIVE
+	Models  []string `json:"models" yaml:"models"` // 推論プロファイルが呼び出すモデルID（重複を除いたもの）
+	Support string   `json:"support" yaml:"support"`
+	Family  string   `json:"family,omitempty" yaml:"family,omitempty"`
+}
+
+// Identifier は、--llm に指定する推論プロファイルの識別子を返します
+// アプリケーション推論プロファイルのIDからはモデルを判別できないため、ARNを返します
+func (p InferenceProfileInfo) Identifier() string {
+	if p.Type == string(types.InferenceProfileTypeApplication) {
+		return p.ARN
+	}
+	return p.ID
+}
+
+// ProvisionedModelInfo は、一覧に表示するプロビジョンドスループットの情報を定義する構造体です
+type ProvisionedModelInfo struct {
+	Name                 string     `json:"name" yaml:"name"`
+	ARN                  string     `json:"arn" yaml:"arn"`
+	Model                string     `json:"model_id" yaml:"model_id"`                                     // 元になる基盤モデルのID
+	CustomModel          string     `json:"custom_model_arn,omitempty" yaml:"custom_model_arn,omitempty"` // カスタムモデルの場合はそのARN
+	Status               string     `json:"status" yaml:"status"`                                         // Creating、InService、Updating、Failed
+	ModelUnits           int32      `json:"model_units" yaml:"model_units"`
+	Commitment           string     `json:"commitment,omitempty" yaml:"commitment,omitempty"` // OneMonth または SixMonths（契約なしの場合は空）
+	CommitmentExpiration *time.Time `json:"commitment_expiration,omitempty" yaml:"commitment_expiration,omitempty"`
+	Support              string     `json:"support" yaml:"support"`
+	Family               string     `json:"family,omitempty" yaml:"family,omitempty"`
+}
+
+// listInferenceProfiles は、システム定義とアプリケーションの推論プロファイルを一覧表示する関数です
+func listInferenceProfiles(ctx context.Context, bedrockClient BedrockClientAPI, clientOpts ClientOptions, opts ListOptions) error {
+	var profiles []InferenceProfileInfo
+	input := &bedrock.ListInferenceProfilesInput{}
+	for {
+		var output *bedrock.ListInferenceProfilesOutput
+		err := withRetry(ctx, clientOpts, func(ctx context.Context) error {
+			var err error
+			output, err = bedrockClient.ListInferenceProfiles(ctx, input)
+			return err
+		})
+		if err != nil {
+			return callError(ctx, clientOpts, "推論プロファイル一覧の取得", err)
+		}
+		for _, summary := range output.InferenceProfileSummaries {
+			profile := newInferenceProfileInfo(summary)
+			if matchProvider(opts.Provider, profile.Models...) {
+				profiles = append(profiles, profile)
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	sortList(profiles, opts.SortBy, func(p InferenceProfileInfo) (string, string, string) {
+		return p.Identifier(), p.Name, strings.Join(p.Models, ",")
+	})
+	return writeList(opts.output(), profiles, opts.Format, "PROFILE\tNAME\tTYPE\tSTATUS\tMODEL\tHIRACLI", InferenceProfileInfo.Identifier, func(p InferenceProfileInfo) []string {
+		return []string{p.Identifier(), p.Name, p.Type, p.Status, valueOrDash(strings.Join(p.Models, ",")), supportLabel(p.Support, p.Family)}
+	})
+}
+
+// newInferenceProfileInfo は、APIの推論プロファイルの概要から一覧に表示する情報を作成する関数です
+func newInferenceProfileInfo(summary types.InferenceProfileSummary) InferenceProfileInfo {
+	profile := InferenceProfileInfo{
+		ID:     aws.ToString(summary.InferenceProfileId),
+		ARN:    aws.ToString(summary.InferenceProfileArn),
+		Name:   aws.ToString(summary.InferenceProfileName),
+		Type:   string(summary.Type),
+		Status: string(summary.Status),
+	}
+
+	// 同じモデルが複数のリージョンのARNとして含まれるため、モデルIDの重複を除く
+	seen := map[string]bool{}
+	for _, model := range summary.Models {
+		id := BaseModelID(aws.ToString(model.ModelArn))
+		if id != "" && !seen[id] {
+			seen[id] = true
+			profile.Models = append(profile.Models, id)
+		}
+	}
+	if len(profile.Models) > 0 {
+		profile.Support, profile.Family = underlyingModelSupport(profile.Models[0])
+	} else {
+		profile.Support = SupportUnsupported
+	}
+	return profile
+}
+
+// listProvisionedModels は、プロビジョンドスループットを一覧表示する関数です
+func listProvisionedModels(ctx context.Context, bedrockClient BedrockClientAPI, clientOpts ClientOptions, opts ListOptions) error {
+	var provisioned []ProvisionedModelInfo
+	input := &bedrock.ListProvisionedModelThroughputsInput{}
+	for {
+		var output *bedrock.ListProvisionedModelThroughputsOutput
+		err := withRetry(ctx, clientOpts, func(ctx context.Context) error {
+			var err error
+			output, err = bedrockClient.ListProvisionedModelThroughputs(ctx, input)
+			return err
+		})
+		if err != nil {
+			return callError(ctx, clientOpts, "プロビジョンドスループット一覧の取得", err)
+		}
+		for _, summary := range output.ProvisionedModelSummaries {
+			model := newProvisionedModelInfo(summary)
+			if matchProvider(opts.Provider, model.Model) {
+				provisioned = append(provisioned, model)
+			}
+		}
+		if output.NextToken == nil {
+			break
+		}
+		input.NextToken = output.NextToken
+	}
+
+	sortList(provisioned, opts.SortBy, func(p ProvisionedModelInfo) (string, string, string) {
+		return p.ARN, p.Name, p.Model
+	})
+	return writeList(opts.output(), provisioned, opts.Format, "NAME\tARN\tMODEL\tSTATUS\tUNITS\tCOMMITMENT\tHIRACLI", func(p ProvisionedModelInfo) string {
+		return p.ARN
+	}, func(p ProvisionedModelInfo) []string {
+		return []string{p.Name, p.ARN, p.Model, p.Status, strconv.Itoa(int(p.ModelUnits)), valueOrDash(p.Commitment), supportLabel(p.Support, p.Family)}
+	})
+}
+
+// newProvisionedModelInfo は、APIのプロビジョンドスループットの概要から一覧に表示する情報を作成する関数です
+func newProvisionedModelInfo(summary types.ProvisionedModelSummary) ProvisionedModelInfo {
+	model := ProvisionedModelInfo{
+		Name:                 aws.ToString(summary.ProvisionedModelName),
+		ARN:                  aws.ToString(summary.ProvisionedModelArn),
+		Model:                BaseModelID(aws.ToString(summary.FoundationModelArn)),
+		Status:               string(summary.Status),
+		ModelUnits:           aws.ToInt32(summary.ModelUnits),
+		Commitment:           string(summary.CommitmentDuration),
+		CommitmentExpiration: summary.CommitmentExpirationTime,
+	}
+	if modelARN := aws.ToString(summary.ModelArn); modelARN != aws.ToString(summary.FoundationModelArn) {
+		model.CustomModel = modelARN
+	}
+	model.Support, model.Family = underlyingModelSupport(model.Model)
+	return model
+}
+
+// underlyingModelSupport は、推論プロファイルやプロビジョンドスループットの元になるモデルの、hiracliでの対応状況を返す関数です
+// 出力モダリティはわからないため、モデルファミリーがないモデルはConverse APIで呼び出せるものとします
+func underlyingModelSupport(modelID string) (string, string) {
+	family, err := FindModelFamily(modelID)
+	if err != nil {
+		return SupportConverse, ""
+	}
+	return SupportInvoke, family.Name()
+}
+
+// matchProvider は、モデルIDのいずれかがプロバイダーのモデルかを返す関数です
+// モデルIDの先頭はプロバイダー名の最初の単語を小文字にしたもの（例: Mistral AI → mistral.）です
+func matchProvider(provider string, modelIDs ...string) bool {
+	words := strings.Fields(provider)
+	if len(words) == 0 {
+		return true
+	}
+	prefix := strings.ToLower(words[0]) + "."
+	for _, id := range modelIDs {
+		if strings.HasPrefix(id, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// modelIDFromARN は、基盤モデルとシステム定義の推論プロファイルのARNからモデルIDを取り出す関数です
+// それ以外のARNの場合はそのまま返します
+func modelIDFromARN(value string) string {
+	parsed, err := arn.Parse(value)
+	if err != nil || parsed.Service != "bedrock" {
+		return value
+	}
+	resourceType, resourceID, _ := strings.Cut(parsed.Resource, "/")
+	switch resourceType {
+	case "foundation-model", "inference-profile":
+		return resourceID
+	}
+	return value
+}
+
+// resolveModelARN は、アプリケーション推論プロファイルとプロビジョンドスループットのARNを、
+// APIで元の基盤モデルのIDに解決する関数です
+// それ以外のモデルIDやARNの場合は、APIを呼び出さずにBaseModelIDを返します
+func resolveModelARN(ctx context.Context, cfg aws.Config, clientOpts ClientOptions, modelID string) (string, error) {
+	parsed, err := arn.Parse(modelID)
+	if err != nil || parsed.Service != "bedrock" {
+		return BaseModelID(modelID), nil
+	}
+
+	resourceType, _, _ := strings.Cut(parsed.Resource, "/")
+	if resourceType != "application-inference-profile" && resourceType != "provisioned-model" {
+		return BaseModelID(modelID), nil
+	}
+
+	ctx, cancel := withTimeout(ctx, clientOpts)
+	defer cancel()
+
+	bedrockClient := newBedrockClient(cfg)
+	var foundationARN string
+	err = withRetry(ctx, clientOpts, func(ctx context.Context) error {
+		if resourceType == "provisioned-model" {
+			output, err := bedrockClient.GetProvisionedModelThroughput(ctx, &bedrock.GetProvisionedModelThroughputInput{
+				ProvisionedModelId: aws.String(modelID),
+			})
+			if err != nil {
+				return err
+			}
+			foundationARN = aws.ToString(output.FoundationModelArn)
+			return nil
+		}
+
+		output, err := bedrockClient.GetInferenceProfile(ctx, &bedrock.GetInferenceProfileInput{
+			InferenceProfileIdentifier: aws.String(modelID),
+		})
+		if err != nil {
+			return err
+		}
+		if len(output.Models) > 0 {
+			foundationARN = aws.ToString(output.Models[0].ModelArn)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", callError(ctx, clientOpts, "モデルのARNの解決", err)
+	}
+	if foundationARN == "" {
+		return "", fmt.Errorf("モデルのARNから元のモデルを特定できませんでした: %s", modelID)
+	}
+	return BaseModelID(foundationARN), nil
+}
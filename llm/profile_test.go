@@ -0,0 +1,267 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock"
+	"github.com/aws/aws-sdk-go-v2/service/bedrock/types"
+)
+
+// テスト用のARN
+const (
+	testApplicationProfileARN = "arn:aws:bedrock:us-east-1:123456789012:application-inference-profile/a1b2c3d4e5f6"
+	testProvisionedModelARN   = "arn:aws:bedrock:us-east-1:123456789012:provisioned-model/abcd1234"
+)
+
+// テスト用のARNの元になる基盤モデル（モックのBedrockクライアントが返すもの）
+var testModelARNs = map[string]string{
+	testApplicationProfileARN: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+	testProvisionedModelARN:   "anthropic.claude-3-5-sonnet-20240620-v1:0",
+}
+
+// foundationModelARN は、基盤モデルのARNを返します
+func foundationModelARN(region, modelID string) *string {
+	return aws.String("arn:aws:bedrock:" + region + "::foundation-model/" + modelID)
+}
+
+// 推論プロファイル（ダミーデータ、ページごと）
+var mockInferenceProfilePages = [][]types.InferenceProfileSummary{
+	{
+		{
+			InferenceProfileId:   aws.String("us.anthropic.claude-3-5-sonnet-20241022-v2:0"),
+			InferenceProfileArn:  aws.String("arn:aws:bedrock:us-east-1:123456789012:inference-profile/us.anthropic.claude-3-5-sonnet-20241022-v2:0"),
+			InferenceProfileName: aws.String("US Anthropic Claude 3.5 Sonnet v2"),
+			Type:                 types.InferenceProfileTypeSystemDefined,
+			Status:               types.InferenceProfileStatusActive,
+			Models: []types.InferenceProfileModel{
+				{ModelArn: foundationModelARN("us-east-1", "anthropic.claude-3-5-sonnet-20241022-v2:0")},
+				{ModelArn: foundationModelARN("us-west-2", "anthropic.claude-3-5-sonnet-20241022-v2:0")},
+			},
+		},
+		{
+			InferenceProfileId:   aws.String("us.amazon.nova-pro-v1:0"),
+			InferenceProfileArn:  aws.String("arn:aws:bedrock:us-east-1:123456789012:inference-profile/us.amazon.nova-pro-v1:0"),
+			InferenceProfileName: aws.String("US Nova Pro"),
+			Type:                 types.InferenceProfileTypeSystemDefined,
+			Status:               types.InferenceProfileStatusActive,
+			Models:               []types.InferenceProfileModel{{ModelArn: foundationModelARN("us-east-1", "amazon.nova-pro-v1:0")}},
+		},
+	},
+	{
+		{
+			InferenceProfileId:   aws.String("a1b2c3d4e5f6"),
+			InferenceProfileArn:  aws.String(testApplicationProfileARN),
+			InferenceProfileName: aws.String("team-sonnet"),
+			Type:                 types.InferenceProfileTypeApplication,
+			Status:               types.InferenceProfileStatusActive,
+			Models:               []types.InferenceProfileModel{{ModelArn: foundationModelARN("us-east-1", "anthropic.claude-3-5-sonnet-20240620-v1:0")}},
+		},
+	},
+}
+
+// プロビジョンドスループット（ダミーデータ）
+var mockProvisionedModels = []types.ProvisionedModelSummary{
+	{
+		ProvisionedModelName: aws.String("prod-sonnet"),
+		ProvisionedModelArn:  aws.String(testProvisionedModelARN),
+		FoundationModelArn:   foundationModelARN("us-east-1", "anthropic.claude-3-5-sonnet-20240620-v1:0"),
+		ModelArn:             foundationModelARN("us-east-1", "anthropic.claude-3-5-sonnet-20240620-v1:0"),
+		Status:               types.ProvisionedModelStatusInService,
+		ModelUnits:           aws.Int32(1),
+		CommitmentDuration:   types.CommitmentDurationOneMonth,
+	},
+	{
+		ProvisionedModelName: aws.String("custom-titan"),
+		ProvisionedModelArn:  aws.String("arn:aws:bedrock:us-east-1:123456789012:provisioned-model/efgh5678"),
+		FoundationModelArn:   foundationModelARN("us-east-1", "amazon.titan-text-express-v1"),
+		ModelArn:             aws.String("arn:aws:bedrock:us-east-1:123456789012:custom-model/amazon.titan-text-express-v1:0:8k/xyz"),
+		Status:               types.ProvisionedModelStatusCreating,
+		ModelUnits:           aws.Int32(2),
+	},
+}
+
+// ListInferenceProfilesのモックメソッド（2ページに分けて返す）
+func (m *MockBedrockClient) ListInferenceProfiles(ctx context.Context, params *bedrock.ListInferenceProfilesInput, optFns ...func(*bedrock.Options)) (*bedrock.ListInferenceProfilesOutput, error) {
+	if params.NextToken == nil {
+		return &bedrock.ListInferenceProfilesOutput{InferenceProfileSummaries: mockInferenceProfilePages[0], NextToken: aws.String("page2")}, nil
+	}
+	return &bedrock.ListInferenceProfilesOutput{InferenceProfileSummaries: mockInferenceProfilePages[1]}, nil
+}
+
+// GetInferenceProfileのモックメソッド
+func (m *MockBedrockClient) GetInferenceProfile(ctx context.Context, params *bedrock.GetInferenceProfileInput, optFns ...func(*bedrock.Options)) (*bedrock.GetInferenceProfileOutput, error) {
+	for _, page := range mockInferenceProfilePages {
+		for _, profile := range page {
+			if id := aws.ToString(params.InferenceProfileIdentifier); id == *profile.InferenceProfileId || id == *profile.InferenceProfileArn {
+				return &bedrock.GetInferenceProfileOutput{InferenceProfileArn: profile.InferenceProfileArn, Models: profile.Models}, nil
+			}
+		}
+	}
+	return nil, &types.ResourceNotFoundException{Message: params.InferenceProfileIdentifier}
+}
+
+// ListProvisionedModelThroughputsのモックメソッド
+func (m *MockBedrockClient) ListProvisionedModelThroughputs(ctx context.Context, params *bedrock.ListProvisionedModelThroughputsInput, optFns ...func(*bedrock.Options)) (*bedrock.ListProvisionedModelThroughputsOutput, error) {
+	return &bedrock.ListProvisionedModelThroughputsOutput{ProvisionedModelSummaries: mockProvisionedModels}, nil
+}
+
+// GetProvisionedModelThroughputのモックメソッド
+func (m *MockBedrockClient) GetProvisionedModelThroughput(ctx context.Context, params *bedrock.GetProvisionedModelThroughputInput, optFns ...func(*bedrock.Options)) (*bedrock.GetProvisionedModelThroughputOutput, error) {
+	for _, summary := range mockProvisionedModels {
+		if aws.ToString(params.ProvisionedModelId) == *summary.ProvisionedModelArn {
+			return &bedrock.GetProvisionedModelThroughputOutput{
+				ProvisionedModelArn: summary.ProvisionedModelArn,
+				FoundationModelArn:  summary.FoundationModelArn,
+				ModelArn:            summary.ModelArn,
+			}, nil
+		}
+	}
+	return nil, &types.ResourceNotFoundException{Message: params.ProvisionedModelId}
+}
+
+// 推論プロファイルの一覧のテスト
+func TestListInferenceProfiles(t *testing.T) {
+	testCases := []struct {
+		name   string
+		opts   ListOptions
+		expect []string
+	}{
+		{
+			name:   "すべて（ページをたどる）",
+			opts:   ListOptions{Format: ListOutputIDs},
+			expect: []string{testApplicationProfileARN, "us.amazon.nova-pro-v1:0", "us.anthropic.claude-3-5-sonnet-20241022-v2:0"},
+		},
+		{
+			name:   "プロバイダーで絞り込み名前順",
+			opts:   ListOptions{Format: ListOutputIDs, Provider: "Anthropic", SortBy: "name"},
+			expect: []string{testApplicationProfileARN, "us.anthropic.claude-3-5-sonnet-20241022-v2:0"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.opts.Profiles = true
+			output, err := listModelsForTest(t, tc.opts)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if actual := strings.Fields(output); strings.Join(actual, " ") != strings.Join(tc.expect, " ") {
+				t.Errorf("推論プロファイルが期待通りではありません。\n期待: %v\n実際: %v", tc.expect, actual)
+			}
+		})
+	}
+
+	// 表形式では、重複を除いた元のモデルとhiracliでの対応状況を表示する
+	output, err := listModelsForTest(t, ListOptions{Profiles: true})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 && fields[0] == "us.anthropic.claude-3-5-sonnet-20241022-v2:0" {
+			if model, support := fields[len(fields)-2], fields[len(fields)-1]; model != "anthropic.claude-3-5-sonnet-20241022-v2:0" || support != "anthropic" {
+				t.Errorf("推論プロファイルの行が期待通りではありません: %s", line)
+			}
+		}
+		if len(fields) > 0 && fields[0] == "us.amazon.nova-pro-v1:0" && fields[len(fields)-1] != SupportConverse {
+			t.Errorf("推論プロファイルの行が期待通りではありません: %s", line)
+		}
+	}
+}
+
+// プロビジョンドスループットの一覧のテスト
+func TestListProvisionedModels(t *testing.T) {
+	output, err := listModelsForTest(t, ListOptions{Provisioned: true, Format: ListOutputJSON})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	var models []ProvisionedModelInfo
+	if err := json.Unmarshal([]byte(output), &models); err != nil {
+		t.Fatalf("JSONの解析エラー: %v\n%s", err, output)
+	}
+	if len(models) != 2 {
+		t.Fatalf("プロビジョンドスループットの件数が期待通りではありません: %d", len(models))
+	}
+	if m := models[0]; m.ARN != testProvisionedModelARN || m.Model != "anthropic.claude-3-5-sonnet-20240620-v1:0" || m.CustomModel != "" || m.Commitment != "OneMonth" || m.Family != "anthropic" {
+		t.Errorf("プロビジョンドスループットの情報が期待通りではありません: %+v", m)
+	}
+	if m := models[1]; m.Name != "custom-titan" || !strings.Contains(m.CustomModel, "custom-model/") || m.ModelUnits != 2 || m.Family != "titan" {
+		t.Errorf("カスタムモデルのプロビジョンドスループットの情報が期待通りではありません: %+v", m)
+	}
+
+	// 基盤モデルの絞り込みの条件やキャッシュとは組み合わせられない
+	for _, opts := range []ListOptions{
+		{Provisioned: true, Profiles: true},
+		{Provisioned: true, OutputModality: "TEXT"},
+		{Profiles: true, CheckAccess: true},
+	} {
+		if err := opts.Validate(); err == nil {
+			t.Errorf("エラーが期待されましたが、発生しませんでした: %+v", opts)
+		}
+	}
+}
+
+// ARNからのモデルIDの取得のテスト
+func TestBaseModelIDARN(t *testing.T) {
+	testCases := []struct {
+		name    string
+		modelID string
+		expect  string
+	}{
+		{name: "基盤モデルのARN", modelID: "arn:aws:bedrock:us-east-1::foundation-model/anthropic.claude-3-haiku-20240307-v1:0", expect: "anthropic.claude-3-haiku-20240307-v1:0"},
+		{name: "推論プロファイルのARN", modelID: "arn:aws:bedrock:us-east-1:123456789012:inference-profile/eu.meta.llama3-2-3b-instruct-v1:0", expect: "meta.llama3-2-3b-instruct-v1:0"},
+		{name: "プロビジョンドスループットのARN", modelID: "arn:aws:bedrock:us-east-1:123456789012:provisioned-model/unknown", expect: "arn:aws:bedrock:us-east-1:123456789012:provisioned-model/unknown"},
+		{name: "モデルID", modelID: "amazon.titan-text-express-v1", expect: "amazon.titan-text-express-v1"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := BaseModelID(tc.modelID); actual != tc.expect {
+				t.Errorf("モデルIDが期待通りではありません。期待: %s, 実際: %s", tc.expect, actual)
+			}
+		})
+	}
+}
+
+// ARNで指定したモデルへの質問のテスト
+func TestAskModelARN(t *testing.T) {
+	for _, modelARN := range []string{testProvisionedModelARN, testApplicationProfileARN} {
+		t.Run(modelARN, func(t *testing.T) {
+			mockClient := useMockRuntimeClient(t)
+
+			var stdout, stderr bytes.Buffer
+			err := Ask(context.Background(), AskOptions{
+				LLMModel:  modelARN,
+				Prompt:    "AIについて教えてください",
+				NoStream:  true,
+				Output:    &stdout,
+				ErrOutput: &stderr,
+			})
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			// 元のモデルのモデルファミリーでリクエストを構築し、ARNのまま呼び出す
+			if len(mockClient.requests) != 1 || !strings.Contains(mockClient.requests[0], "anthropic_version") {
+				t.Errorf("リクエストが期待通りではありません: %v", mockClient.requests)
+			}
+			if !strings.Contains(stdout.String(), "Anthropic") {
+				t.Errorf("回答が期待通りではありません: %s", stdout.String())
+			}
+			resolved, err := resolveModelARN(context.Background(), aws.Config{}, ClientOptions{}, modelARN)
+			if err != nil || resolved != "anthropic.claude-3-5-sonnet-20240620-v1:0" {
+				t.Errorf("ARNが元のモデルIDに解決されていません: %s, %v", resolved, err)
+			}
+			// 解決した結果はBaseModelIDに影響しない
+			if BaseModelID(modelARN) != modelARN {
+				t.Errorf("解決したARNがBaseModelIDの結果に影響しています: %s", BaseModelID(modelARN))
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package llm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// InferenceParams は、推論パラメータを定義する構造体です
+// ポインタのフィールドがnilの場合や、モデルファミリーが対応していないパラメータは送信しません
+type InferenceParams struct {
+	MaxTokens     int      // 最大出力トークン数（0の場合はデフォルト値）
+	Temperature   *float64 // 温度
+	TopP          *float64 // top-p（nucleus sampling）
+	TopK          *int     // top-k
+	StopSequences []string // 停止シーケンス
+}
+
+// ModelRequest は、モデルファミリーに依存しない共通のリクエスト内容を定義する構造体です
+type ModelRequest struct {
+	System   string          // システムプロンプト（空の場合は指定しない）
+	Messages []Message       // 会話履歴（最後の要素が今回のユーザー入力）
+	Params   InferenceParams // 推論パラメータ
+	Stream   bool            // ストリーミングで呼び出す場合にtrue
+	Tools    []Tool          // モデルに提供するツール（Converseでのみ使用）
+}
+
+// Usage は、モデル呼び出しで使用したトークン数を定義する構造体です
+type Usage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Add は、別の呼び出しのトークン数を加算します
+func (u *Usage) Add(other Usage) {
+	u.InputTokens += other.InputTokens
+	u.OutputTokens += other.OutputTokens
+}
+
+// ModelResponse は、モデルファミリーに依存しない共通のレスポンス内容を定義する構造体です
+type ModelResponse struct {
+	Text       string         // 回答テキスト
+	Blocks     []ContentBlock // テキスト以外のコンテンツブロック（ツールの呼び出しなど）
+	Usage      Usage          // 使用したトークン数（レスポンスに含まれない場合は0）
+	StopReason string         // モデルが返した終了理由
+	Truncated  bool           // 最大出力トークン数に達して回答が途中で終了した場合にtrue
+}
+
+// ModelFamily は、モデルファミリーごとのリクエスト構築とレスポンス解析を行うインターフェースです
+type ModelFamily interface {
+	// Name はモデルファミリー名を返します
+	Name() string
+	// BuildRequest はInvokeModelに渡すリクエストボディを構築します
+	BuildRequest(req ModelRequest) ([]byte, error)
+	// ParseResponse はInvokeModelのレスポンスボディから回答を抽出します
+	ParseResponse(body []byte) (*ModelResponse, error)
+}
+
+// StreamingModelFamily は、ストリーミングレスポンスに対応したモデルファミリーのインターフェースです
+type StreamingModelFamily interface {
+	ModelFamily
+	// ParseStreamChunk はストリーミングレスポンスの1チャンクから回答の差分を抽出します
+	ParseStreamChunk(chunk []byte) (*ModelResponse, error)
+}
+
+// contentBlockModelFamily は、画像やドキュメントを含むメッセージをInvokeModelで送信できるモデルファミリーのインターフェースです
+type contentBlockModelFamily interface {
+	ModelFamily
+	acceptsContentBlocks()
+}
+
+// デフォルトの最大出力トークン数
+const defaultMaxTokens = 1000
+
+// モデルIDのプレフィックスとモデルファミリーの対応表
+var modelFamilies = map[string]ModelFamily{}
+
+// RegisterModelFamily は、モデルIDのプレフィックスに対応するモデルファミリーを登録する関数です
+func RegisterModelFamily(prefix string, family ModelFamily) {
+	modelFamilies[prefix] = family
+}
+
+// クロスリージョン推論プロファイルのIDに付く地域のプレフィックス
+var inferenceProfileRegions = []string{"us.", "us-gov.", "eu.", "apac.", "jp.", "au.", "ca.", "global."}
+
+// BaseModelID は、クロスリージョン推論プロファイルのID（例: us.anthropic.claude-3-5-sonnet-20240620-v1:0）から
+// 地域のプレフィックスを除いたモデルIDを返す関数です。推論プロファイルのIDでない場合はそのまま返します
+// 基盤モデルとシステム定義の推論プロファイルのARNはモデルIDとして扱います
+// アプリケーション推論プロファイルとプロビジョンドスループットのARNは、resolveModelARNで解決してください
+func BaseModelID(modelID string) string {
+	modelID = modelIDFromARN(modelID)
+	for _, region := range inferenceProfileRegions {
+		if strings.HasPrefix(modelID, region) {
+			return strings.TrimPrefix(modelID, region)
+		}
+	}
+	return modelID
+}
+
+// FindModelFamily は、モデルIDに対応するモデルファミリーを検索する関数です
+// 複数のプレフィックスに一致する場合は、最も長いプレフィックスを優先します
+// クロスリージョン推論プロファイルのIDは、元のモデルIDで検索します
+func FindModelFamily(modelID string) (ModelFamily, error) {
+	var matched string
+	for prefix := range modelFamilies {
+		if strings.HasPrefix(BaseModelID(modelID), prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+
+	if matched == "" {
+		return nil, fmt.Errorf("未対応のLLMモデル: %s", modelID)
+	}
+
+	return modelFamilies[matched], nil
+}
+
+// ModelFamilyPrefixes は、登録済みのモデルIDプレフィックスを昇順で返す関数です
+func ModelFamilyPrefixes() []string {
+	prefixes := make([]string, 0, len(modelFamilies))
+	for prefix := range modelFamilies {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+// maxTokensOrDefault は、最大出力トークン数が未指定の場合にデフォルト値を返す関数です
+func maxTokensOrDefault(maxTokens int) int {
+	if maxTokens <= 0 {
+		return defaultMaxTokens
+	}
+	return maxTokens
+}
+
+// Validate は、推論パラメータの値が有効な範囲にあるかを検証する関数です
+func (p InferenceParams) Validate() error {
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("最大出力トークン数は0以上で指定してください: %d", p.MaxTokens)
+	}
+	if p.Temperature != nil && *p.Temperature < 0 {
+		return fmt.Errorf("温度は0以上で指定してください: %g", *p.Temperature)
+	}
+	if p.TopP != nil && (*p.TopP < 0 || *p.TopP > 1) {
+		return fmt.Errorf("top-pは0から1の範囲で指定してください: %g", *p.TopP)
+	}
+	if p.TopK != nil && *p.TopK < 0 {
+		return fmt.Errorf("top-kは0以上で指定してください: %d", *p.TopK)
+	}
+	return nil
+}
+
+// floatOrDefault は、パラメータが未指定の場合にデフォルト値を返す関数です
+func floatOrDefault(value *float64, def float64) float64 {
+	if value == nil {
+		return def
+	}
+	return *value
+}
+
+// lastUserContent は、会話履歴の最後のユーザー入力を返す関数です
+func lastUserContent(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == RoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// withSystemPrompt は、システムプロンプトに対応していないモデル向けに、
+// システムプロンプトをテキストの先頭に付加する関数です
+func withSystemPrompt(system, text string) string {
+	if system == "" {
+		return text
+	}
+	return system + "\n\n" + text
+}
+
+// formatTranscript は、会話履歴をチャット形式に対応していないモデル向けの書き起こし文字列に変換する関数です
+// 単一のユーザー入力のみの場合は、入力をそのまま返します
+// システムプロンプトが指定されている場合は先頭に付加します
+func formatTranscript(system string, messages []Message, userLabel, assistantLabel string) string {
+	if len(messages) == 1 && messages[0].Role == RoleUser {
+		return withSystemPrompt(system, messages[0].Content)
+	}
+
+	var transcript strings.Builder
+	if system != "" {
+		transcript.WriteString(system + "\n\n")
+	}
+	for _, message := range messages {
+		label := userLabel
+		if message.Role == RoleAssistant {
+			label = assistantLabel
+		}
+		transcript.WriteString(label + ": " + message.Content + "\n")
+	}
+	transcript.WriteString(assistantLabel + ":")
+	return transcript.String()
+}
+
+func init() {
+	RegisterModelFamily("anthropic.", anthropicFamily{})
+	RegisterModelFamily("amazon.titan-text", titanFamily{})
+	RegisterModelFamily("meta.llama", llamaFamily{})
+	RegisterModelFamily("mistral.", mistralFamily{})
+	RegisterModelFamily("cohere.command", cohereFamily{})
+	RegisterModelFamily("cohere.command-r", cohereChatFamily{})
+	RegisterModelFamily("ai21.j2", ai21Family{})
+	RegisterModelFamily("ai21.jamba", jambaFamily{})
+}
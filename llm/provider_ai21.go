@@ -0,0 +1,158 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ai21Family は、AI21 Labs Jurassic-2モデルを扱うモデルファミリーです
+type ai21Family struct{}
+
+type ai21Request struct {
+	Prompt        string   `json:"prompt"`
+	MaxTokens     int      `json:"maxTokens"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	TopP          *float64 `json:"topP,omitempty"`
+	StopSequences []string `json:"stopSequences,omitempty"`
+}
+
+type ai21Response struct {
+	Completions []struct {
+		Data struct {
+			Text string `json:"text"`
+		} `json:"data"`
+		FinishReason struct {
+			Reason string `json:"reason"`
+		} `json:"finishReason"`
+	} `json:"completions"`
+}
+
+func (ai21Family) Name() string {
+	return "ai21"
+}
+
+func (ai21Family) BuildRequest(req ModelRequest) ([]byte, error) {
+	return json.Marshal(ai21Request{
+		Prompt:        formatTranscript(req.System, req.Messages, "User", "Assistant"),
+		MaxTokens:     maxTokensOrDefault(req.Params.MaxTokens),
+		Temperature:   req.Params.Temperature,
+		TopP:          req.Params.TopP,
+		StopSequences: req.Params.StopSequences,
+	})
+}
+
+func (ai21Family) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp ai21Response
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	if len(resp.Completions) == 0 {
+		return &ModelResponse{}, nil
+	}
+
+	reason := resp.Completions[0].FinishReason.Reason
+	return &ModelResponse{
+		Text:       resp.Completions[0].Data.Text,
+		StopReason: reason,
+		Truncated:  reason == "length",
+	}, nil
+}
+
+// jambaFamily は、AI21 Labs Jambaモデル（チャット形式）を扱うモデルファミリーです
+type jambaFamily struct{}
+
+type jambaMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type jambaRequest struct {
+	Messages    []jambaMessage `json:"messages"`
+	MaxTokens   int            `json:"max_tokens"`
+	Temperature *float64       `json:"temperature,omitempty"`
+	TopP        *float64       `json:"top_p,omitempty"`
+	Stop        []string       `json:"stop,omitempty"`
+}
+
+type jambaResponse struct {
+	Choices []struct {
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (jambaFamily) Name() string {
+	return "jamba"
+}
+
+func (jambaFamily) BuildRequest(req ModelRequest) ([]byte, error) {
+	messages := make([]jambaMessage, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, jambaMessage{Role: "system", Content: req.System})
+	}
+	for _, message := range req.Messages {
+		messages = append(messages, jambaMessage{Role: message.Role, Content: message.Content})
+	}
+
+	return json.Marshal(jambaRequest{
+		Messages:    messages,
+		MaxTokens:   maxTokensOrDefault(req.Params.MaxTokens),
+		Temperature: req.Params.Temperature,
+		TopP:        req.Params.TopP,
+		Stop:        req.Params.StopSequences,
+	})
+}
+
+func (jambaFamily) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp jambaResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return &ModelResponse{}, nil
+	}
+
+	return &ModelResponse{
+		Text: resp.Choices[0].Message.Content,
+		Usage: Usage{
+			InputTokens:  resp.Usage.PromptTokens,
+			OutputTokens: resp.Usage.CompletionTokens,
+		},
+		StopReason: resp.Choices[0].FinishReason,
+		Truncated:  resp.Choices[0].FinishReason == "length",
+	}, nil
+}
+
+type jambaStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+func (jambaFamily) ParseStreamChunk(chunk []byte) (*ModelResponse, error) {
+	var resp jambaStreamChunk
+	if err := json.Unmarshal(chunk, &resp); err != nil {
+		return nil, fmt.Errorf("チャンクの解析エラー: %v", err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return &ModelResponse{}, nil
+	}
+
+	return &ModelResponse{
+		Text:       resp.Choices[0].Delta.Content,
+		StopReason: resp.Choices[0].FinishReason,
+		Truncated:  resp.Choices[0].FinishReason == "length",
+	}, nil
+}
@@ -0,0 +1,167 @@
+package llm
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// anthropicFamily は、Anthropic Messages APIのモデル（Claude）を扱うモデルファミリーです
+type anthropicFamily struct{}
+
+type anthropicMessage struct {
+	Role    string      `json:"role"`
+	Content interface{} `json:"content"` // テキストのみの場合は文字列、画像などを含む場合はanthropicContentの配列
+}
+
+type anthropicContent struct {
+	Type   string           `json:"type"`
+	Text   string           `json:"text,omitempty"`
+	Source *anthropicSource `json:"source,omitempty"`
+}
+
+type anthropicSource struct {
+	Type      string `json:"type"`
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"`
+}
+
+type anthropicRequest struct {
+	AnthropicVersion string             `json:"anthropic_version"`
+	MaxTokens        int                `json:"max_tokens"`
+	System           string             `json:"system,omitempty"`
+	Messages         []anthropicMessage `json:"messages"`
+	Temperature      *float64           `json:"temperature,omitempty"`
+	TopP             *float64           `json:"top_p,omitempty"`
+	TopK             *int               `json:"top_k,omitempty"`
+	StopSequences    []string           `json:"stop_sequences,omitempty"`
+}
+
+type anthropicResponse struct {
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	StopReason string `json:"stop_reason"`
+	Usage      struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+func (anthropicFamily) Name() string {
+	return "anthropic"
+}
+
+func (anthropicFamily) BuildRequest(req ModelRequest) ([]byte, error) {
+	messages := make([]anthropicMessage, 0, len(req.Messages))
+	for _, message := range req.Messages {
+		if !message.HasNonText() {
+			messages = append(messages, anthropicMessage{Role: message.Role, Content: message.Content})
+			continue
+		}
+
+		content := make([]anthropicContent, 0, len(message.Blocks))
+		for _, block := range message.Blocks {
+			converted, err := anthropicContentBlock(block)
+			if err != nil {
+				return nil, err
+			}
+			content = append(content, converted)
+		}
+		messages = append(messages, anthropicMessage{Role: message.Role, Content: content})
+	}
+
+	return json.Marshal(anthropicRequest{
+		AnthropicVersion: "bedrock-2023-05-31",
+		MaxTokens:        maxTokensOrDefault(req.Params.MaxTokens),
+		System:           req.System,
+		Messages:         messages,
+		Temperature:      req.Params.Temperature,
+		TopP:             req.Params.TopP,
+		TopK:             req.Params.TopK,
+		StopSequences:    req.Params.StopSequences,
+	})
+}
+
+// acceptsContentBlocks は、画像とドキュメントを含むメッセージを送信できることを示します
+func (anthropicFamily) acceptsContentBlocks() {}
+
+// anthropicContentBlock は、コンテンツブロックをMessages APIの形式に変換する関数です
+// 画像とPDFはBase64でエンコードし、テキストのドキュメントはテキストとして送信します
+func anthropicContentBlock(block ContentBlock) (anthropicContent, error) {
+	switch {
+	case block.Type == BlockText:
+		return anthropicContent{Type: "text", Text: block.Text}, nil
+	case block.Type == BlockImage:
+		return anthropicContent{Type: "image", Source: &anthropicSource{
+			Type:      "base64",
+			MediaType: "image/" + block.Format,
+			Data:      base64.StdEncoding.EncodeToString(block.Data),
+		}}, nil
+	case block.Type == BlockDocument && block.Format == "pdf":
+		return anthropicContent{Type: "document", Source: &anthropicSource{
+			Type:      "base64",
+			MediaType: "application/pdf",
+			Data:      base64.StdEncoding.EncodeToString(block.Data),
+		}}, nil
+	case block.Type == BlockDocument:
+		return anthropicContent{Type: "text", Text: fmt.Sprintf("%s:\n%s", block.Name, string(block.Data))}, nil
+	}
+	return anthropicContent{}, fmt.Errorf("InvokeModelでは送信できないコンテンツブロックです: %s", block.Type)
+}
+
+func (anthropicFamily) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp anthropicResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	// テキストブロックを連結して回答とする
+	var text string
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			text += block.Text
+		}
+	}
+
+	return &ModelResponse{
+		Text: text,
+		Usage: Usage{
+			InputTokens:  resp.Usage.InputTokens,
+			OutputTokens: resp.Usage.OutputTokens,
+		},
+		StopReason: resp.StopReason,
+		Truncated:  resp.StopReason == "max_tokens",
+	}, nil
+}
+
+type anthropicStreamChunk struct {
+	Type  string `json:"type"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+}
+
+func (anthropicFamily) ParseStreamChunk(chunk []byte) (*ModelResponse, error) {
+	var resp anthropicStreamChunk
+	if err := json.Unmarshal(chunk, &resp); err != nil {
+		return nil, fmt.Errorf("チャンクの解析エラー: %v", err)
+	}
+
+	switch {
+	case resp.Type == "content_block_delta" && resp.Delta.Type == "text_delta":
+		// テキストの差分はcontent_block_deltaイベントにのみ含まれる
+		return &ModelResponse{Text: resp.Delta.Text}, nil
+	case resp.Type == "message_delta":
+		// 終了理由はmessage_deltaイベントに含まれる
+		return &ModelResponse{
+			StopReason: resp.Delta.StopReason,
+			Truncated:  resp.Delta.StopReason == "max_tokens",
+		}, nil
+	}
+
+	return &ModelResponse{}, nil
+}
@@ -0,0 +1,172 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// cohereFamily は、Cohere Command（テキスト生成API）モデルを扱うモデルファミリーです
+type cohereFamily struct{}
+
+type cohereRequest struct {
+	Prompt        string   `json:"prompt"`
+	MaxTokens     int      `json:"max_tokens"`
+	Temperature   *float64 `json:"temperature,omitempty"`
+	P             *float64 `json:"p,omitempty"`
+	K             *int     `json:"k,omitempty"`
+	StopSequences []string `json:"stop_sequences,omitempty"`
+	Stream        bool     `json:"stream,omitempty"`
+}
+
+type cohereResponse struct {
+	Generations []struct {
+		Text         string `json:"text"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"generations"`
+}
+
+func (cohereFamily) Name() string {
+	return "cohere"
+}
+
+func (cohereFamily) BuildRequest(req ModelRequest) ([]byte, error) {
+	return json.Marshal(cohereRequest{
+		Prompt:        formatTranscript(req.System, req.Messages, "User", "Chatbot"),
+		MaxTokens:     maxTokensOrDefault(req.Params.MaxTokens),
+		Temperature:   req.Params.Temperature,
+		P:             req.Params.TopP,
+		K:             req.Params.TopK,
+		StopSequences: req.Params.StopSequences,
+		// Cohere Commandはストリーミング時にstreamの指定が必要
+		Stream: req.Stream,
+	})
+}
+
+func (cohereFamily) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp cohereResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	if len(resp.Generations) == 0 {
+		return &ModelResponse{}, nil
+	}
+
+	return &ModelResponse{
+		Text:       resp.Generations[0].Text,
+		StopReason: resp.Generations[0].FinishReason,
+		Truncated:  resp.Generations[0].FinishReason == "MAX_TOKENS",
+	}, nil
+}
+
+type cohereStreamChunk struct {
+	Text         string `json:"text"`
+	IsFinished   bool   `json:"is_finished"`
+	FinishReason string `json:"finish_reason"`
+}
+
+func (cohereFamily) ParseStreamChunk(chunk []byte) (*ModelResponse, error) {
+	var resp cohereStreamChunk
+	if err := json.Unmarshal(chunk, &resp); err != nil {
+		return nil, fmt.Errorf("チャンクの解析エラー: %v", err)
+	}
+
+	return &ModelResponse{
+		Text:       resp.Text,
+		StopReason: resp.FinishReason,
+		Truncated:  resp.FinishReason == "MAX_TOKENS",
+	}, nil
+}
+
+// cohereChatFamily は、Cohere Command R（チャットAPI）モデルを扱うモデルファミリーです
+type cohereChatFamily struct{}
+
+type cohereChatMessage struct {
+	Role    string `json:"role"`
+	Message string `json:"message"`
+}
+
+type cohereChatRequest struct {
+	Preamble      string              `json:"preamble,omitempty"`
+	ChatHistory   []cohereChatMessage `json:"chat_history,omitempty"`
+	Message       string              `json:"message"`
+	MaxTokens     int                 `json:"max_tokens"`
+	Temperature   *float64            `json:"temperature,omitempty"`
+	P             *float64            `json:"p,omitempty"`
+	K             *int                `json:"k,omitempty"`
+	StopSequences []string            `json:"stop_sequences,omitempty"`
+}
+
+type cohereChatResponse struct {
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason"`
+}
+
+func (cohereChatFamily) Name() string {
+	return "cohere-chat"
+}
+
+func (cohereChatFamily) BuildRequest(req ModelRequest) ([]byte, error) {
+	// 最後のユーザー入力以外はchat_historyとして渡す
+	var history []cohereChatMessage
+	if len(req.Messages) > 1 {
+		for _, message := range req.Messages[:len(req.Messages)-1] {
+			role := "USER"
+			if message.Role == RoleAssistant {
+				role = "CHATBOT"
+			}
+			history = append(history, cohereChatMessage{Role: role, Message: message.Content})
+		}
+	}
+
+	return json.Marshal(cohereChatRequest{
+		Preamble:      req.System,
+		Message:       lastUserContent(req.Messages),
+		ChatHistory:   history,
+		MaxTokens:     maxTokensOrDefault(req.Params.MaxTokens),
+		Temperature:   req.Params.Temperature,
+		P:             req.Params.TopP,
+		K:             req.Params.TopK,
+		StopSequences: req.Params.StopSequences,
+	})
+}
+
+func (cohereChatFamily) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp cohereChatResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	return &ModelResponse{
+		Text:       resp.Text,
+		StopReason: resp.FinishReason,
+		Truncated:  resp.FinishReason == "MAX_TOKENS",
+	}, nil
+}
+
+type cohereChatStreamChunk struct {
+	EventType    string `json:"event_type"`
+	Text         string `json:"text"`
+	FinishReason string `json:"finish_reason"`
+}
+
+func (cohereChatFamily) ParseStreamChunk(chunk []byte) (*ModelResponse, error) {
+	var resp cohereChatStreamChunk
+	if err := json.Unmarshal(chunk, &resp); err != nil {
+		return nil, fmt.Errorf("チャンクの解析エラー: %v", err)
+	}
+
+	switch resp.EventType {
+	case "text-generation":
+		// テキストの差分はtext-generationイベントにのみ含まれる
+		return &ModelResponse{Text: resp.Text}, nil
+	case "stream-end":
+		// 終了理由はstream-endイベントに含まれる
+		return &ModelResponse{
+			StopReason: resp.FinishReason,
+			Truncated:  resp.FinishReason == "MAX_TOKENS",
+		}, nil
+	}
+
+	return &ModelResponse{}, nil
+}
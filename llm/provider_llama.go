@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// llamaFamily は、Meta Llamaモデルを扱うモデルファミリーです
+type llamaFamily struct{}
+
+type llamaRequest struct {
+	Prompt      string   `json:"prompt"`
+	MaxGenLen   int      `json:"max_gen_len"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+}
+
+type llamaResponse struct {
+	Generation           string `json:"generation"`
+	PromptTokenCount     int    `json:"prompt_token_count"`
+	GenerationTokenCount int    `json:"generation_token_count"`
+	StopReason           string `json:"stop_reason"`
+}
+
+func (llamaFamily) Name() string {
+	return "llama"
+}
+
+func (llamaFamily) BuildRequest(req ModelRequest) ([]byte, error) {
+	// Llama 3のチャットテンプレートに沿ってプロンプトを組み立てる
+	var prompt strings.Builder
+	prompt.WriteString("<|begin_of_text|>")
+	if req.System != "" {
+		prompt.WriteString("<|start_header_id|>system<|end_header_id|>\n\n" + req.System + "<|eot_id|>")
+	}
+	for _, message := range req.Messages {
+		prompt.WriteString("<|start_header_id|>" + message.Role + "<|end_header_id|>\n\n")
+		prompt.WriteString(message.Content + "<|eot_id|>")
+	}
+	prompt.WriteString("<|start_header_id|>assistant<|end_header_id|>\n\n")
+
+	// Llamaはtop-kと停止シーケンスに対応していないため送信しない
+	return json.Marshal(llamaRequest{
+		Prompt:      prompt.String(),
+		MaxGenLen:   maxTokensOrDefault(req.Params.MaxTokens),
+		Temperature: req.Params.Temperature,
+		TopP:        req.Params.TopP,
+	})
+}
+
+func (llamaFamily) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp llamaResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	return &ModelResponse{
+		Text: resp.Generation,
+		Usage: Usage{
+			InputTokens:  resp.PromptTokenCount,
+			OutputTokens: resp.GenerationTokenCount,
+		},
+		StopReason: resp.StopReason,
+		Truncated:  resp.StopReason == "length",
+	}, nil
+}
+
+func (f llamaFamily) ParseStreamChunk(chunk []byte) (*ModelResponse, error) {
+	// ストリーミング時もチャンクの形式は通常のレスポンスと同じ
+	// トークン数はストリーム全体のメトリクスから取得するため、チャンクの値は使用しない
+	resp, err := f.ParseResponse(chunk)
+	if err != nil {
+		return nil, err
+	}
+	return &ModelResponse{Text: resp.Text, StopReason: resp.StopReason, Truncated: resp.Truncated}, nil
+}
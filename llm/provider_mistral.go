@@ -0,0 +1,77 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// mistralFamily は、Mistral AIモデルを扱うモデルファミリーです
+type mistralFamily struct{}
+
+type mistralRequest struct {
+	Prompt      string   `json:"prompt"`
+	MaxTokens   int      `json:"max_tokens"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty"`
+	TopK        *int     `json:"top_k,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
+}
+
+type mistralResponse struct {
+	Outputs []struct {
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"outputs"`
+}
+
+func (mistralFamily) Name() string {
+	return "mistral"
+}
+
+func (mistralFamily) BuildRequest(req ModelRequest) ([]byte, error) {
+	// Mistralの指示形式に沿ってプロンプトを組み立てる
+	// システムプロンプトには対応していないため、最初の指示の先頭に付加する
+	var prompt strings.Builder
+	prompt.WriteString("<s>")
+	for i, message := range req.Messages {
+		if message.Role == RoleAssistant {
+			prompt.WriteString(" " + message.Content + "</s>")
+		} else if i == 0 {
+			prompt.WriteString("[INST] " + withSystemPrompt(req.System, message.Content) + " [/INST]")
+		} else {
+			prompt.WriteString("[INST] " + message.Content + " [/INST]")
+		}
+	}
+
+	return json.Marshal(mistralRequest{
+		Prompt:      prompt.String(),
+		MaxTokens:   maxTokensOrDefault(req.Params.MaxTokens),
+		Temperature: req.Params.Temperature,
+		TopP:        req.Params.TopP,
+		TopK:        req.Params.TopK,
+		Stop:        req.Params.StopSequences,
+	})
+}
+
+func (mistralFamily) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp mistralResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	if len(resp.Outputs) == 0 {
+		return &ModelResponse{}, nil
+	}
+
+	return &ModelResponse{
+		Text:       resp.Outputs[0].Text,
+		StopReason: resp.Outputs[0].StopReason,
+		Truncated:  resp.Outputs[0].StopReason == "length",
+	}, nil
+}
+
+func (f mistralFamily) ParseStreamChunk(chunk []byte) (*ModelResponse, error) {
+	// ストリーミング時もチャンクの形式は通常のレスポンスと同じ
+	return f.ParseResponse(chunk)
+}
@@ -0,0 +1,562 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+)
+
+// モデルファミリーごとのダミーレスポンスを返すモックのBedrockRuntimeクライアント
+type MockFamilyRuntimeClient struct {
+	Responses map[string]string // モデルID -> レスポンスボディ
+}
+
+// InvokeModelのモックメソッド
+func (m *MockFamilyRuntimeClient) InvokeModel(ctx context.Context, params *bedrockruntime.InvokeModelInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.InvokeModelOutput, error) {
+	body, ok := m.Responses[aws.ToString(params.ModelId)]
+	if !ok {
+		return nil, fmt.Errorf("未対応のLLMモデル: %s", aws.ToString(params.ModelId))
+	}
+	return &bedrockruntime.InvokeModelOutput{
+		Body:        []byte(body),
+		ContentType: aws.String("application/json"),
+	}, nil
+}
+
+// FindModelFamilyのテスト
+func TestFindModelFamily(t *testing.T) {
+	testCases := []struct {
+		modelID     string
+		family      string
+		expectError bool
+	}{
+		{"anthropic.claude-3-5-sonnet-20240620-v1:0", "anthropic", false},
+		{"anthropic.claude-3-haiku-20240307-v1:0", "anthropic", false},
+		{"amazon.titan-text-express-v1", "titan", false},
+		{"amazon.titan-text-premier-v1:0", "titan", false},
+		{"meta.llama3-8b-instruct-v1:0", "llama", false},
+		{"mistral.mistral-7b-instruct-v0:2", "mistral", false},
+		{"cohere.command-text-v14", "cohere", false},
+		{"cohere.command-r-plus-v1:0", "cohere-chat", false},
+		{"ai21.j2-ultra-v1", "ai21", false},
+		{"ai21.jamba-1-5-large-v1:0", "jamba", false},
+		{"us.anthropic.claude-3-5-sonnet-20240620-v1:0", "anthropic", false},
+		{"eu.meta.llama3-2-3b-instruct-v1:0", "llama", false},
+		{"apac.amazon.nova-pro-v1:0", "", true},
+		{"amazon.titan-embed-text-v1", "", true},
+		{"unsupported.model-v1", "", true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			family, err := FindModelFamily(tc.modelID)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("エラーが期待されていましたが、モデルファミリー「%s」が返されました", family.Name())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if family.Name() != tc.family {
+				t.Errorf("モデルファミリーが期待通りではありません。期待: %s, 実際: %s", tc.family, family.Name())
+			}
+		})
+	}
+}
+
+// 各モデルファミリーのリクエスト構築とレスポンス解析のテスト
+func TestModelFamilyCodecs(t *testing.T) {
+	testCases := []struct {
+		modelID      string
+		expectFields []string // リクエストに含まれるべきJSONフィールド
+		response     string   // モックが返すレスポンスボディ
+		expectAnswer string
+	}{
+		{
+			modelID:      "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			expectFields: []string{"anthropic_version", "max_tokens", "messages"},
+			response:     `{"content":[{"type":"text","text":"Claudeの回答"}],"stop_reason":"end_turn"}`,
+			expectAnswer: "Claudeの回答",
+		},
+		{
+			modelID:      "amazon.titan-text-express-v1",
+			expectFields: []string{"inputText", "textGenerationConfig"},
+			response:     `{"results":[{"outputText":"Titanの回答","completionReason":"FINISHED"}]}`,
+			expectAnswer: "Titanの回答",
+		},
+		{
+			modelID:      "meta.llama3-8b-instruct-v1:0",
+			expectFields: []string{"prompt", "max_gen_len"},
+			response:     `{"generation":"Llamaの回答","stop_reason":"stop"}`,
+			expectAnswer: "Llamaの回答",
+		},
+		{
+			modelID:      "mistral.mistral-7b-instruct-v0:2",
+			expectFields: []string{"prompt", "max_tokens"},
+			response:     `{"outputs":[{"text":"Mistralの回答","stop_reason":"stop"}]}`,
+			expectAnswer: "Mistralの回答",
+		},
+		{
+			modelID:      "cohere.command-text-v14",
+			expectFields: []string{"prompt", "max_tokens"},
+			response:     `{"generations":[{"text":"Cohereの回答","finish_reason":"COMPLETE"}]}`,
+			expectAnswer: "Cohereの回答",
+		},
+		{
+			modelID:      "cohere.command-r-v1:0",
+			expectFields: []string{"message", "max_tokens"},
+			response:     `{"text":"Command Rの回答","finish_reason":"COMPLETE"}`,
+			expectAnswer: "Command Rの回答",
+		},
+		{
+			modelID:      "ai21.j2-mid-v1",
+			expectFields: []string{"prompt", "maxTokens"},
+			response:     `{"completions":[{"data":{"text":"Jurassicの回答"},"finishReason":{"reason":"endoftext"}}]}`,
+			expectAnswer: "Jurassicの回答",
+		},
+		{
+			modelID:      "ai21.jamba-instruct-v1:0",
+			expectFields: []string{"messages", "max_tokens"},
+			response:     `{"choices":[{"message":{"role":"assistant","content":"Jambaの回答"},"finish_reason":"stop"}]}`,
+			expectAnswer: "Jambaの回答",
+		},
+	}
+
+	mockClient := &MockFamilyRuntimeClient{Responses: map[string]string{}}
+	for _, tc := range testCases {
+		mockClient.Responses[tc.modelID] = tc.response
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			family, err := FindModelFamily(tc.modelID)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			// リクエストの構築
+			payload, err := family.BuildRequest(ModelRequest{Messages: []Message{{Role: RoleUser, Content: "AIについて教えてください"}}})
+			if err != nil {
+				t.Fatalf("リクエストの構築エラー: %v", err)
+			}
+
+			var request map[string]interface{}
+			if err := json.Unmarshal(payload, &request); err != nil {
+				t.Fatalf("リクエストがJSONではありません: %v", err)
+			}
+			for _, field := range tc.expectFields {
+				if _, ok := request[field]; !ok {
+					t.Errorf("リクエストにフィールド「%s」が含まれていません。\n実際のリクエスト:\n%s", field, payload)
+				}
+			}
+			if !strings.Contains(string(payload), "AIについて教えてください") {
+				t.Errorf("リクエストにプロンプトが含まれていません。\n実際のリクエスト:\n%s", payload)
+			}
+
+			// モッククライアント経由でレスポンスを取得して解析
+			output, err := mockClient.InvokeModel(context.TODO(), &bedrockruntime.InvokeModelInput{
+				ModelId:     aws.String(tc.modelID),
+				Body:        payload,
+				ContentType: aws.String("application/json"),
+			})
+			if err != nil {
+				t.Fatalf("モデル呼び出しエラー: %v", err)
+			}
+
+			response, err := family.ParseResponse(output.Body)
+			if err != nil {
+				t.Fatalf("レスポンスの解析エラー: %v", err)
+			}
+			if response.Text != tc.expectAnswer {
+				t.Errorf("回答が期待通りではありません。期待: %s, 実際: %s", tc.expectAnswer, response.Text)
+			}
+		})
+	}
+}
+
+// 最大出力トークン数の指定がリクエストに反映されるかのテスト
+func TestModelFamilyMaxTokens(t *testing.T) {
+	family, err := FindModelFamily("anthropic.claude-3-5-sonnet-20240620-v1:0")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	payload, err := family.BuildRequest(ModelRequest{Messages: []Message{{Role: RoleUser, Content: "test"}}})
+	if err != nil {
+		t.Fatalf("リクエストの構築エラー: %v", err)
+	}
+	if !strings.Contains(string(payload), `"max_tokens":1000`) {
+		t.Errorf("デフォルトの最大トークン数が設定されていません: %s", payload)
+	}
+
+	payload, err = family.BuildRequest(ModelRequest{Messages: []Message{{Role: RoleUser, Content: "test"}}, Params: InferenceParams{MaxTokens: 4096}})
+	if err != nil {
+		t.Fatalf("リクエストの構築エラー: %v", err)
+	}
+	if !strings.Contains(string(payload), `"max_tokens":4096`) {
+		t.Errorf("指定した最大トークン数が設定されていません: %s", payload)
+	}
+}
+
+// 会話履歴がリクエストに反映されるかのテスト
+func TestModelFamilyConversation(t *testing.T) {
+	messages := []Message{
+		{Role: RoleUser, Content: "最初の質問"},
+		{Role: RoleAssistant, Content: "最初の回答"},
+		{Role: RoleUser, Content: "次の質問"},
+	}
+
+	modelIDs := []string{
+		"anthropic.claude-3-5-sonnet-20240620-v1:0",
+		"amazon.titan-text-express-v1",
+		"meta.llama3-8b-instruct-v1:0",
+		"mistral.mistral-7b-instruct-v0:2",
+		"cohere.command-text-v14",
+		"cohere.command-r-v1:0",
+		"ai21.j2-mid-v1",
+		"ai21.jamba-instruct-v1:0",
+	}
+
+	for _, modelID := range modelIDs {
+		t.Run(modelID, func(t *testing.T) {
+			family, err := FindModelFamily(modelID)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			payload, err := family.BuildRequest(ModelRequest{Messages: messages})
+			if err != nil {
+				t.Fatalf("リクエストの構築エラー: %v", err)
+			}
+
+			// すべてのメッセージがリクエストに含まれ、順序が保たれていること
+			request := string(payload)
+			last := -1
+			for _, message := range messages {
+				index := strings.Index(request, message.Content)
+				if index < 0 {
+					t.Fatalf("リクエストに「%s」が含まれていません。\n実際のリクエスト:\n%s", message.Content, request)
+				}
+				if index < last {
+					t.Errorf("リクエスト内のメッセージの順序が正しくありません。\n実際のリクエスト:\n%s", request)
+				}
+				last = index
+			}
+		})
+	}
+}
+
+// レスポンスに含まれるトークン数の抽出のテスト
+func TestModelFamilyUsage(t *testing.T) {
+	testCases := []struct {
+		modelID  string
+		response string
+		expected Usage
+	}{
+		{
+			modelID:  "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			response: `{"content":[{"type":"text","text":"回答"}],"usage":{"input_tokens":10,"output_tokens":50}}`,
+			expected: Usage{InputTokens: 10, OutputTokens: 50},
+		},
+		{
+			modelID:  "amazon.titan-text-express-v1",
+			response: `{"inputTextTokenCount":12,"results":[{"tokenCount":34,"outputText":"回答"}]}`,
+			expected: Usage{InputTokens: 12, OutputTokens: 34},
+		},
+		{
+			modelID:  "meta.llama3-8b-instruct-v1:0",
+			response: `{"generation":"回答","prompt_token_count":5,"generation_token_count":6}`,
+			expected: Usage{InputTokens: 5, OutputTokens: 6},
+		},
+		{
+			modelID:  "ai21.jamba-instruct-v1:0",
+			response: `{"choices":[{"message":{"content":"回答"}}],"usage":{"prompt_tokens":7,"completion_tokens":8}}`,
+			expected: Usage{InputTokens: 7, OutputTokens: 8},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			family, err := FindModelFamily(tc.modelID)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			response, err := family.ParseResponse([]byte(tc.response))
+			if err != nil {
+				t.Fatalf("レスポンスの解析エラー: %v", err)
+			}
+			if response.Usage != tc.expected {
+				t.Errorf("トークン数が期待通りではありません。期待: %+v, 実際: %+v", tc.expected, response.Usage)
+			}
+		})
+	}
+}
+
+// システムプロンプトがリクエストに反映されるかのテスト
+func TestModelFamilySystemPrompt(t *testing.T) {
+	testCases := []struct {
+		modelID string
+		field   string // システムプロンプトを渡すフィールド（空の場合はプロンプト本文に含まれる）
+	}{
+		{"anthropic.claude-3-5-sonnet-20240620-v1:0", "system"},
+		{"amazon.titan-text-express-v1", ""},
+		{"meta.llama3-8b-instruct-v1:0", ""},
+		{"mistral.mistral-7b-instruct-v0:2", ""},
+		{"cohere.command-text-v14", ""},
+		{"cohere.command-r-v1:0", "preamble"},
+		{"ai21.j2-mid-v1", ""},
+		{"ai21.jamba-instruct-v1:0", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			family, err := FindModelFamily(tc.modelID)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			payload, err := family.BuildRequest(ModelRequest{
+				System:   "あなたはGoの専門家です",
+				Messages: []Message{{Role: RoleUser, Content: "質問"}},
+			})
+			if err != nil {
+				t.Fatalf("リクエストの構築エラー: %v", err)
+			}
+
+			var request map[string]interface{}
+			if err := json.Unmarshal(payload, &request); err != nil {
+				t.Fatalf("リクエストがJSONではありません: %v", err)
+			}
+
+			if tc.field != "" {
+				if request[tc.field] != "あなたはGoの専門家です" {
+					t.Errorf("フィールド「%s」にシステムプロンプトが設定されていません。\n実際のリクエスト:\n%s", tc.field, payload)
+				}
+				return
+			}
+
+			// システムプロンプトは質問より前に配置される
+			system := strings.Index(string(payload), "あなたはGoの専門家です")
+			question := strings.Index(string(payload), "質問")
+			if system < 0 || system > question {
+				t.Errorf("システムプロンプトが質問の前に含まれていません。\n実際のリクエスト:\n%s", payload)
+			}
+		})
+	}
+}
+
+// 推論パラメータが各モデルファミリーのリクエストに反映されるかのテスト
+func TestModelFamilyInferenceParams(t *testing.T) {
+	temperature := 0.2
+	topP := 0.5
+	topK := 40
+	params := InferenceParams{
+		MaxTokens:     2048,
+		Temperature:   &temperature,
+		TopP:          &topP,
+		TopK:          &topK,
+		StopSequences: []string{"END"},
+	}
+
+	testCases := []struct {
+		modelID   string
+		expect    []string
+		notExpect []string
+	}{
+		{
+			modelID: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			expect:  []string{`"max_tokens":2048`, `"temperature":0.2`, `"top_p":0.5`, `"top_k":40`, `"stop_sequences":["END"]`},
+		},
+		{
+			modelID:   "amazon.titan-text-express-v1",
+			expect:    []string{`"maxTokenCount":2048`, `"temperature":0.2`, `"topP":0.5`, `"stopSequences":["END"]`},
+			notExpect: []string{`40`},
+		},
+		{
+			modelID:   "meta.llama3-8b-instruct-v1:0",
+			expect:    []string{`"max_gen_len":2048`, `"temperature":0.2`, `"top_p":0.5`},
+			notExpect: []string{`40`, `END`},
+		},
+		{
+			modelID: "mistral.mistral-7b-instruct-v0:2",
+			expect:  []string{`"max_tokens":2048`, `"temperature":0.2`, `"top_p":0.5`, `"top_k":40`, `"stop":["END"]`},
+		},
+		{
+			modelID: "cohere.command-text-v14",
+			expect:  []string{`"max_tokens":2048`, `"temperature":0.2`, `"p":0.5`, `"k":40`, `"stop_sequences":["END"]`},
+		},
+		{
+			modelID: "cohere.command-r-v1:0",
+			expect:  []string{`"max_tokens":2048`, `"temperature":0.2`, `"p":0.5`, `"k":40`, `"stop_sequences":["END"]`},
+		},
+		{
+			modelID:   "ai21.j2-mid-v1",
+			expect:    []string{`"maxTokens":2048`, `"temperature":0.2`, `"topP":0.5`, `"stopSequences":["END"]`},
+			notExpect: []string{`40`},
+		},
+		{
+			modelID:   "ai21.jamba-instruct-v1:0",
+			expect:    []string{`"max_tokens":2048`, `"temperature":0.2`, `"top_p":0.5`, `"stop":["END"]`},
+			notExpect: []string{`40`},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			family, err := FindModelFamily(tc.modelID)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			payload, err := family.BuildRequest(ModelRequest{
+				Messages: []Message{{Role: RoleUser, Content: "test"}},
+				Params:   params,
+			})
+			if err != nil {
+				t.Fatalf("リクエストの構築エラー: %v", err)
+			}
+
+			for _, expect := range tc.expect {
+				if !strings.Contains(string(payload), expect) {
+					t.Errorf("リクエストに %s が含まれていません: %s", expect, payload)
+				}
+			}
+			for _, notExpect := range tc.notExpect {
+				if strings.Contains(string(payload), notExpect) {
+					t.Errorf("対応していないパラメータ %s がリクエストに含まれています: %s", notExpect, payload)
+				}
+			}
+		})
+	}
+}
+
+// 推論パラメータを指定しない場合にモデルのデフォルト値が使われるかのテスト
+func TestModelFamilyDefaultParams(t *testing.T) {
+	family, err := FindModelFamily("anthropic.claude-3-5-sonnet-20240620-v1:0")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	payload, err := family.BuildRequest(ModelRequest{Messages: []Message{{Role: RoleUser, Content: "test"}}})
+	if err != nil {
+		t.Fatalf("リクエストの構築エラー: %v", err)
+	}
+	for _, key := range []string{"temperature", "top_p", "top_k", "stop_sequences"} {
+		if strings.Contains(string(payload), key) {
+			t.Errorf("未指定のパラメータ %s がリクエストに含まれています: %s", key, payload)
+		}
+	}
+}
+
+// 最大出力トークン数で途切れたレスポンスが検出されるかのテスト
+func TestModelFamilyTruncated(t *testing.T) {
+	testCases := []struct {
+		modelID         string
+		body            string
+		expectTruncated bool
+	}{
+		{
+			modelID:         "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			body:            `{"content":[{"type":"text","text":"途中"}],"stop_reason":"max_tokens"}`,
+			expectTruncated: true,
+		},
+		{
+			modelID:         "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			body:            `{"content":[{"type":"text","text":"完了"}],"stop_reason":"end_turn"}`,
+			expectTruncated: false,
+		},
+		{
+			modelID:         "amazon.titan-text-express-v1",
+			body:            `{"results":[{"outputText":"途中","completionReason":"LENGTH"}]}`,
+			expectTruncated: true,
+		},
+		{
+			modelID:         "meta.llama3-8b-instruct-v1:0",
+			body:            `{"generation":"途中","stop_reason":"length"}`,
+			expectTruncated: true,
+		},
+		{
+			modelID:         "mistral.mistral-7b-instruct-v0:2",
+			body:            `{"outputs":[{"text":"途中","stop_reason":"length"}]}`,
+			expectTruncated: true,
+		},
+		{
+			modelID:         "cohere.command-text-v14",
+			body:            `{"generations":[{"text":"途中","finish_reason":"MAX_TOKENS"}]}`,
+			expectTruncated: true,
+		},
+		{
+			modelID:         "cohere.command-r-v1:0",
+			body:            `{"text":"途中","finish_reason":"MAX_TOKENS"}`,
+			expectTruncated: true,
+		},
+		{
+			modelID:         "ai21.j2-mid-v1",
+			body:            `{"completions":[{"data":{"text":"途中"},"finishReason":{"reason":"length"}}]}`,
+			expectTruncated: true,
+		},
+		{
+			modelID:         "ai21.jamba-instruct-v1:0",
+			body:            `{"choices":[{"message":{"content":"途中"},"finish_reason":"length"}]}`,
+			expectTruncated: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			family, err := FindModelFamily(tc.modelID)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			response, err := family.ParseResponse([]byte(tc.body))
+			if err != nil {
+				t.Fatalf("レスポンスの解析エラー: %v", err)
+			}
+			if response.Truncated != tc.expectTruncated {
+				t.Errorf("途切れの検出が期待通りではありません。期待: %v, 実際: %v（終了理由: %s）", tc.expectTruncated, response.Truncated, response.StopReason)
+			}
+		})
+	}
+}
+
+// 推論パラメータの検証のテスト
+func TestInferenceParamsValidate(t *testing.T) {
+	negative := -0.1
+	tooLarge := 1.5
+	valid := 0.5
+	negativeK := -1
+
+	testCases := []struct {
+		name        string
+		params      InferenceParams
+		expectError bool
+	}{
+		{name: "未指定", params: InferenceParams{}, expectError: false},
+		{name: "有効な値", params: InferenceParams{MaxTokens: 100, Temperature: &valid, TopP: &valid}, expectError: false},
+		{name: "負の最大トークン数", params: InferenceParams{MaxTokens: -1}, expectError: true},
+		{name: "負の温度", params: InferenceParams{Temperature: &negative}, expectError: true},
+		{name: "範囲外のtop-p", params: InferenceParams{TopP: &tooLarge}, expectError: true},
+		{name: "負のtop-k", params: InferenceParams{TopK: &negativeK}, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.params.Validate()
+			if tc.expectError && err == nil {
+				t.Error("エラーが期待されましたが、発生しませんでした")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("予期せぬエラー: %v", err)
+			}
+		})
+	}
+}
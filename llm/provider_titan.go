@@ -0,0 +1,91 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// titanFamily は、Amazon Titan Textモデルを扱うモデルファミリーです
+type titanFamily struct{}
+
+type titanTextGenerationConfig struct {
+	MaxTokenCount int      `json:"maxTokenCount"`
+	StopSequences []string `json:"stopSequences"`
+	Temperature   float64  `json:"temperature"`
+	TopP          float64  `json:"topP"`
+}
+
+type titanRequest struct {
+	InputText            string                    `json:"inputText"`
+	TextGenerationConfig titanTextGenerationConfig `json:"textGenerationConfig"`
+}
+
+type titanResponse struct {
+	InputTextTokenCount int `json:"inputTextTokenCount"`
+	Results             []struct {
+		TokenCount       int    `json:"tokenCount"`
+		OutputText       string `json:"outputText"`
+		CompletionReason string `json:"completionReason"`
+	} `json:"results"`
+}
+
+func (titanFamily) Name() string {
+	return "titan"
+}
+
+func (titanFamily) BuildRequest(req ModelRequest) ([]byte, error) {
+	// Titanはtop-kに対応していないため送信しない
+	stopSequences := req.Params.StopSequences
+	if stopSequences == nil {
+		stopSequences = []string{}
+	}
+
+	return json.Marshal(titanRequest{
+		InputText: formatTranscript(req.System, req.Messages, "User", "Bot"),
+		TextGenerationConfig: titanTextGenerationConfig{
+			MaxTokenCount: maxTokensOrDefault(req.Params.MaxTokens),
+			StopSequences: stopSequences,
+			Temperature:   floatOrDefault(req.Params.Temperature, 0.7),
+			TopP:          floatOrDefault(req.Params.TopP, 0.9),
+		},
+	})
+}
+
+func (titanFamily) ParseResponse(body []byte) (*ModelResponse, error) {
+	var resp titanResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("レスポンスの解析エラー: %v", err)
+	}
+
+	if len(resp.Results) == 0 {
+		return &ModelResponse{}, nil
+	}
+
+	return &ModelResponse{
+		Text: resp.Results[0].OutputText,
+		Usage: Usage{
+			InputTokens:  resp.InputTextTokenCount,
+			OutputTokens: resp.Results[0].TokenCount,
+		},
+		StopReason: resp.Results[0].CompletionReason,
+		Truncated:  resp.Results[0].CompletionReason == "LENGTH",
+	}, nil
+}
+
+type titanStreamChunk struct {
+	OutputText       string `json:"outputText"`
+	CompletionReason string `json:"completionReason"`
+}
+
+func (titanFamily) ParseStreamChunk(chunk []byte) (*ModelResponse, error) {
+	var resp titanStreamChunk
+	if err := json.Unmarshal(chunk, &resp); err != nil {
+		return nil, fmt.Errorf("チャンクの解析エラー: %v", err)
+	}
+
+	return &ModelResponse{
+		Text:       resp.OutputText,
+		StopReason: resp.CompletionReason,
+		Truncated:  resp.CompletionReason == "LENGTH",
+	}, nil
+}
@@ -0,0 +1,250 @@
+package llm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SessionMessage は、セッションに保存する1メッセージを定義する構造体です
+type SessionMessage struct {
+	Message
+	Timestamp time.Time `json:"timestamp"`
+	ModelID   string    `json:"model_id,omitempty"` // 回答したモデル（回答メッセージのみ）
+	Usage     *Usage    `json:"usage,omitempty"`    // 回答に使用したトークン数（回答メッセージのみ）
+}
+
+// Session は、名前付きの会話セッションを定義する構造体です
+type Session struct {
+	Name      string           `json:"name"`
+	ModelID   string           `json:"model_id"`
+	System    string           `json:"system,omitempty"` // 会話で使用したシステムプロンプト
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Messages  []SessionMessage `json:"messages"`
+	Usage     Usage            `json:"usage"` // セッション全体で使用したトークン数
+}
+
+// NewSession は、新しいセッションを作成する関数です
+func NewSession(name, modelID string) *Session {
+	now := time.Now()
+	return &Session{
+		Name:      name,
+		ModelID:   modelID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// AddTurn は、ユーザーの入力とそれに対する回答をセッションに追加します
+func (s *Session) AddTurn(input string, answer *ModelResponse, modelID string) {
+	now := time.Now()
+	usage := answer.Usage
+
+	s.Messages = append(s.Messages,
+		SessionMessage{Message: Message{Role: RoleUser, Content: input}, Timestamp: now},
+		SessionMessage{Message: Message{Role: RoleAssistant, Content: answer.Text}, Timestamp: now, ModelID: modelID, Usage: &usage},
+	)
+	s.ModelID = modelID
+	s.Usage.Add(usage)
+	s.UpdatedAt = now
+}
+
+// Undo は、最後のやり取りをセッションから削除します
+func (s *Session) Undo() {
+	if len(s.Messages) > 0 && s.Messages[len(s.Messages)-1].Role == RoleAssistant {
+		s.Messages = s.Messages[:len(s.Messages)-1]
+	}
+	if len(s.Messages) > 0 && s.Messages[len(s.Messages)-1].Role == RoleUser {
+		s.Messages = s.Messages[:len(s.Messages)-1]
+	}
+	s.UpdatedAt = time.Now()
+}
+
+// Reset は、セッションのメッセージをすべて削除します
+func (s *Session) Reset() {
+	s.Messages = nil
+	s.UpdatedAt = time.Now()
+}
+
+// ConversationMessages は、セッションのメッセージを会話履歴として返します
+func (s *Session) ConversationMessages() []Message {
+	messages := make([]Message, 0, len(s.Messages))
+	for _, message := range s.Messages {
+		messages = append(messages, message.Message)
+	}
+	return messages
+}
+
+// WriteMarkdown は、セッションの内容をMarkdown形式で書き出します
+func (s *Session) WriteMarkdown(w io.Writer) error {
+	var md strings.Builder
+	md.WriteString(fmt.Sprintf("# %s\n\n", s.Name))
+	md.WriteString(fmt.Sprintf("- モデル: %s\n", s.ModelID))
+	md.WriteString(fmt.Sprintf("- 作成日時: %s\n", s.CreatedAt.Format(time.RFC3339)))
+	md.WriteString(fmt.Sprintf("- 更新日時: %s\n", s.UpdatedAt.Format(time.RFC3339)))
+	md.WriteString(fmt.Sprintf("- トークン数: 入力 %d / 出力 %d\n", s.Usage.InputTokens, s.Usage.OutputTokens))
+	if s.System != "" {
+		md.WriteString(fmt.Sprintf("\n## システムプロンプト\n\n%s\n", s.System))
+	}
+
+	for _, message := range s.Messages {
+		heading := "ユーザー"
+		if message.Role == RoleAssistant {
+			heading = "アシスタント"
+		}
+		md.WriteString(fmt.Sprintf("\n## %s (%s)\n\n%s\n", heading, message.Timestamp.Format(time.RFC3339), message.Content))
+	}
+
+	_, err := io.WriteString(w, md.String())
+	return err
+}
+
+// セッション名として使用できる文字
+var sessionNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// SessionStore は、セッションをJSONファイルとして保存するローカルストアです
+type SessionStore struct {
+	Dir string // セッションファイルを保存するディレクトリ
+}
+
+// ConfigDir は、hiracliがユーザーごとのデータを保存するディレクトリを返す関数です
+func ConfigDir() (string, error) {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("設定ディレクトリの取得エラー: %v", err)
+	}
+	return filepath.Join(configDir, "hiracli"), nil
+}
+
+// DefaultSessionStore は、ユーザーの設定ディレクトリ配下のセッションストアを返す関数です
+func DefaultSessionStore() (*SessionStore, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &SessionStore{Dir: filepath.Join(configDir, "sessions")}, nil
+}
+
+// path は、セッション名に対応するファイルパスを返します
+func (s *SessionStore) path(name string) (string, error) {
+	if !sessionNamePattern.MatchString(name) || name == "." || name == ".." {
+		return "", fmt.Errorf("不正なセッション名です: %s（英数字と . _ - のみ使用できます）", name)
+	}
+	return filepath.Join(s.Dir, name+".json"), nil
+}
+
+// Load は、指定した名前のセッションを読み込みます
+func (s *SessionStore) Load(name string) (*Session, error) {
+	path, err := s.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("セッション '%s' が見つかりません", name)
+		}
+		return nil, fmt.Errorf("セッションの読み込みエラー: %v", err)
+	}
+
+	var session Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("セッションの解析エラー: %v", err)
+	}
+
+	return &session, nil
+}
+
+// Exists は、指定した名前のセッションが存在するかを返します
+func (s *SessionStore) Exists(name string) bool {
+	path, err := s.path(name)
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(path)
+	return err == nil
+}
+
+// Save は、セッションをファイルに保存します
+func (s *SessionStore) Save(session *Session) error {
+	path, err := s.path(session.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.Dir, 0o700); err != nil {
+		return fmt.Errorf("セッションディレクトリの作成エラー: %v", err)
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("セッションの変換エラー: %v", err)
+	}
+
+	// 書き込み途中で中断されてもファイルが壊れないよう、一時ファイル経由で置き換える
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("セッションの保存エラー: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("セッションの保存エラー: %v", err)
+	}
+
+	return nil
+}
+
+// Remove は、指定した名前のセッションを削除します
+func (s *SessionStore) Remove(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("セッション '%s' が見つかりません", name)
+		}
+		return fmt.Errorf("セッションの削除エラー: %v", err)
+	}
+
+	return nil
+}
+
+// List は、保存されているセッションを更新日時の新しい順に返します
+func (s *SessionStore) List() ([]*Session, error) {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("セッションディレクトリの読み込みエラー: %v", err)
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		session, err := s.Load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "警告: %v\n", err)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].UpdatedAt.After(sessions[j].UpdatedAt)
+	})
+
+	return sessions, nil
+}
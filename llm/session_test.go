@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// SessionStoreの保存・読み込み・一覧・削除のテスト
+func TestSessionStore(t *testing.T) {
+	store := &SessionStore{Dir: t.TempDir()}
+
+	// 存在しないセッション
+	if store.Exists("debug") {
+		t.Fatalf("存在しないセッションが存在すると判定されました")
+	}
+	if _, err := store.Load("debug"); err == nil {
+		t.Fatalf("存在しないセッションの読み込みでエラーが期待されていましたが、成功しました")
+	}
+
+	session := NewSession("debug", "anthropic.claude-3-5-sonnet-20240620-v1:0")
+	session.AddTurn("質問1", &ModelResponse{Text: "回答1", Usage: Usage{InputTokens: 10, OutputTokens: 20}}, "anthropic.claude-3-5-sonnet-20240620-v1:0")
+	session.AddTurn("質問2", &ModelResponse{Text: "回答2", Usage: Usage{InputTokens: 30, OutputTokens: 40}}, "amazon.titan-text-express-v1")
+
+	if err := store.Save(session); err != nil {
+		t.Fatalf("セッションの保存エラー: %v", err)
+	}
+	if !store.Exists("debug") {
+		t.Fatalf("保存したセッションが存在しないと判定されました")
+	}
+
+	loaded, err := store.Load("debug")
+	if err != nil {
+		t.Fatalf("セッションの読み込みエラー: %v", err)
+	}
+
+	if loaded.ModelID != "amazon.titan-text-express-v1" {
+		t.Errorf("モデルIDが期待通りではありません: %s", loaded.ModelID)
+	}
+	if loaded.Usage.InputTokens != 40 || loaded.Usage.OutputTokens != 60 {
+		t.Errorf("トークン数の合計が期待通りではありません: %+v", loaded.Usage)
+	}
+
+	messages := loaded.ConversationMessages()
+	if len(messages) != 4 || messages[0].Content != "質問1" || messages[3].Content != "回答2" {
+		t.Errorf("会話履歴が期待通りではありません: %+v", messages)
+	}
+	if loaded.Messages[1].Usage == nil || loaded.Messages[1].Usage.OutputTokens != 20 {
+		t.Errorf("回答メッセージのトークン数が保存されていません: %+v", loaded.Messages[1])
+	}
+	if loaded.Messages[0].Timestamp.IsZero() {
+		t.Errorf("メッセージの日時が保存されていません")
+	}
+
+	// 一覧
+	if err := store.Save(NewSession("other", "amazon.titan-text-express-v1")); err != nil {
+		t.Fatalf("セッションの保存エラー: %v", err)
+	}
+	sessions, err := store.List()
+	if err != nil {
+		t.Fatalf("セッション一覧の取得エラー: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("セッション数が期待通りではありません。期待: 2, 実際: %d", len(sessions))
+	}
+	if sessions[0].Name != "other" {
+		t.Errorf("セッション一覧が更新日時の新しい順ではありません: %s", sessions[0].Name)
+	}
+
+	// 削除
+	if err := store.Remove("debug"); err != nil {
+		t.Fatalf("セッションの削除エラー: %v", err)
+	}
+	if store.Exists("debug") {
+		t.Errorf("削除したセッションが残っています")
+	}
+	if err := store.Remove("debug"); err == nil {
+		t.Errorf("存在しないセッションの削除でエラーが期待されていましたが、成功しました")
+	}
+}
+
+// 不正なセッション名のテスト
+func TestSessionStoreInvalidName(t *testing.T) {
+	store := &SessionStore{Dir: t.TempDir()}
+
+	for _, name := range []string{"", "..", "../escape", "a/b", "日本語"} {
+		if err := store.Save(NewSession(name, "amazon.titan-text-express-v1")); err == nil {
+			t.Errorf("不正なセッション名「%s」で保存できてしまいました", name)
+		}
+	}
+}
+
+// セッションの取り消しとリセットのテスト
+func TestSessionUndoReset(t *testing.T) {
+	session := NewSession("debug", "amazon.titan-text-express-v1")
+	session.AddTurn("質問1", &ModelResponse{Text: "回答1"}, "amazon.titan-text-express-v1")
+	session.AddTurn("質問2", &ModelResponse{Text: "回答2"}, "amazon.titan-text-express-v1")
+
+	session.Undo()
+	if len(session.Messages) != 2 || session.Messages[1].Content != "回答1" {
+		t.Errorf("取り消し後のメッセージが期待通りではありません: %+v", session.Messages)
+	}
+
+	session.Reset()
+	if len(session.Messages) != 0 {
+		t.Errorf("リセット後にメッセージが残っています: %+v", session.Messages)
+	}
+}
+
+// Markdown形式での出力のテスト
+func TestSessionWriteMarkdown(t *testing.T) {
+	session := NewSession("debug", "amazon.titan-text-express-v1")
+	session.AddTurn("質問1", &ModelResponse{Text: "回答1", Usage: Usage{InputTokens: 10, OutputTokens: 20}}, "amazon.titan-text-express-v1")
+
+	var buf bytes.Buffer
+	if err := session.WriteMarkdown(&buf); err != nil {
+		t.Fatalf("Markdownの出力エラー: %v", err)
+	}
+
+	output := buf.String()
+	for _, expected := range []string{"# debug", "- モデル: amazon.titan-text-express-v1", "入力 10 / 出力 20", "## ユーザー", "質問1", "## アシスタント", "回答1"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Markdownに「%s」が含まれていません。\n実際の出力:\n%s", expected, output)
+		}
+	}
+}
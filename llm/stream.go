@@ -0,0 +1,83 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// ストリームの最後のチャンクに含まれるBedrockの呼び出しメトリクス
+type invocationMetricsChunk struct {
+	Metrics *struct {
+		InputTokenCount  int `json:"inputTokenCount"`
+		OutputTokenCount int `json:"outputTokenCount"`
+	} `json:"amazon-bedrock-invocationMetrics"`
+}
+
+// readResponseStream は、InvokeModelWithResponseStreamのイベントストリームを読み取り、
+// 回答の差分を受信するたびに出力先へ書き出す関数です
+// 戻り値のModelResponseには、途中でエラーになった場合もそれまでに受信した回答が含まれます
+func readResponseStream(ctx context.Context, stream bedrockruntime.ResponseStreamReader, family StreamingModelFamily, out io.Writer) (*ModelResponse, error) {
+	defer stream.Close()
+
+	var answer strings.Builder
+	var usage Usage
+	var stopReason string
+	var truncated bool
+	events := stream.Events()
+
+	// result は、ここまでに受信した内容をModelResponseにまとめる
+	result := func() *ModelResponse {
+		return &ModelResponse{Text: answer.String(), Usage: usage, StopReason: stopReason, Truncated: truncated}
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return result(), fmt.Errorf("ストリーミングを中断しました: %w", ctx.Err())
+		case event, ok := <-events:
+			if !ok {
+				// ストリームの終了時に受信エラーがないか確認
+				if err := stream.Err(); err != nil {
+					return result(), fmt.Errorf("ストリーミング中のエラー: %w", err)
+				}
+				return result(), nil
+			}
+
+			chunk, ok := event.(*types.ResponseStreamMemberChunk)
+			if !ok {
+				continue
+			}
+
+			delta, err := family.ParseStreamChunk(chunk.Value.Bytes)
+			if err != nil {
+				return result(), err
+			}
+
+			// トークン数はモデルファミリーに依存しない呼び出しメトリクスから取得
+			var metrics invocationMetricsChunk
+			if err := json.Unmarshal(chunk.Value.Bytes, &metrics); err == nil && metrics.Metrics != nil {
+				usage = Usage{
+					InputTokens:  metrics.Metrics.InputTokenCount,
+					OutputTokens: metrics.Metrics.OutputTokenCount,
+				}
+			}
+
+			// 終了理由は最後のチャンクにのみ含まれることが多いため、空でない値を保持する
+			if delta.StopReason != "" {
+				stopReason = delta.StopReason
+			}
+			truncated = truncated || delta.Truncated
+
+			if delta.Text != "" {
+				answer.WriteString(delta.Text)
+				fmt.Fprint(out, delta.Text)
+			}
+		}
+	}
+}
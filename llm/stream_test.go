@@ -0,0 +1,242 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// モックのレスポンスストリーム
+type MockResponseStreamReader struct {
+	events chan types.ResponseStream
+	err    error
+}
+
+// チャンクを順に送信するモックのレスポンスストリームを作成
+// errが指定された場合は、全チャンクの送信後にストリームのエラーとして返す
+func newMockResponseStreamReader(chunks []string, err error) *MockResponseStreamReader {
+	events := make(chan types.ResponseStream, len(chunks))
+	for _, chunk := range chunks {
+		events <- &types.ResponseStreamMemberChunk{Value: types.PayloadPart{Bytes: []byte(chunk)}}
+	}
+	close(events)
+	return &MockResponseStreamReader{events: events, err: err}
+}
+
+func (m *MockResponseStreamReader) Events() <-chan types.ResponseStream {
+	return m.events
+}
+
+func (m *MockResponseStreamReader) Close() error {
+	return nil
+}
+
+func (m *MockResponseStreamReader) Err() error {
+	return m.err
+}
+
+// 各モデルファミリーのストリーミングレスポンスのテスト
+func TestReadResponseStream(t *testing.T) {
+	testCases := []struct {
+		modelID      string
+		chunks       []string
+		expectAnswer string
+	}{
+		{
+			modelID: "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			chunks: []string{
+				`{"type":"message_start","message":{"role":"assistant"}}`,
+				`{"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"こんにちは、"}}`,
+				`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Claudeです"}}`,
+				`{"type":"content_block_stop","index":0}`,
+				`{"type":"message_delta","delta":{"stop_reason":"end_turn"}}`,
+				`{"type":"message_stop"}`,
+			},
+			expectAnswer: "こんにちは、Claudeです",
+		},
+		{
+			modelID: "amazon.titan-text-express-v1",
+			chunks: []string{
+				`{"outputText":"こんにちは、","index":0}`,
+				`{"outputText":"Titanです","index":0,"completionReason":"FINISH"}`,
+			},
+			expectAnswer: "こんにちは、Titanです",
+		},
+		{
+			modelID: "meta.llama3-8b-instruct-v1:0",
+			chunks: []string{
+				`{"generation":"こんにちは、","stop_reason":null}`,
+				`{"generation":"Llamaです","stop_reason":"stop"}`,
+			},
+			expectAnswer: "こんにちは、Llamaです",
+		},
+		{
+			modelID: "mistral.mistral-7b-instruct-v0:2",
+			chunks: []string{
+				`{"outputs":[{"text":"こんにちは、","stop_reason":null}]}`,
+				`{"outputs":[{"text":"Mistralです","stop_reason":"stop"}]}`,
+			},
+			expectAnswer: "こんにちは、Mistralです",
+		},
+		{
+			modelID: "cohere.command-text-v14",
+			chunks: []string{
+				`{"text":"こんにちは、","is_finished":false}`,
+				`{"text":"Cohereです","is_finished":false}`,
+				`{"is_finished":true,"finish_reason":"COMPLETE"}`,
+			},
+			expectAnswer: "こんにちは、Cohereです",
+		},
+		{
+			modelID: "cohere.command-r-v1:0",
+			chunks: []string{
+				`{"event_type":"stream-start","is_finished":false}`,
+				`{"event_type":"text-generation","text":"こんにちは、","is_finished":false}`,
+				`{"event_type":"text-generation","text":"Command Rです","is_finished":false}`,
+				`{"event_type":"stream-end","finish_reason":"COMPLETE","is_finished":true}`,
+			},
+			expectAnswer: "こんにちは、Command Rです",
+		},
+		{
+			modelID: "ai21.jamba-instruct-v1:0",
+			chunks: []string{
+				`{"choices":[{"index":0,"delta":{"role":"assistant","content":""},"finish_reason":null}]}`,
+				`{"choices":[{"index":0,"delta":{"content":"こんにちは、Jambaです"},"finish_reason":null}]}`,
+				`{"choices":[{"index":0,"delta":{},"finish_reason":"stop"}]}`,
+			},
+			expectAnswer: "こんにちは、Jambaです",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			family, err := FindModelFamily(tc.modelID)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			streamingFamily, ok := family.(StreamingModelFamily)
+			if !ok {
+				t.Fatalf("モデルファミリー「%s」がストリーミングに対応していません", family.Name())
+			}
+
+			var out bytes.Buffer
+			response, err := readResponseStream(context.Background(), newMockResponseStreamReader(tc.chunks, nil), streamingFamily, &out)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			if response.Text != tc.expectAnswer {
+				t.Errorf("回答が期待通りではありません。期待: %s, 実際: %s", tc.expectAnswer, response.Text)
+			}
+			if out.String() != tc.expectAnswer {
+				t.Errorf("出力が期待通りではありません。期待: %s, 実際: %s", tc.expectAnswer, out.String())
+			}
+		})
+	}
+}
+
+// ストリーミングに対応していないモデルファミリーのテスト
+func TestStreamingNotSupported(t *testing.T) {
+	family, err := FindModelFamily("ai21.j2-ultra-v1")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	if _, ok := family.(StreamingModelFamily); ok {
+		t.Errorf("Jurassic-2はストリーミング非対応として扱われるべきです")
+	}
+}
+
+// ストリーミング中にエラーが発生した場合のテスト
+func TestReadResponseStreamError(t *testing.T) {
+	family, _ := FindModelFamily("amazon.titan-text-express-v1")
+	chunks := []string{`{"outputText":"途中まで"}`}
+	streamErr := errors.New("ModelStreamErrorException: 接続が切断されました")
+
+	var out bytes.Buffer
+	response, err := readResponseStream(context.Background(), newMockResponseStreamReader(chunks, streamErr), family.(StreamingModelFamily), &out)
+	if err == nil {
+		t.Fatalf("エラーが期待されていましたが、成功しました")
+	}
+	if !strings.Contains(err.Error(), "ストリーミング中のエラー") {
+		t.Errorf("エラーメッセージが期待通りではありません: %v", err)
+	}
+	// 再試行やエラーの分類のため、元のエラーを参照できる
+	if !errors.Is(err, streamErr) {
+		t.Errorf("元のエラーがラップされていません: %v", err)
+	}
+
+	// エラー発生までに受信した回答は保持される
+	if response.Text != "途中まで" {
+		t.Errorf("受信済みの回答が保持されていません: %s", response.Text)
+	}
+}
+
+// ストリーミング中にキャンセルされた場合のテスト
+func TestReadResponseStreamCancel(t *testing.T) {
+	family, _ := FindModelFamily("amazon.titan-text-express-v1")
+
+	// チャンクを送信しないままのストリーム
+	stream := &MockResponseStreamReader{events: make(chan types.ResponseStream)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var out bytes.Buffer
+	_, err := readResponseStream(ctx, stream, family.(StreamingModelFamily), &out)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("キャンセルエラーが期待されていましたが、%v が返されました", err)
+	}
+}
+
+// ストリームの呼び出しメトリクスからトークン数を取得するテスト
+func TestReadResponseStreamUsage(t *testing.T) {
+	family, _ := FindModelFamily("meta.llama3-8b-instruct-v1:0")
+	chunks := []string{
+		`{"generation":"回答","prompt_token_count":5,"generation_token_count":1,"stop_reason":null}`,
+		`{"generation":"","generation_token_count":2,"stop_reason":"stop","amazon-bedrock-invocationMetrics":{"inputTokenCount":5,"outputTokenCount":2,"invocationLatency":100,"firstByteLatency":50}}`,
+	}
+
+	var out bytes.Buffer
+	response, err := readResponseStream(context.Background(), newMockResponseStreamReader(chunks, nil), family.(StreamingModelFamily), &out)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	expected := Usage{InputTokens: 5, OutputTokens: 2}
+	if response.Usage != expected {
+		t.Errorf("トークン数が期待通りではありません。期待: %+v, 実際: %+v", expected, response.Usage)
+	}
+}
+
+// 最大出力トークン数で途切れたストリームの終了理由が保持されるかのテスト
+func TestReadResponseStreamTruncated(t *testing.T) {
+	family, err := FindModelFamily("anthropic.claude-3-5-sonnet-20240620-v1:0")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+
+	stream := newMockResponseStreamReader([]string{
+		`{"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"途中まで"}}`,
+		`{"type":"message_delta","delta":{"stop_reason":"max_tokens"}}`,
+		`{"type":"message_stop"}`,
+	}, nil)
+
+	var out bytes.Buffer
+	response, err := readResponseStream(context.Background(), stream, family.(StreamingModelFamily), &out)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if response.StopReason != "max_tokens" {
+		t.Errorf("終了理由が期待通りではありません。期待: max_tokens, 実際: %s", response.StopReason)
+	}
+	if !response.Truncated {
+		t.Error("回答が途切れたことが検出されていません")
+	}
+}
@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateData は、プロンプトテンプレートに渡す変数を定義する構造体です
+type TemplateData struct {
+	Input string            // ユーザーの入力（質問）
+	Diff  string            // git diffの結果
+	Files string            // 添付したファイルの内容
+	Lang  string            // 回答に使用する言語
+	Vars  map[string]string // --varで指定した任意の変数
+}
+
+// RenderedPrompt は、テンプレートから生成したプロンプトを定義する構造体です
+type RenderedPrompt struct {
+	System string // テンプレートのsystemブロックから生成したシステムプロンプト
+	Prompt string // テンプレート本体から生成したプロンプト
+}
+
+// テンプレートファイルの拡張子
+const templateExt = ".tmpl"
+
+// 組み込みのプロンプトテンプレート
+// 同じ名前のファイルがテンプレートディレクトリにある場合は、そちらが優先されます
+var builtinTemplates = map[string]string{
+	"diff-comment": `# git diff{{.Vars.DiffType}}
+{{.Diff}}
+{{.Lang}}のコミットメッセージを作って`,
+	"explain": `{{define "system"}}あなたは経験豊富なソフトウェアエンジニアです。{{.Lang}}で簡潔に回答してください。{{end}}{{.Input}}
+{{if .Files}}
+{{.Files}}{{end}}`,
+	"review": `{{define "system"}}あなたは厳格なコードレビュアーです。バグ、セキュリティ上の問題、可読性の順に指摘し、{{.Lang}}で回答してください。{{end}}以下のコードをレビューしてください。{{if .Input}}
+{{.Input}}{{end}}
+{{if .Files}}
+{{.Files}}{{end}}{{if .Diff}}
+{{.Diff}}{{end}}`,
+}
+
+// TemplateDir は、ユーザー定義のプロンプトテンプレートを配置するディレクトリを返す関数です
+func TemplateDir() (string, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "templates"), nil
+}
+
+// TemplateSource は、指定した名前のプロンプトテンプレートの内容を返す関数です
+// テンプレートディレクトリのファイルを優先し、見つからない場合は組み込みのテンプレートを使用します
+func TemplateSource(name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("不正なテンプレート名です: %s", name)
+	}
+
+	dir, err := TemplateDir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, name+templateExt))
+	if err == nil {
+		return string(data), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("テンプレートの読み込みエラー: %v", err)
+	}
+
+	text, ok := builtinTemplates[name]
+	if !ok {
+		return "", fmt.Errorf("テンプレート '%s' が見つかりません", name)
+	}
+	return text, nil
+}
+
+// LoadTemplate は、指定した名前のプロンプトテンプレートを読み込んで解析する関数です
+func LoadTemplate(name string) (*template.Template, error) {
+	text, err := TemplateSource(name)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("テンプレート '%s' の解析エラー: %v", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// RenderTemplate は、指定した名前のプロンプトテンプレートに変数を適用してプロンプトを生成する関数です
+// テンプレートに {{define "system"}} ブロックがある場合は、システムプロンプトとして生成します
+func RenderTemplate(name string, data TemplateData) (*RenderedPrompt, error) {
+	tmpl, err := LoadTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.Vars == nil {
+		data.Vars = map[string]string{}
+	}
+
+	var prompt strings.Builder
+	if err := tmpl.Execute(&prompt, data); err != nil {
+		return nil, fmt.Errorf("テンプレート '%s' の適用エラー: %v", name, err)
+	}
+
+	rendered := &RenderedPrompt{Prompt: strings.TrimSpace(prompt.String())}
+
+	if system := tmpl.Lookup("system"); system != nil {
+		var systemPrompt strings.Builder
+		if err := system.Execute(&systemPrompt, data); err != nil {
+			return nil, fmt.Errorf("テンプレート '%s' のシステムプロンプトの適用エラー: %v", name, err)
+		}
+		rendered.System = strings.TrimSpace(systemPrompt.String())
+	}
+
+	return rendered, nil
+}
+
+// ListTemplates は、利用可能なプロンプトテンプレート名の一覧を返す関数です
+// 戻り値のmapの値は、テンプレートディレクトリのファイルの場合はファイルパス、組み込みの場合は空文字列です
+func ListTemplates() (map[string]string, error) {
+	templates := map[string]string{}
+	for name := range builtinTemplates {
+		templates[name] = ""
+	}
+
+	dir, err := TemplateDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("テンプレートディレクトリの読み込みエラー: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != templateExt {
+			continue
+		}
+		templates[strings.TrimSuffix(entry.Name(), templateExt)] = filepath.Join(dir, entry.Name())
+	}
+
+	return templates, nil
+}
+
+// SortedTemplateNames は、テンプレート一覧の名前を昇順で返す関数です
+func SortedTemplateNames(templates map[string]string) []string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
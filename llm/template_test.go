@@ -0,0 +1,136 @@
+package llm
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// テスト用にユーザーの設定ディレクトリを一時ディレクトリに切り替え、テンプレートディレクトリを返す
+func setupTemplateDir(t *testing.T) string {
+	t.Helper()
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	t.Setenv("HOME", configHome)
+
+	dir, err := TemplateDir()
+	if err != nil {
+		t.Fatalf("テンプレートディレクトリの取得エラー: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("テンプレートディレクトリの作成エラー: %v", err)
+	}
+	return dir
+}
+
+// 組み込みテンプレートの適用のテスト
+func TestRenderBuiltinTemplate(t *testing.T) {
+	setupTemplateDir(t)
+
+	rendered, err := RenderTemplate("diff-comment", TemplateData{
+		Diff: "diff --git a/main.go b/main.go",
+		Lang: "English",
+		Vars: map[string]string{"DiffType": " --cached"},
+	})
+	if err != nil {
+		t.Fatalf("テンプレートの適用エラー: %v", err)
+	}
+
+	for _, expected := range []string{"# git diff --cached", "diff --git a/main.go b/main.go", "Englishのコミットメッセージを作って"} {
+		if !strings.Contains(rendered.Prompt, expected) {
+			t.Errorf("プロンプトに「%s」が含まれていません。\n実際のプロンプト:\n%s", expected, rendered.Prompt)
+		}
+	}
+	if rendered.System != "" {
+		t.Errorf("systemブロックのないテンプレートでシステムプロンプトが生成されました: %s", rendered.System)
+	}
+
+	// systemブロックを持つ組み込みテンプレート
+	rendered, err = RenderTemplate("explain", TemplateData{Input: "goroutineとは？", Lang: "日本語"})
+	if err != nil {
+		t.Fatalf("テンプレートの適用エラー: %v", err)
+	}
+	if rendered.Prompt != "goroutineとは？" {
+		t.Errorf("プロンプトが期待通りではありません: %q", rendered.Prompt)
+	}
+	if !strings.Contains(rendered.System, "日本語で簡潔に回答してください") {
+		t.Errorf("システムプロンプトが期待通りではありません: %q", rendered.System)
+	}
+}
+
+// ユーザー定義テンプレートのテスト
+func TestRenderUserTemplate(t *testing.T) {
+	dir := setupTemplateDir(t)
+
+	userTemplate := `{{define "system"}}{{.Lang}}で回答するレビュアーです{{end}}チーム規約: {{.Vars.rule}}
+{{.Input}}`
+	if err := os.WriteFile(filepath.Join(dir, "team"+templateExt), []byte(userTemplate), 0o644); err != nil {
+		t.Fatalf("テンプレートの作成エラー: %v", err)
+	}
+
+	// 組み込みテンプレートの上書き
+	if err := os.WriteFile(filepath.Join(dir, "diff-comment"+templateExt), []byte("custom {{.Diff}}"), 0o644); err != nil {
+		t.Fatalf("テンプレートの作成エラー: %v", err)
+	}
+
+	rendered, err := RenderTemplate("team", TemplateData{
+		Input: "このコードを見て",
+		Lang:  "日本語",
+		Vars:  map[string]string{"rule": "エラーは必ずラップする"},
+	})
+	if err != nil {
+		t.Fatalf("テンプレートの適用エラー: %v", err)
+	}
+	if rendered.Prompt != "チーム規約: エラーは必ずラップする\nこのコードを見て" {
+		t.Errorf("プロンプトが期待通りではありません: %q", rendered.Prompt)
+	}
+	if rendered.System != "日本語で回答するレビュアーです" {
+		t.Errorf("システムプロンプトが期待通りではありません: %q", rendered.System)
+	}
+
+	// 未指定の変数は空文字列として扱う
+	rendered, err = RenderTemplate("team", TemplateData{Input: "質問"})
+	if err != nil {
+		t.Fatalf("テンプレートの適用エラー: %v", err)
+	}
+	if rendered.Prompt != "チーム規約: \n質問" {
+		t.Errorf("未指定の変数の扱いが期待通りではありません: %q", rendered.Prompt)
+	}
+
+	rendered, err = RenderTemplate("diff-comment", TemplateData{Diff: "DIFF"})
+	if err != nil {
+		t.Fatalf("テンプレートの適用エラー: %v", err)
+	}
+	if rendered.Prompt != "custom DIFF" {
+		t.Errorf("ユーザー定義のテンプレートが優先されていません: %q", rendered.Prompt)
+	}
+
+	// 一覧
+	templates, err := ListTemplates()
+	if err != nil {
+		t.Fatalf("テンプレート一覧の取得エラー: %v", err)
+	}
+	names := SortedTemplateNames(templates)
+	if strings.Join(names, ",") != "diff-comment,explain,review,team" {
+		t.Errorf("テンプレート一覧が期待通りではありません: %v", names)
+	}
+	if templates["explain"] != "" || templates["team"] == "" {
+		t.Errorf("テンプレートの配置場所が期待通りではありません: %v", templates)
+	}
+}
+
+// テンプレートのエラーのテスト
+func TestRenderTemplateErrors(t *testing.T) {
+	dir := setupTemplateDir(t)
+
+	if err := os.WriteFile(filepath.Join(dir, "broken"+templateExt), []byte("{{.Input"), 0o644); err != nil {
+		t.Fatalf("テンプレートの作成エラー: %v", err)
+	}
+
+	for _, name := range []string{"unknown", "broken", "../escape", ""} {
+		if _, err := RenderTemplate(name, TemplateData{}); err == nil {
+			t.Errorf("テンプレート「%s」でエラーが期待されていましたが、成功しました", name)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+)
+
+// トークナイザーの名前
+const (
+	TokenizerCL100K    = "cl100k"    // cl100k_base のBPE（オフライン）
+	TokenizerO200K     = "o200k"     // o200k_base のBPE（オフライン）
+	TokenizerHeuristic = "heuristic" // 単語・記号・文字種からの推定（CJKを考慮）
+)
+
+// DefaultTokenizer は、設定ファイルでトークナイザーが指定されていない場合に使用するトークナイザーです
+// Claudeのトークナイザーは公開されていないため、近い数になるcl100k_baseを使用します
+const DefaultTokenizer = TokenizerCL100K
+
+// BPEのトークナイザーとtiktokenのエンコーディング名（トークナイザーの名前: エンコーディング名）
+var bpeEncodings = map[string]string{
+	TokenizerCL100K: tiktoken.MODEL_CL100K_BASE,
+	TokenizerO200K:  tiktoken.MODEL_O200K_BASE,
+}
+
+// Tokenizer は、テキストのトークン数を数えるインターフェースです
+type Tokenizer interface {
+	Name() string                // トークナイザーの名前
+	CountTokens(text string) int // テキストのトークン数
+}
+
+// TokenizerNames は、使用できるトークナイザーの名前を返す関数です
+func TokenizerNames() []string {
+	return []string{TokenizerCL100K, TokenizerO200K, TokenizerHeuristic}
+}
+
+// ValidateTokenizer は、トークナイザーの名前を検証する関数です（空文字列はデフォルト）
+func ValidateTokenizer(name string) error {
+	if name == "" || name == TokenizerHeuristic || bpeEncodings[name] != "" {
+		return nil
+	}
+	return fmt.Errorf("不明なトークナイザーです: %s（%s のいずれかを指定してください）", name, strings.Join(TokenizerNames(), "、"))
+}
+
+// 読み込んだBPEのエンコーディング（語彙の読み込みに時間がかかるため、エンコーディングごとに一度だけ読み込む）
+var (
+	bpeMu      sync.Mutex
+	bpeLoaded  = map[string]*tiktoken.Tiktoken{}
+	loaderOnce sync.Once
+)
+
+// NewTokenizer は、名前に対応するトークナイザーを返す関数です（空文字列の場合はデフォルト）
+// BPEの語彙はバイナリに同梱しているため、ネットワークには接続しません
+func NewTokenizer(name string) (Tokenizer, error) {
+	if name == "" {
+		name = DefaultTokenizer
+	}
+	if err := ValidateTokenizer(name); err != nil {
+		return nil, err
+	}
+	if name == TokenizerHeuristic {
+		return heuristicTokenizer{}, nil
+	}
+
+	loaderOnce.Do(func() {
+		tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+	})
+
+	bpeMu.Lock()
+	defer bpeMu.Unlock()
+	encoding, ok := bpeLoaded[name]
+	if !ok {
+		var err error
+		encoding, err = tiktoken.GetEncoding(bpeEncodings[name])
+		if err != nil {
+			return nil, fmt.Errorf("トークナイザーの読み込みエラー（%s）: %v", name, err)
+		}
+		bpeLoaded[name] = encoding
+	}
+	return bpeTokenizer{name: name, encoding: encoding}, nil
+}
+
+// bpeTokenizer は、tiktokenのBPEでトークン数を数えるトークナイザーです
+type bpeTokenizer struct {
+	name     string
+	encoding *tiktoken.Tiktoken
+}
+
+func (t bpeTokenizer) Name() string {
+	return t.name
+}
+
+// CountTokens は、テキストのトークン数を返します
+// <|endoftext|> などの特殊トークンも通常のテキストとして数えます
+func (t bpeTokenizer) CountTokens(text string) int {
+	return len(t.encoding.EncodeOrdinary(text))
+}
+
+// heuristicTokenizer は、estimateTokensでトークン数を推定するトークナイザーです
+type heuristicTokenizer struct{}
+
+func (heuristicTokenizer) Name() string {
+	return TokenizerHeuristic
+}
+
+func (heuristicTokenizer) CountTokens(text string) int {
+	return estimateTokens(text)
+}
+
+// isCJK は、空白で単語を区切らない言語の文字（漢字、かな、ハングル、全角の記号）かを返す関数です
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) ||
+		(r >= 0x3000 && r <= 0x303F) || // CJKの記号と句読点
+		(r >= 0xFF00 && r <= 0xFFEF) // 全角英数と半角カナ
+}
+
+// TokenCount は、count-tokensで表示するファイルごとのトークン数を定義する構造体です
+type TokenCount struct {
+	Name       string `json:"name" yaml:"name"` // ファイルのパス（標準入力の場合は -）
+	Tokens     int    `json:"tokens" yaml:"tokens"`
+	Characters int    `json:"characters" yaml:"characters"`
+	Bytes      int    `json:"bytes" yaml:"bytes"`
+}
+
+// CountTokensOptions は、count-tokensコマンドのオプションを定義する構造体です
+type CountTokensOptions struct {
+	Files     []string  // トークン数を数えるファイル（空の場合や - は標準入力）
+	Tokenizer string    // トークナイザーの名前（空の場合はデフォルト）
+	Format    string    // 出力形式（table、json、yaml）
+	Input     io.Reader // 標準入力（nilの場合はos.Stdin）
+	Output    io.Writer // 出力先（nilの場合はos.Stdout）
+}
+
+// CountTokens は、ファイルまたは標準入力のトークン数を数えて表示する関数です
+// 表形式で複数のファイルを指定した場合は、合計も表示します
+func CountTokens(opts CountTokensOptions) error {
+	switch opts.Format {
+	case "", ListOutputTable, ListOutputJSON, ListOutputYAML:
+	default:
+		return fmt.Errorf("不正な出力形式です: %s（table、json、yaml のいずれかを指定してください）", opts.Format)
+	}
+	tokenizer, err := NewTokenizer(opts.Tokenizer)
+	if err != nil {
+		return err
+	}
+
+	input, output := opts.Input, opts.Output
+	if input == nil {
+		input = os.Stdin
+	}
+	if output == nil {
+		output = os.Stdout
+	}
+
+	files := opts.Files
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+
+	var counts []TokenCount
+	total := TokenCount{Name: "TOTAL"}
+	for _, file := range files {
+		var data []byte
+		if file == "-" {
+			data, err = io.ReadAll(input)
+			if err != nil {
+				return fmt.Errorf("標準入力の読み込みエラー: %v", err)
+			}
+		} else {
+			data, err = os.ReadFile(file)
+			if err != nil {
+				return fmt.Errorf("ファイルの読み込みエラー: %v", err)
+			}
+		}
+
+		text := string(data)
+		count := TokenCount{Name: file, Tokens: tokenizer.CountTokens(text), Characters: utf8.RuneCountInString(text), Bytes: len(data)}
+		counts = append(counts, count)
+		total.Tokens += count.Tokens
+		total.Characters += count.Characters
+		total.Bytes += count.Bytes
+	}
+
+	if (opts.Format == "" || opts.Format == ListOutputTable) && len(counts) > 1 {
+		counts = append(counts, total)
+	}
+	return writeList(output, counts, opts.Format, "TOKENS\tCHARS\tBYTES\tFILE", func(c TokenCount) string {
+		return c.Name
+	}, func(c TokenCount) []string {
+		return []string{strconv.Itoa(c.Tokens), strconv.Itoa(c.Characters), strconv.Itoa(c.Bytes), c.Name}
+	})
+}
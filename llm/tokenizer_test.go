@@ -0,0 +1,119 @@
+package llm
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// トークナイザーのテスト
+func TestTokenizer(t *testing.T) {
+	testCases := []struct {
+		name      string
+		tokenizer string
+		text      string
+		expect    int
+	}{
+		{name: "cl100k", tokenizer: TokenizerCL100K, text: "hello world", expect: 2},
+		{name: "デフォルト", tokenizer: "", text: "hello world", expect: 2},
+		{name: "o200k", tokenizer: TokenizerO200K, text: "hello world", expect: 2},
+		{name: "特殊トークンも通常のテキストとして数える", tokenizer: TokenizerCL100K, text: "<|endoftext|>", expect: 7},
+		{name: "空文字列", tokenizer: TokenizerCL100K, text: "", expect: 0},
+		{name: "推定", tokenizer: TokenizerHeuristic, text: "func main() {}", expect: 5},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tokenizer, err := NewTokenizer(tc.tokenizer)
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if actual := tokenizer.CountTokens(tc.text); actual != tc.expect {
+				t.Errorf("トークン数が期待通りではありません。期待: %d, 実際: %d", tc.expect, actual)
+			}
+		})
+	}
+
+	if _, err := NewTokenizer("claude"); err == nil {
+		t.Error("不明なトークナイザーでエラーが期待されました")
+	}
+}
+
+// 日本語を含むテキストのトークン数の推定のテスト
+func TestEstimateTokensCJK(t *testing.T) {
+	testCases := []struct {
+		name   string
+		text   string
+		expect int
+	}{
+		// 漢字6文字（7トークン）+ かなと句点6文字
+		{name: "日本語のみ", text: "日本語の文章を書きます。", expect: 13},
+		// 英単語2つ + 漢字2文字（2トークン）+ かな1文字
+		{name: "英語と日本語", text: "Go言語の test", expect: 5},
+		{name: "英語のみ", text: "hello world", expect: 2},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := estimateTokens(tc.text); actual != tc.expect {
+				t.Errorf("推定トークン数が期待通りではありません。期待: %d, 実際: %d", tc.expect, actual)
+			}
+		})
+	}
+
+	// 空白を含まない長い日本語の文章を少なく見積もらない
+	text := strings.Repeat("トークン数の推定は日本語で大きくずれることがあります。", 20)
+	tokenizer, err := NewTokenizer(TokenizerCL100K)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if actual, bpe := estimateTokens(text), tokenizer.CountTokens(text); actual < bpe*3/4 || actual > bpe*5/4 {
+		t.Errorf("推定トークン数がBPEのトークン数から離れています。推定: %d, BPE: %d", actual, bpe)
+	}
+}
+
+// トークン数の表示のテスト
+func TestCountTokens(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.md")}
+	writeTestFiles(t, dir, map[string]string{"a.txt": "hello world", "b.md": "こんにちは"})
+
+	// 表形式で複数のファイルを指定した場合は合計を表示する
+	var stdout bytes.Buffer
+	if err := CountTokens(CountTokensOptions{Files: files, Output: &stdout}); err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[0], "TOKENS") || !strings.HasSuffix(lines[3], "TOTAL") {
+		t.Errorf("表形式の出力が期待通りではありません:\n%s", stdout.String())
+	}
+
+	// 標準入力から読み込み、JSON形式で出力する
+	stdout.Reset()
+	err := CountTokens(CountTokensOptions{
+		Tokenizer: TokenizerHeuristic,
+		Format:    ListOutputJSON,
+		Input:     strings.NewReader("日本語"),
+		Output:    &stdout,
+	})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	var counts []TokenCount
+	if err := json.Unmarshal(stdout.Bytes(), &counts); err != nil {
+		t.Fatalf("JSONの解析エラー: %v", err)
+	}
+	if len(counts) != 1 || counts[0].Name != "-" || counts[0].Tokens != 3 || counts[0].Characters != 3 || counts[0].Bytes != 9 {
+		t.Errorf("トークン数が期待通りではありません: %+v", counts)
+	}
+
+	// 存在しないファイルと不正な出力形式
+	if err := CountTokens(CountTokensOptions{Files: []string{filepath.Join(dir, "missing")}, Output: &stdout}); err == nil {
+		t.Error("存在しないファイルでエラーが期待されました")
+	}
+	if err := CountTokens(CountTokensOptions{Format: ListOutputIDs, Input: strings.NewReader(""), Output: &stdout}); err == nil {
+		t.Error("不正な出力形式でエラーが期待されました")
+	}
+}
@@ -0,0 +1,371 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Tool は、モデルに提供するツールを定義する構造体です
+type Tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"input_schema"` // 入力のJSONスキーマ
+
+	// Run は、モデルが指定した入力（JSON）でツールを実行し、結果のテキストを返します
+	Run func(ctx context.Context, input json.RawMessage) (string, error) `json:"-"`
+}
+
+// ToolRegistry は、モデルに提供するツールを登録順に管理する構造体です
+type ToolRegistry struct {
+	tools []Tool
+}
+
+// NewToolRegistry は、指定されたツールを登録したToolRegistryを作成する関数です
+func NewToolRegistry(tools ...Tool) (*ToolRegistry, error) {
+	registry := &ToolRegistry{}
+	for _, tool := range tools {
+		if err := registry.Register(tool); err != nil {
+			return nil, err
+		}
+	}
+	return registry, nil
+}
+
+// Register は、ツールを登録します
+func (r *ToolRegistry) Register(tool Tool) error {
+	if tool.Name == "" || tool.Run == nil {
+		return fmt.Errorf("ツールには名前と実行関数が必要です")
+	}
+	if _, ok := r.Get(tool.Name); ok {
+		return fmt.Errorf("ツールが重複しています: %s", tool.Name)
+	}
+	r.tools = append(r.tools, tool)
+	return nil
+}
+
+// Get は、名前に対応するツールを返します
+func (r *ToolRegistry) Get(name string) (Tool, bool) {
+	for _, tool := range r.tools {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return Tool{}, false
+}
+
+// Tools は、登録されているツールを登録順に返します
+func (r *ToolRegistry) Tools() []Tool {
+	return r.tools
+}
+
+// Select は、指定された名前のツールのみを登録したToolRegistryを返します
+// "all" を指定した場合は、すべてのツールを返します
+func (r *ToolRegistry) Select(names []string) (*ToolRegistry, error) {
+	selected := &ToolRegistry{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			return r, nil
+		}
+		tool, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("不明なツールです: %s（利用可能なツール: %s）", name, strings.Join(r.names(), ", "))
+		}
+		if _, ok := selected.Get(name); !ok {
+			selected.tools = append(selected.tools, tool)
+		}
+	}
+	return selected, nil
+}
+
+// names は、登録されているツールの名前を返します
+func (r *ToolRegistry) names() []string {
+	names := make([]string, 0, len(r.tools))
+	for _, tool := range r.tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+// ツールの出力の上限（バイト数）
+const maxToolOutputBytes = 100 * 1024
+
+// grepツールで返す一致行の上限
+const maxGrepMatches = 200
+
+// BuiltinTools は、組み込みのツールを登録したToolRegistryを作成する関数です
+// ツールが読み書きできるのはbaseDir配下のみです
+func BuiltinTools(baseDir string) *ToolRegistry {
+	registry, _ := NewToolRegistry(
+		Tool{
+			Name:        "read_file",
+			Description: "作業ディレクトリ配下のテキストファイルの内容を読み込みます。",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{"type": "string", "description": "作業ディレクトリからの相対パス"},
+				},
+				"required": []string{"path"},
+			},
+			Run: func(ctx context.Context, input json.RawMessage) (string, error) {
+				var args struct {
+					Path string `json:"path"`
+				}
+				if err := parseToolInput(input, &args); err != nil {
+					return "", err
+				}
+				path, err := resolveToolPath(baseDir, args.Path)
+				if err != nil {
+					return "", err
+				}
+				data, err := os.ReadFile(path)
+				if err != nil {
+					return "", fmt.Errorf("ファイルの読み込みに失敗しました: %v", err)
+				}
+				return truncateToolOutput(string(data)), nil
+			},
+		},
+		Tool{
+			Name:        "list_directory",
+			Description: "作業ディレクトリ配下のディレクトリに含まれるファイルとディレクトリの一覧を返します。ディレクトリには末尾に / が付きます。",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"path": map[string]interface{}{"type": "string", "description": "作業ディレクトリからの相対パス（省略時は作業ディレクトリ）"},
+				},
+			},
+			Run: func(ctx context.Context, input json.RawMessage) (string, error) {
+				var args struct {
+					Path string `json:"path"`
+				}
+				if err := parseToolInput(input, &args); err != nil {
+					return "", err
+				}
+				path, err := resolveToolPath(baseDir, args.Path)
+				if err != nil {
+					return "", err
+				}
+				entries, err := os.ReadDir(path)
+				if err != nil {
+					return "", fmt.Errorf("ディレクトリの読み込みに失敗しました: %v", err)
+				}
+				var list strings.Builder
+				for _, entry := range entries {
+					name := entry.Name()
+					if entry.IsDir() {
+						name += "/"
+					}
+					list.WriteString(name + "\n")
+				}
+				return truncateToolOutput(list.String()), nil
+			},
+		},
+		Tool{
+			Name:        "grep",
+			Description: "作業ディレクトリ配下のファイルから正規表現に一致する行を検索し、「パス:行番号:内容」の形式で返します。",
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"pattern": map[string]interface{}{"type": "string", "description": "検索する正規表現（Goのregexp形式）"},
+					"path":    map[string]interface{}{"type": "string", "description": "検索するディレクトリまたはファイル（省略時は作業ディレクトリ）"},
+					"include": map[string]interface{}{"type": "string", "description": "検索対象のファイル名のglobパターン（例: *.go）"},
+				},
+				"required": []string{"pattern"},
+			},
+			Run: func(ctx context.Context, input json.RawMessage) (string, error) {
+				var args struct {
+					Pattern string `json:"pattern"`
+					Path    string `json:"path"`
+					Include string `json:"include"`
+				}
+				if err := parseToolInput(input, &args); err != nil {
+					return "", err
+				}
+				re, err := regexp.Compile(args.Pattern)
+				if err != nil {
+					return "", fmt.Errorf("正規表現が不正です: %v", err)
+				}
+				path, err := resolveToolPath(baseDir, args.Path)
+				if err != nil {
+					return "", err
+				}
+				return grepFiles(ctx, baseDir, path, re, args.Include)
+			},
+		},
+		Tool{
+			Name:        "git",
+			Description: "作業ディレクトリで読み取り専用のgitコマンドを実行します。使用できるサブコマンド: " + strings.Join(sortedKeys(readOnlyGitCommands), ", "),
+			InputSchema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"args": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "gitに渡す引数（例: [\"log\", \"--oneline\", \"-n\", \"10\"]）",
+					},
+				},
+				"required": []string{"args"},
+			},
+			Run: func(ctx context.Context, input json.RawMessage) (string, error) {
+				var args struct {
+					Args []string `json:"args"`
+				}
+				if err := parseToolInput(input, &args); err != nil {
+					return "", err
+				}
+				if err := validateGitArgs(baseDir, args.Args); err != nil {
+					return "", err
+				}
+				cmd := exec.CommandContext(ctx, "git", append([]string{"--no-pager"}, args.Args...)...)
+				cmd.Dir = baseDir
+				output, err := cmd.CombinedOutput()
+				if err != nil {
+					return "", fmt.Errorf("gitの実行に失敗しました: %v\n%s", err, truncateToolOutput(string(output)))
+				}
+				return truncateToolOutput(string(output)), nil
+			},
+		},
+	)
+	return registry
+}
+
+// parseToolInput は、ツールへの入力（JSON）を解析する関数です
+func parseToolInput(input json.RawMessage, v interface{}) error {
+	if len(input) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(input, v); err != nil {
+		return fmt.Errorf("ツール入力の解析エラー: %v", err)
+	}
+	return nil
+}
+
+// resolveToolPath は、ツールに指定されたパスをbaseDir配下の絶対パスに変換する関数です
+// baseDirの外を指す場合はエラーを返します
+func resolveToolPath(baseDir, path string) (string, error) {
+	base, err := filepath.Abs(baseDir)
+	if err != nil {
+		return "", fmt.Errorf("作業ディレクトリの取得に失敗しました: %v", err)
+	}
+
+	resolved := path
+	if !filepath.IsAbs(resolved) {
+		resolved = filepath.Join(base, resolved)
+	}
+	resolved = filepath.Clean(resolved)
+
+	// シンボリックリンクで作業ディレクトリの外を指していないかも確認する
+	realBase, err := filepath.EvalSymlinks(base)
+	if err != nil {
+		realBase = base
+	}
+	realPath, err := filepath.EvalSymlinks(resolved)
+	if err != nil {
+		realPath = resolved
+	}
+
+	for _, pair := range [][2]string{{base, resolved}, {realBase, realPath}} {
+		rel, err := filepath.Rel(pair[0], pair[1])
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return "", fmt.Errorf("作業ディレクトリの外のパスは指定できません: %s", path)
+		}
+	}
+	return resolved, nil
+}
+
+// grepFiles は、root配下のファイルから正規表現に一致する行を検索する関数です
+func grepFiles(ctx context.Context, baseDir, root string, re *regexp.Regexp, include string) (string, error) {
+	var result strings.Builder
+	matches := 0
+
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			// .gitなどの隠しディレクトリは検索しない
+			if path != root && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			// シンボリックリンクは作業ディレクトリの外を指す可能性があるため検索しない
+			return nil
+		}
+		if include != "" {
+			if ok, _ := filepath.Match(include, d.Name()); !ok {
+				return nil
+			}
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			// 読み込めないファイルやバイナリファイルは検索しない
+			return nil
+		}
+
+		rel, err := filepath.Rel(baseDir, path)
+		if err != nil {
+			rel = path
+		}
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if !re.MatchString(scanner.Text()) {
+				continue
+			}
+			fmt.Fprintf(&result, "%s:%d:%s\n", filepath.ToSlash(rel), line, scanner.Text())
+			matches++
+			if matches >= maxGrepMatches {
+				return fs.SkipAll
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if matches == 0 {
+		return "一致する行はありません", nil
+	}
+	if matches >= maxGrepMatches {
+		fmt.Fprintf(&result, "（一致が多いため %d 件で打ち切りました）\n", maxGrepMatches)
+	}
+	return truncateToolOutput(result.String()), nil
+}
+
+// truncateToolOutput は、ツールの出力が上限を超える場合に切り詰める関数です
+func truncateToolOutput(output string) string {
+	if len(output) <= maxToolOutputBytes {
+		return output
+	}
+	return strings.ToValidUTF8(output[:maxToolOutputBytes], "") + "\n（出力が長いため切り詰めました）"
+}
+
+// sortedKeys は、マップのキーを昇順に並べて返す関数です
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
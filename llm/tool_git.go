@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// gitOptionSet は、gitツールのサブコマンドで許可するオプションを定義する構造体です
+// オプションは完全一致のみ許可するため、gitが受け付ける省略形（--outp など）は使用できません
+type gitOptionSet struct {
+	flags   map[string]bool // 値を取らないオプション（--stat=80 のように = で値を指定することは可能）
+	values  map[string]bool // 値を取るオプション（--format=x、--format x、-n5、-n 5）
+	numeric bool            // -5 のような件数の指定を許可する
+}
+
+// newGitOptionSet は、オプションの一覧からgitOptionSetを作成する関数です
+func newGitOptionSet(flags, values []string, numeric bool) gitOptionSet {
+	set := gitOptionSet{flags: map[string]bool{}, values: map[string]bool{}, numeric: numeric}
+	for _, flag := range flags {
+		set.flags[flag] = true
+	}
+	for _, value := range values {
+		set.values[value] = true
+	}
+	return set
+}
+
+// diffの出力形式のオプション（diff、log、showで共通）
+// --output、--no-index、--ext-diff、--textconv は、ファイルの書き込み、作業ディレクトリ外の読み取り、
+// 外部コマンドの実行を行うため含めない
+var (
+	gitDiffFlags = []string{
+		"-p", "-u", "-s", "-w", "-b", "-W", "-M", "-C", "-D", "-R", "-a",
+		"--patch", "--no-patch", "--raw", "--stat", "--numstat", "--shortstat", "--dirstat", "--compact-summary",
+		"--summary", "--name-only", "--name-status", "--check", "--full-index", "--binary", "--abbrev",
+		"--color", "--no-color", "--color-words", "--word-diff", "--minimal", "--patience", "--histogram",
+		"--ignore-all-space", "--ignore-space-change", "--ignore-space-at-eol", "--ignore-blank-lines",
+		"--function-context", "--find-renames", "--find-copies", "--no-renames", "--relative", "--no-relative",
+		"--text", "--irreversible-delete", "--no-ext-diff", "--no-textconv", "--exit-code", "--quiet",
+	}
+	gitDiffValues = []string{"-U", "-S", "-G", "--unified", "--diff-filter", "--word-diff-regex", "--stat-width", "--inter-hunk-context"}
+)
+
+// コミットの絞り込みと表示形式のオプション（log、show、shortlogで共通）
+var (
+	gitLogFlags = []string{
+		"-i", "--oneline", "--graph", "--decorate", "--no-decorate", "--all", "--branches", "--tags", "--remotes",
+		"--reverse", "--merges", "--no-merges", "--first-parent", "--follow", "--regexp-ignore-case", "--all-match",
+		"--invert-grep", "--left-right", "--cherry-pick", "--topo-order", "--date-order", "--author-date-order",
+		"--ancestry-path", "--simplify-by-decoration", "--full-history", "--boundary", "--parents", "--children",
+		"--source", "--abbrev-commit", "--no-abbrev-commit", "--pretty",
+	}
+	gitLogValues = []string{
+		"-n", "-L", "--max-count", "--skip", "--since", "--after", "--until", "--before",
+		"--author", "--committer", "--grep", "--format", "--date",
+	}
+)
+
+// gitツールで実行を許可する読み取り専用のサブコマンドと、サブコマンドごとに許可するオプション
+var readOnlyGitCommands = map[string]gitOptionSet{
+	"status": newGitOptionSet([]string{
+		"-s", "-b", "-u", "-v", "-z", "--short", "--branch", "--porcelain", "--long", "--verbose",
+		"--untracked-files", "--ignored", "--show-stash", "--ahead-behind", "--no-ahead-behind", "--renames", "--no-renames",
+	}, nil, false),
+	"diff": newGitOptionSet(append([]string{"--cached", "--staged", "--merge-base"}, gitDiffFlags...), gitDiffValues, false),
+	"log":  newGitOptionSet(append(append([]string{}, gitLogFlags...), gitDiffFlags...), append(append([]string{}, gitLogValues...), gitDiffValues...), true),
+	"show": newGitOptionSet(append(append([]string{}, gitLogFlags...), gitDiffFlags...), append(append([]string{}, gitLogValues...), gitDiffValues...), true),
+	// --contents、-S、--ignore-revs-file は作業ディレクトリ外のファイルを読み込むため含めない
+	"blame": newGitOptionSet([]string{
+		"-b", "-l", "-t", "-s", "-e", "-w", "-M", "-C", "-p", "-n", "-f", "-c",
+		"--root", "--show-stats", "--porcelain", "--line-porcelain", "--incremental", "--show-name", "--show-number",
+		"--show-email", "--first-parent", "--abbrev", "--color-lines", "--color-by-age",
+	}, []string{"-L", "--date"}, false),
+	// --exclude-from、-X は作業ディレクトリ外のファイルを読み込むため含めない
+	"ls-files": newGitOptionSet([]string{
+		"-c", "-d", "-m", "-o", "-i", "-s", "-u", "-k", "-z", "-t", "-v", "-f",
+		"--cached", "--deleted", "--modified", "--others", "--ignored", "--stage", "--unmerged", "--killed",
+		"--full-name", "--directory", "--no-empty-directory", "--eol", "--exclude-standard", "--error-unmatch",
+		"--abbrev", "--deduplicate", "--recurse-submodules", "--sparse",
+	}, []string{"-x", "--exclude"}, false),
+	// -O、--open-files-in-pager は任意のコマンドを実行し、-f、--no-index、--textconv は
+	// 作業ディレクトリ外のファイルの読み取りや外部コマンドの実行を行うため含めない
+	"grep": newGitOptionSet([]string{
+		"-n", "-i", "-w", "-v", "-l", "-L", "-c", "-h", "-H", "-E", "-F", "-G", "-P", "-q", "-p", "-W", "-I", "-a", "-o", "-z", "-r",
+		"--line-number", "--ignore-case", "--word-regexp", "--invert-match", "--files-with-matches", "--files-without-match",
+		"--name-only", "--count", "--full-name", "--extended-regexp", "--fixed-strings", "--basic-regexp", "--perl-regexp",
+		"--cached", "--untracked", "--recurse-submodules", "--and", "--or", "--not", "--all-match", "--quiet", "--column",
+		"--heading", "--break", "--show-function", "--function-context", "--text", "--only-matching", "--null",
+		"--recursive", "--no-recursive", "--color", "--no-color",
+	}, []string{
+		"-e", "-A", "-B", "-C", "-m", "--context", "--after-context", "--before-context", "--max-depth", "--max-count", "--threads",
+	}, false),
+	"shortlog": newGitOptionSet(append([]string{
+		"-n", "-s", "-e", "-c", "-w", "--numbered", "--summary", "--email", "--committer",
+	}, gitLogFlags...), append([]string{"--group"}, gitLogValues...), true),
+	"rev-parse": newGitOptionSet([]string{
+		"-q", "--abbrev-ref", "--short", "--verify", "--quiet", "--sq", "--symbolic", "--symbolic-full-name",
+		"--all", "--branches", "--tags", "--remotes", "--show-toplevel", "--show-prefix", "--show-cdup",
+		"--git-dir", "--absolute-git-dir", "--git-common-dir", "--is-inside-work-tree", "--is-inside-git-dir",
+		"--is-bare-repository", "--show-superproject-working-tree",
+	}, []string{"--default"}, false),
+	"describe": newGitOptionSet([]string{
+		"--tags", "--all", "--long", "--always", "--abbrev", "--dirty", "--broken", "--contains", "--exact-match", "--first-parent",
+	}, []string{"--match", "--exclude", "--candidates"}, false),
+}
+
+// validateGitArgs は、gitツールの引数が読み取り専用のコマンドと、そのサブコマンドで許可したオプションのみかを検証する関数です
+// オプションでない引数（リビジョンやパス）は、作業ディレクトリの外を指していないかも検証します
+// git diff は作業ディレクトリ外のパスを指定すると --no-index と同じ動作になるため、-- 以降も含めて確認します
+func validateGitArgs(baseDir string, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("gitのサブコマンドを指定してください")
+	}
+	options, ok := readOnlyGitCommands[args[0]]
+	if !ok {
+		return fmt.Errorf("gitのサブコマンド %s は実行できません（使用できるサブコマンド: %s）", args[0], strings.Join(sortedKeys(readOnlyGitCommands), ", "))
+	}
+
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			// 以降はパスとして扱われる
+			return validateGitPaths(baseDir, args[i+1:])
+		case arg == "-":
+			return fmt.Errorf("gitの引数に標準入力（-）は指定できません")
+		case !strings.HasPrefix(arg, "-"):
+			// リビジョンやパス
+			if err := validateGitPaths(baseDir, []string{arg}); err != nil {
+				return err
+			}
+			continue
+		case strings.HasPrefix(arg, "--"):
+			name, _, hasValue := strings.Cut(arg, "=")
+			switch {
+			case options.flags[name]:
+			case options.values[name]:
+				if !hasValue {
+					i++ // 次の引数は値
+				}
+			default:
+				return fmt.Errorf("gitのオプション %s は使用できません", name)
+			}
+		case options.numeric && isDigits(arg[1:]):
+			// -5 のような件数の指定
+		default:
+			// -nw のようにまとめて指定された短いオプションを1文字ずつ判定する
+			for j := 1; j < len(arg); j++ {
+				option := "-" + arg[j:j+1]
+				if options.flags[option] {
+					continue
+				}
+				if !options.values[option] {
+					return fmt.Errorf("gitのオプション %s は使用できません", option)
+				}
+				// 残りの文字が値（-n5）で、残りがない場合は次の引数が値（-n 5）
+				if j == len(arg)-1 {
+					i++
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// validateGitPaths は、gitツールのリビジョンやパスの引数が作業ディレクトリの外を指していないかを検証する関数です
+func validateGitPaths(baseDir string, args []string) error {
+	for _, arg := range args {
+		if arg == "-" {
+			return fmt.Errorf("gitの引数に標準入力（-）は指定できません")
+		}
+		if _, err := resolveToolPath(baseDir, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isDigits は、文字列が1文字以上の数字のみからなるかを返す関数です
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,284 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/document"
+	"github.com/aws/aws-sdk-go-v2/service/bedrockruntime/types"
+)
+
+// 組み込みツールのテスト
+func TestBuiltinTools(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "src", "main.go"), []byte("package main\n\nfunc main() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README.md"), []byte("# sample\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 作業ディレクトリの外のファイルを指すシンボリックリンク
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("func secret() {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "src", "link.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	registry := BuiltinTools(dir)
+
+	testCases := []struct {
+		name        string
+		tool        string
+		input       string
+		expect      string
+		expectError bool
+	}{
+		{name: "ファイルの読み込み", tool: "read_file", input: `{"path":"src/main.go"}`, expect: "func main() {}"},
+		{name: "作業ディレクトリ外のファイル", tool: "read_file", input: `{"path":"../secret.txt"}`, expectError: true},
+		{name: "絶対パスでの作業ディレクトリ外のファイル", tool: "read_file", input: `{"path":"/etc/passwd"}`, expectError: true},
+		{name: "ディレクトリの一覧", tool: "list_directory", input: `{}`, expect: "README.md\nsrc/\n"},
+		{name: "正規表現の検索", tool: "grep", input: `{"pattern":"^func","include":"*.go"}`, expect: "src/main.go:3:func main() {}"},
+		{name: "一致しない検索", tool: "grep", input: `{"pattern":"notfound"}`, expect: "一致する行はありません"},
+		{name: "シンボリックリンク先は検索しない", tool: "grep", input: `{"pattern":"secret"}`, expect: "一致する行はありません"},
+		{name: "作業ディレクトリ外を指すシンボリックリンク", tool: "read_file", input: `{"path":"src/link.go"}`, expectError: true},
+		{name: "不正な正規表現", tool: "grep", input: `{"pattern":"("}`, expectError: true},
+		{name: "書き込みを行うgitコマンド", tool: "git", input: `{"args":["commit","-m","test"]}`, expectError: true},
+		{name: "ファイルに出力するgitオプション", tool: "git", input: `{"args":["diff","--output=out.txt"]}`, expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			tool, ok := registry.Get(tc.tool)
+			if !ok {
+				t.Fatalf("ツールが登録されていません: %s", tc.tool)
+			}
+
+			result, err := tool.Run(context.Background(), json.RawMessage(tc.input))
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("エラーが期待されましたが、発生しませんでした: %s", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if !strings.Contains(result, tc.expect) {
+				t.Errorf("結果が期待通りではありません。期待: %q, 実際: %q", tc.expect, result)
+			}
+		})
+	}
+}
+
+// gitツールの引数の検証のテスト
+func TestValidateGitArgs(t *testing.T) {
+	testCases := []struct {
+		name        string
+		args        []string
+		expectError bool
+	}{
+		{name: "ログ", args: []string{"log", "--oneline", "-n", "10"}},
+		{name: "件数の指定", args: []string{"log", "-5", "--format=%h %s"}},
+		{name: "値を取るオプションの後の値", args: []string{"log", "--format", "--output=x"}},
+		{name: "差分の統計", args: []string{"diff", "--stat", "HEAD~1", "--", "src"}},
+		{name: "まとめて指定した短いオプション", args: []string{"grep", "-niw", "-e", "-O", "func"}},
+		{name: "値を続けて指定した短いオプション", args: []string{"grep", "-nA3", "func"}},
+		{name: "リビジョンのファイル", args: []string{"show", "HEAD:README.md"}},
+		{name: "--以降のパス", args: []string{"log", "--", "--output"}},
+		{name: "書き込みを行うサブコマンド", args: []string{"commit", "-m", "test"}, expectError: true},
+		{name: "ファイルに出力するオプション", args: []string{"diff", "--output=out.txt"}, expectError: true},
+		{name: "省略形のオプション", args: []string{"diff", "--outp=out.txt"}, expectError: true},
+		{name: "作業ディレクトリ外との比較", args: []string{"diff", "--no-ind", "/etc/passwd", "README.md"}, expectError: true},
+		{name: "外部のdiffコマンド", args: []string{"diff", "--ext-diff"}, expectError: true},
+		{name: "textconvフィルタ", args: []string{"diff", "--textconv"}, expectError: true},
+		{name: "grepのページャー", args: []string{"grep", "-Osh", "func"}, expectError: true},
+		{name: "grepのページャー（分けて指定）", args: []string{"grep", "-O", "sh", "func"}, expectError: true},
+		{name: "まとめて指定した短いオプションのページャー", args: []string{"grep", "-nOsh", "func"}, expectError: true},
+		{name: "grepのページャー（長いオプション）", args: []string{"grep", "--open-files-in-pager=sh", "func"}, expectError: true},
+		{name: "grepのページャー（省略形）", args: []string{"grep", "--open=sh", "func"}, expectError: true},
+		{name: "grepのパターンファイル", args: []string{"grep", "-f", "/etc/passwd"}, expectError: true},
+		{name: "blameの内容の置き換え", args: []string{"blame", "--contents", "/etc/passwd", "README.md"}, expectError: true},
+		{name: "blameの内容の置き換え（省略形）", args: []string{"blame", "--cont=/etc/passwd", "README.md"}, expectError: true},
+		{name: "作業ディレクトリ外の絶対パス", args: []string{"diff", "--stat", "/etc/hostname", "go.mod"}, expectError: true},
+		{name: "作業ディレクトリ外の相対パス", args: []string{"diff", "../secret.txt", "go.mod"}, expectError: true},
+		{name: "--以降の作業ディレクトリ外のパス", args: []string{"log", "--", "/etc/hostname"}, expectError: true},
+		{name: "--以降の..で外に出るパス", args: []string{"diff", "--", "src/../../secret.txt"}, expectError: true},
+		{name: "標準入力", args: []string{"diff", "-", "go.mod"}, expectError: true},
+		{name: "リビジョンの範囲", args: []string{"log", "main..HEAD", "--", "src/../go.mod"}},
+	}
+
+	baseDir := t.TempDir()
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateGitArgs(baseDir, tc.args)
+			if (err != nil) != tc.expectError {
+				t.Errorf("エラーの有無が期待通りではありません: %v", err)
+			}
+		})
+	}
+}
+
+// ツールの選択のテスト
+func TestToolRegistrySelect(t *testing.T) {
+	registry := BuiltinTools(t.TempDir())
+
+	selected, err := registry.Select([]string{"grep", " read_file", "grep"})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if names := selected.names(); strings.Join(names, ",") != "grep,read_file" {
+		t.Errorf("選択されたツールが期待通りではありません: %v", names)
+	}
+
+	all, err := registry.Select([]string{"all"})
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(all.Tools()) != len(registry.Tools()) {
+		t.Errorf("すべてのツールが選択されていません: %v", all.names())
+	}
+
+	if _, err := registry.Select([]string{"rm"}); err == nil {
+		t.Error("不明なツールでエラーが発生しませんでした")
+	}
+}
+
+// 登録したConverseの出力を順に返すモックのBedrockRuntimeクライアント
+type converseSequenceClient struct {
+	MockBedrockRuntimeClient
+	outputs []*bedrockruntime.ConverseOutput
+}
+
+func (c *converseSequenceClient) Converse(ctx context.Context, params *bedrockruntime.ConverseInput, optFns ...func(*bedrockruntime.Options)) (*bedrockruntime.ConverseOutput, error) {
+	c.converseRequests = append(c.converseRequests, params)
+	if len(c.converseRequests) > len(c.outputs) {
+		return nil, fmt.Errorf("想定外の呼び出しです")
+	}
+	return c.outputs[len(c.converseRequests)-1], nil
+}
+
+// ツールの呼び出しを実行し、実行結果をモデルに返して最終的な回答を得るかのテスト
+func TestAskTools(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		approve       bool
+		expectResult  string
+		expectIsError bool
+	}{
+		{name: "確認して実行", input: "y\n", expectResult: "hello tools"},
+		{name: "確認を省略して実行", approve: true, expectResult: "hello tools"},
+		{name: "実行を拒否", input: "n\n", expectResult: "拒否しました", expectIsError: true},
+		{name: "確認の入力なし", input: "", expectResult: "確認を得られなかった", expectIsError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			useMockRuntimeClient(t)
+
+			dir := t.TempDir()
+			if err := os.WriteFile(filepath.Join(dir, "hello.txt"), []byte("hello tools"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			client := &converseSequenceClient{outputs: []*bedrockruntime.ConverseOutput{
+				{
+					Output: &types.ConverseOutputMemberMessage{Value: types.Message{
+						Role: types.ConversationRoleAssistant,
+						Content: []types.ContentBlock{
+							&types.ContentBlockMemberText{Value: "ファイルを確認します。"},
+							&types.ContentBlockMemberToolUse{Value: types.ToolUseBlock{
+								ToolUseId: aws.String("tool-1"),
+								Name:      aws.String("read_file"),
+								Input:     document.NewLazyDocument(map[string]interface{}{"path": "hello.txt"}),
+							}},
+						},
+					}},
+					StopReason: types.StopReasonToolUse,
+					Usage:      &types.TokenUsage{InputTokens: aws.Int32(10), OutputTokens: aws.Int32(5)},
+				},
+				{
+					Output: &types.ConverseOutputMemberMessage{Value: types.Message{
+						Role:    types.ConversationRoleAssistant,
+						Content: []types.ContentBlock{&types.ContentBlockMemberText{Value: "内容は hello tools です。"}},
+					}},
+					StopReason: types.StopReasonEndTurn,
+					Usage:      &types.TokenUsage{InputTokens: aws.Int32(20), OutputTokens: aws.Int32(7)},
+				},
+			}}
+			newBedrockRuntimeClient = func(cfg aws.Config) BedrockRuntimeAPI {
+				return client
+			}
+
+			registry, err := BuiltinTools(dir).Select([]string{"read_file"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var stdout, stderr bytes.Buffer
+			err = Ask(context.Background(), AskOptions{
+				LLMModel:     "anthropic.claude-3-5-sonnet-20240620-v1:0",
+				Prompt:       "hello.txtには何が書かれていますか",
+				NoStream:     true,
+				Tools:        registry,
+				ApproveTools: tc.approve,
+				Input:        strings.NewReader(tc.input),
+				Output:       &stdout,
+				ErrOutput:    &stderr,
+			})
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+
+			if !strings.Contains(stdout.String(), "内容は hello tools です。") {
+				t.Errorf("最終的な回答が出力されていません。\n実際の出力:\n%s", stdout.String())
+			}
+			if !strings.Contains(stderr.String(), "トークン数: 入力 30 / 出力 12") {
+				t.Errorf("トークン数が合算されていません: %s", stderr.String())
+			}
+			if len(client.converseRequests) != 2 {
+				t.Fatalf("Converseの呼び出し回数が期待通りではありません: %d", len(client.converseRequests))
+			}
+
+			// 1回目のリクエストでツールが提供されていること
+			first := client.converseRequests[0]
+			if first.ToolConfig == nil || len(first.ToolConfig.Tools) != 1 {
+				t.Fatalf("ツールが提供されていません: %+v", first.ToolConfig)
+			}
+
+			// 2回目のリクエストにツールの呼び出しと実行結果が含まれること
+			second := client.converseRequests[1]
+			if len(second.Messages) != 3 {
+				t.Fatalf("メッセージ数が期待通りではありません: %d", len(second.Messages))
+			}
+			if _, ok := second.Messages[1].Content[1].(*types.ContentBlockMemberToolUse); !ok {
+				t.Errorf("ツールの呼び出しが含まれていません: %+v", second.Messages[1].Content)
+			}
+			result, ok := second.Messages[2].Content[0].(*types.ContentBlockMemberToolResult)
+			if !ok {
+				t.Fatalf("ツールの実行結果が含まれていません: %+v", second.Messages[2].Content)
+			}
+			text := result.Value.Content[0].(*types.ToolResultContentBlockMemberText).Value
+			if !strings.Contains(text, tc.expectResult) {
+				t.Errorf("ツールの実行結果が期待通りではありません。期待: %q, 実際: %q", tc.expectResult, text)
+			}
+			if (result.Value.Status == types.ToolResultStatusError) != tc.expectIsError {
+				t.Errorf("ツールの実行結果の状態が期待通りではありません: %s", result.Value.Status)
+			}
+		})
+	}
+}
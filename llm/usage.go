@@ -0,0 +1,345 @@
+package llm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ModelPrice は、モデルの1000トークンあたりの料金（USD）を定義する構造体です
+type ModelPrice struct {
+	InputPer1K  float64 `json:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k"`
+}
+
+// builtinPrices は、モデルIDのプレフィックスごとのオンデマンド料金です（us-east-1）
+// 料金の変更やリージョンによる違いは、設定ディレクトリの prices.json で上書きできます
+var builtinPrices = map[string]ModelPrice{
+	"anthropic.claude-3-5-sonnet":   {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"anthropic.claude-3-5-haiku":    {InputPer1K: 0.0008, OutputPer1K: 0.004},
+	"anthropic.claude-3-sonnet":     {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"anthropic.claude-3-haiku":      {InputPer1K: 0.00025, OutputPer1K: 0.00125},
+	"anthropic.claude-3-opus":       {InputPer1K: 0.015, OutputPer1K: 0.075},
+	"anthropic.claude-v2":           {InputPer1K: 0.008, OutputPer1K: 0.024},
+	"anthropic.claude-instant":      {InputPer1K: 0.0008, OutputPer1K: 0.0024},
+	"amazon.titan-text-express":     {InputPer1K: 0.0002, OutputPer1K: 0.0006},
+	"amazon.titan-text-lite":        {InputPer1K: 0.00015, OutputPer1K: 0.0002},
+	"amazon.titan-text-premier":     {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+	"meta.llama3-8b-instruct":       {InputPer1K: 0.0003, OutputPer1K: 0.0006},
+	"meta.llama3-70b-instruct":      {InputPer1K: 0.00265, OutputPer1K: 0.0035},
+	"mistral.mistral-7b-instruct":   {InputPer1K: 0.00015, OutputPer1K: 0.0002},
+	"mistral.mixtral-8x7b-instruct": {InputPer1K: 0.00045, OutputPer1K: 0.0007},
+	"mistral.mistral-large":         {InputPer1K: 0.004, OutputPer1K: 0.012},
+	"cohere.command-text":           {InputPer1K: 0.0015, OutputPer1K: 0.002},
+	"cohere.command-light-text":     {InputPer1K: 0.0003, OutputPer1K: 0.0006},
+	"cohere.command-r-plus":         {InputPer1K: 0.003, OutputPer1K: 0.015},
+	"cohere.command-r":              {InputPer1K: 0.0005, OutputPer1K: 0.0015},
+	"ai21.j2-mid":                   {InputPer1K: 0.0125, OutputPer1K: 0.0125},
+	"ai21.j2-ultra":                 {InputPer1K: 0.0188, OutputPer1K: 0.0188},
+	"ai21.jamba-instruct":           {InputPer1K: 0.0005, OutputPer1K: 0.0007},
+}
+
+// PriceTable は、モデルIDのプレフィックスと料金の対応表です
+type PriceTable map[string]ModelPrice
+
+// LoadPriceTable は、組み込みの料金表に設定ディレクトリの prices.json の内容を上書きして返す関数です
+func LoadPriceTable() (PriceTable, error) {
+	table := PriceTable{}
+	for prefix, price := range builtinPrices {
+		table[prefix] = price
+	}
+
+	configDir, err := ConfigDir()
+	if err != nil {
+		return table, nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(configDir, "prices.json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return table, nil
+		}
+		return table, fmt.Errorf("料金表の読み込みエラー: %v", err)
+	}
+
+	var overrides map[string]ModelPrice
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return table, fmt.Errorf("料金表の解析エラー: %v", err)
+	}
+	for prefix, price := range overrides {
+		table[prefix] = price
+	}
+
+	return table, nil
+}
+
+// EstimateCost は、トークン数から推定料金（USD）を計算する関数です
+// 料金表にモデルが見つからない場合はfalseを返します
+// クロスリージョン推論プロファイルのIDが料金表にない場合は、元のモデルIDの料金を使用します
+func (t PriceTable) EstimateCost(modelID string, usage Usage) (float64, bool) {
+	matched := t.match(modelID)
+	if matched == "" {
+		matched = t.match(BaseModelID(modelID))
+	}
+	if matched == "" {
+		return 0, false
+	}
+
+	price := t[matched]
+	cost := float64(usage.InputTokens)/1000*price.InputPer1K + float64(usage.OutputTokens)/1000*price.OutputPer1K
+	return cost, true
+}
+
+// match は、モデルファミリーと同様に、最も長く一致する料金表のプレフィックスを返します
+func (t PriceTable) match(modelID string) string {
+	var matched string
+	for prefix := range t {
+		if strings.HasPrefix(modelID, prefix) && len(prefix) > len(matched) {
+			matched = prefix
+		}
+	}
+	return matched
+}
+
+// UsageRecord は、使用量の記録の1件を定義する構造体です
+type UsageRecord struct {
+	Timestamp    time.Time `json:"timestamp"`
+	User         string    `json:"user,omitempty"`
+	Command      string    `json:"command"`
+	ModelID      string    `json:"model_id"`
+	Session      string    `json:"session,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	CostUSD      float64   `json:"cost_usd"`
+}
+
+// UsageLedger は、使用量の記録をJSON Lines形式で追記するローカルの台帳です
+type UsageLedger struct {
+	Path string // 台帳ファイルのパス
+}
+
+// DefaultUsageLedger は、ユーザーの設定ディレクトリ配下の使用量台帳を返す関数です
+func DefaultUsageLedger() (*UsageLedger, error) {
+	configDir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return &UsageLedger{Path: filepath.Join(configDir, "usage.jsonl")}, nil
+}
+
+// Append は、使用量の記録を台帳に追記します
+func (l *UsageLedger) Append(record UsageRecord) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0o700); err != nil {
+		return fmt.Errorf("使用量台帳のディレクトリ作成エラー: %v", err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("使用量の変換エラー: %v", err)
+	}
+
+	f, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("使用量台帳のオープンエラー: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("使用量の記録エラー: %v", err)
+	}
+	return nil
+}
+
+// Read は、指定した日時以降の使用量の記録を返します（sinceがゼロ値の場合はすべて）
+// 解析できない行はスキップし、その警告をerrOutputに書き込みます（nilの場合は書き込みません）
+func (l *UsageLedger) Read(since time.Time, errOutput io.Writer) ([]UsageRecord, error) {
+	f, err := os.Open(l.Path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("使用量台帳の読み込みエラー: %v", err)
+	}
+	defer f.Close()
+
+	var records []UsageRecord
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			if errOutput != nil {
+				fmt.Fprintf(errOutput, "警告: 使用量台帳の %d 行目を解析できません: %v\n", line, err)
+			}
+			continue
+		}
+		if record.Timestamp.Before(since) {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("使用量台帳の読み込みエラー: %v", err)
+	}
+
+	return records, nil
+}
+
+// UsageSummary は、使用量の集計結果の1行を定義する構造体です
+type UsageSummary struct {
+	Key          string
+	Calls        int
+	InputTokens  int
+	OutputTokens int
+	CostUSD      float64
+}
+
+// 集計に使用できるキー
+var usageGroupKeys = map[string]func(UsageRecord) string{
+	"model":   func(r UsageRecord) string { return r.ModelID },
+	"day":     func(r UsageRecord) string { return r.Timestamp.Local().Format("2006-01-02") },
+	"command": func(r UsageRecord) string { return r.Command },
+	"user":    func(r UsageRecord) string { return r.User },
+}
+
+// SummarizeUsage は、使用量の記録を指定したキーごとに集計する関数です
+// byが空の場合は全体の合計のみを返します
+func SummarizeUsage(records []UsageRecord, by string) ([]UsageSummary, error) {
+	keyOf := func(UsageRecord) string { return "TOTAL" }
+	if by != "" {
+		var ok bool
+		keyOf, ok = usageGroupKeys[by]
+		if !ok {
+			return nil, fmt.Errorf("不明な集計キーです: %s（model, day, command, user のいずれかを指定してください）", by)
+		}
+	}
+
+	summaries := map[string]*UsageSummary{}
+	for _, record := range records {
+		key := keyOf(record)
+		if key == "" {
+			key = "(unknown)"
+		}
+		summary, ok := summaries[key]
+		if !ok {
+			summary = &UsageSummary{Key: key}
+			summaries[key] = summary
+		}
+		summary.Calls++
+		summary.InputTokens += record.InputTokens
+		summary.OutputTokens += record.OutputTokens
+		summary.CostUSD += record.CostUSD
+	}
+
+	result := make([]UsageSummary, 0, len(summaries))
+	for _, summary := range summaries {
+		result = append(result, *summary)
+	}
+	// 日ごとの集計は日付順、それ以外は料金の高い順に並べる
+	sort.Slice(result, func(i, j int) bool {
+		if by == "day" {
+			return result[i].Key < result[j].Key
+		}
+		if result[i].CostUSD != result[j].CostUSD {
+			return result[i].CostUSD > result[j].CostUSD
+		}
+		return result[i].Key < result[j].Key
+	})
+
+	return result, nil
+}
+
+// ParseSince は、"7d" や "12h"、"2024-01-01" の形式の期間指定から開始日時を返す関数です
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+
+	// 日（d）と週（w）はtime.ParseDurationが対応していないため個別に扱う
+	if n, err := strconv.Atoi(strings.TrimRight(value, "dw")); err == nil && n >= 0 {
+		switch {
+		case strings.HasSuffix(value, "d"):
+			return now.AddDate(0, 0, -n), nil
+		case strings.HasSuffix(value, "w"):
+			return now.AddDate(0, 0, -7*n), nil
+		}
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("期間の指定が不正です: %s（例: 7d, 2w, 12h, 2024-01-01）", value)
+	}
+	return now.Add(-d), nil
+}
+
+// currentUserName は、使用量の記録に残すユーザー名を返す関数です
+func currentUserName() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// recordUsage は、モデル呼び出しの使用量と推定料金を標準エラー出力に表示し、台帳に記録する関数です
+// 記録に失敗しても回答には影響しないため、警告の表示のみ行います
+func recordUsage(opts AskOptions, response *ModelResponse) {
+	if response.Usage.InputTokens == 0 && response.Usage.OutputTokens == 0 {
+		return
+	}
+
+	errOut := opts.errOutput()
+	prices, err := LoadPriceTable()
+	if err != nil {
+		fmt.Fprintf(errOut, "警告: %v\n", err)
+	}
+	cost, known := prices.EstimateCost(opts.LLMModel, response.Usage)
+	if !known {
+		// ARNで指定されたモデルは、元の基盤モデルの料金を使用する
+		cost, known = prices.EstimateCost(opts.baseModelID(), response.Usage)
+	}
+
+	summary := fmt.Sprintf("トークン数: 入力 %d / 出力 %d", response.Usage.InputTokens, response.Usage.OutputTokens)
+	if known {
+		summary += fmt.Sprintf("（推定料金: $%.4f）", cost)
+	} else {
+		summary += "（料金表にないモデルのため料金は不明）"
+	}
+	fmt.Fprintln(errOut, summary)
+
+	command := opts.Command
+	if command == "" {
+		command = "llm ask"
+	}
+
+	ledger, err := DefaultUsageLedger()
+	if err == nil {
+		err = ledger.Append(UsageRecord{
+			Timestamp:    time.Now(),
+			User:         currentUserName(),
+			Command:      command,
+			ModelID:      opts.LLMModel,
+			Session:      opts.Session,
+			InputTokens:  response.Usage.InputTokens,
+			OutputTokens: response.Usage.OutputTokens,
+			CostUSD:      cost,
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(errOut, "警告: 使用量を記録できませんでした: %v\n", err)
+	}
+}
@@ -0,0 +1,191 @@
+package llm
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 料金表による推定料金の計算のテスト
+func TestEstimateCost(t *testing.T) {
+	table := PriceTable{
+		"anthropic.claude-3":          {InputPer1K: 0.01, OutputPer1K: 0.02},
+		"anthropic.claude-3-5-sonnet": {InputPer1K: 0.003, OutputPer1K: 0.015},
+	}
+
+	testCases := []struct {
+		modelID     string
+		usage       Usage
+		expectCost  float64
+		expectKnown bool
+	}{
+		{
+			// 最も長く一致するプレフィックスの料金が使われること
+			modelID:     "anthropic.claude-3-5-sonnet-20240620-v1:0",
+			usage:       Usage{InputTokens: 2000, OutputTokens: 1000},
+			expectCost:  0.021,
+			expectKnown: true,
+		},
+		{
+			modelID:     "anthropic.claude-3-haiku-20240307-v1:0",
+			usage:       Usage{InputTokens: 1000, OutputTokens: 500},
+			expectCost:  0.02,
+			expectKnown: true,
+		},
+		{
+			// クロスリージョン推論プロファイルは元のモデルの料金が使われること
+			modelID:     "us.anthropic.claude-3-5-sonnet-20240620-v1:0",
+			usage:       Usage{InputTokens: 2000, OutputTokens: 1000},
+			expectCost:  0.021,
+			expectKnown: true,
+		},
+		{
+			modelID:     "unknown.model",
+			usage:       Usage{InputTokens: 1000, OutputTokens: 1000},
+			expectCost:  0,
+			expectKnown: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.modelID, func(t *testing.T) {
+			cost, known := table.EstimateCost(tc.modelID, tc.usage)
+			if known != tc.expectKnown {
+				t.Errorf("料金表の検索結果が期待通りではありません。期待: %v, 実際: %v", tc.expectKnown, known)
+			}
+			if math.Abs(cost-tc.expectCost) > 1e-9 {
+				t.Errorf("推定料金が期待通りではありません。期待: %f, 実際: %f", tc.expectCost, cost)
+			}
+		})
+	}
+}
+
+// 期間指定の解析のテスト
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.Local)
+
+	testCases := []struct {
+		value       string
+		expect      time.Time
+		expectError bool
+	}{
+		{value: "", expect: time.Time{}},
+		{value: "7d", expect: time.Date(2024, 6, 8, 12, 0, 0, 0, time.Local)},
+		{value: "2w", expect: time.Date(2024, 6, 1, 12, 0, 0, 0, time.Local)},
+		{value: "12h", expect: time.Date(2024, 6, 15, 0, 0, 0, 0, time.Local)},
+		{value: "2024-01-01", expect: time.Date(2024, 1, 1, 0, 0, 0, 0, time.Local)},
+		{value: "yesterday", expectError: true},
+		{value: "-3h", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.value, func(t *testing.T) {
+			since, err := ParseSince(tc.value, now)
+			if tc.expectError {
+				if err == nil {
+					t.Error("エラーが期待されましたが、発生しませんでした")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("予期せぬエラー: %v", err)
+			}
+			if !since.Equal(tc.expect) {
+				t.Errorf("開始日時が期待通りではありません。期待: %v, 実際: %v", tc.expect, since)
+			}
+		})
+	}
+}
+
+// 使用量台帳への追記と読み込み、集計のテスト
+func TestUsageLedger(t *testing.T) {
+	ledger := &UsageLedger{Path: filepath.Join(t.TempDir(), "usage.jsonl")}
+
+	// 台帳が存在しない場合は空の結果を返すこと
+	records, err := ledger.Read(time.Time{}, nil)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("記録がないはずですが、%d 件あります", len(records))
+	}
+
+	now := time.Now()
+	for _, record := range []UsageRecord{
+		{Timestamp: now.AddDate(0, 0, -10), Command: "llm ask", ModelID: "model-a", InputTokens: 100, OutputTokens: 10, CostUSD: 1},
+		{Timestamp: now.AddDate(0, 0, -1), Command: "llm ask", ModelID: "model-a", InputTokens: 200, OutputTokens: 20, CostUSD: 2},
+		{Timestamp: now, Command: "git diff-comment", ModelID: "model-b", InputTokens: 300, OutputTokens: 30, CostUSD: 4},
+	} {
+		if err := ledger.Append(record); err != nil {
+			t.Fatalf("使用量の記録エラー: %v", err)
+		}
+	}
+
+	// 期間を指定した場合は、それ以降の記録のみを返すこと
+	records, err = ledger.Read(now.AddDate(0, 0, -7), nil)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("記録の件数が期待通りではありません。期待: 2, 実際: %d", len(records))
+	}
+
+	summaries, err := SummarizeUsage(records, "model")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(summaries) != 2 {
+		t.Fatalf("集計結果の件数が期待通りではありません。期待: 2, 実際: %d", len(summaries))
+	}
+	// 料金の高い順に並ぶこと
+	if summaries[0].Key != "model-b" || summaries[0].CostUSD != 4 {
+		t.Errorf("集計結果が期待通りではありません: %+v", summaries[0])
+	}
+	if summaries[1].Key != "model-a" || summaries[1].Calls != 1 || summaries[1].InputTokens != 200 {
+		t.Errorf("集計結果が期待通りではありません: %+v", summaries[1])
+	}
+
+	total, err := SummarizeUsage(records, "")
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(total) != 1 || total[0].Calls != 2 || total[0].OutputTokens != 50 {
+		t.Errorf("合計が期待通りではありません: %+v", total)
+	}
+
+	if _, err := SummarizeUsage(records, "unknown"); err == nil {
+		t.Error("不明な集計キーでエラーが期待されましたが、発生しませんでした")
+	}
+}
+
+// 解析できない行の警告を書き込み先に出力することのテスト
+func TestUsageLedgerReadInvalidLine(t *testing.T) {
+	ledger := &UsageLedger{Path: filepath.Join(t.TempDir(), "usage.jsonl")}
+	if err := ledger.Append(UsageRecord{Timestamp: time.Now(), Command: "llm ask", ModelID: "model-a"}); err != nil {
+		t.Fatalf("使用量の記録エラー: %v", err)
+	}
+	f, err := os.OpenFile(ledger.Path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("{invalid\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	var errOutput bytes.Buffer
+	records, err := ledger.Read(time.Time{}, &errOutput)
+	if err != nil {
+		t.Fatalf("予期せぬエラー: %v", err)
+	}
+	if len(records) != 1 {
+		t.Errorf("記録の件数が期待通りではありません。期待: 1, 実際: %d", len(records))
+	}
+	if !strings.Contains(errOutput.String(), "2 行目を解析できません") {
+		t.Errorf("解析できない行の警告が出力されていません: %q", errOutput.String())
+	}
+}
@@ -165,34 +165,128 @@ _hiracli_completion() {
     COMPREPLY=()
     cur="${COMP_WORDS[COMP_CWORD]}"
     prev="${COMP_WORDS[COMP_CWORD-1]}"
-    opts="llm git help"
+    opts="llm git config help"
 
     case "${prev}" in
         "llm")
-            COMPREPLY=( $(compgen -W "list ask flatten-src help" -- ${cur}) )
+            COMPREPLY=( $(compgen -W "list ask check sessions templates usage count-tokens flatten-src help" -- ${cur}) )
             return 0
             ;;
         "git")
             COMPREPLY=( $(compgen -W "diff-comment help" -- ${cur}) )
             return 0
             ;;
+        "sessions")
+            COMPREPLY=( $(compgen -W "list show rm export" -- ${cur}) )
+            return 0
+            ;;
+        "templates")
+            COMPREPLY=( $(compgen -W "list show path" -- ${cur}) )
+            return 0
+            ;;
+        "config")
+            COMPREPLY=( $(compgen -W "get set list path" -- ${cur}) )
+            return 0
+            ;;
+        "get"|"set")
+            COMPREPLY=( $(compgen -W "profile default_model aws_profile region assume_role_arn lang max_tokens max_input_tokens model_cache_ttl tokenizer aliases." -- ${cur}) )
+            return 0
+            ;;
+        "--llm")
+            # キャッシュされたモデルIDも候補にする（APIは呼び出さない）
+            COMPREPLY=( $(compgen -W "sonnet sonnet-v2 haiku opus titan llama mistral command-r jamba $(hiracli llm list --cached --output-modality TEXT --output ids 2>/dev/null)" -- ${cur}) )
+            return 0
+            ;;
+        "--api")
+            COMPREPLY=( $(compgen -W "invoke converse" -- ${cur}) )
+            return 0
+            ;;
+        "--region")
+            COMPREPLY=( $(compgen -W "us-east-1 us-west-2 ap-northeast-1 ap-southeast-1 eu-central-1 eu-west-1" -- ${cur}) )
+            return 0
+            ;;
+        "--tokenizer")
+            COMPREPLY=( $(compgen -W "cl100k o200k heuristic" -- ${cur}) )
+            return 0
+            ;;
+        "--budget")
+            COMPREPLY=( $(compgen -W "skip stop truncate" -- ${cur}) )
+            return 0
+            ;;
+        "--order")
+            COMPREPLY=( $(compgen -W "path recent size" -- ${cur}) )
+            return 0
+            ;;
+        "--output")
+            COMPREPLY=( $(compgen -W "table json yaml ids" -- ${cur}) )
+            return 0
+            ;;
+        "--sort")
+            COMPREPLY=( $(compgen -W "id name provider" -- ${cur}) )
+            return 0
+            ;;
+        "--output-modality"|"--input-modality")
+            COMPREPLY=( $(compgen -W "TEXT IMAGE EMBEDDING" -- ${cur}) )
+            return 0
+            ;;
+        "--inference-type")
+            COMPREPLY=( $(compgen -W "ON_DEMAND PROVISIONED" -- ${cur}) )
+            return 0
+            ;;
+        "--customization")
+            COMPREPLY=( $(compgen -W "FINE_TUNING CONTINUED_PRE_TRAINING DISTILLATION" -- ${cur}) )
+            return 0
+            ;;
+        "--tools")
+            COMPREPLY=( $(compgen -W "all read_file list_directory grep git" -- ${cur}) )
+            return 0
+            ;;
+        "--since")
+            # flatten-src ではGitのブランチとタグを候補にする
+            if [[ "${COMP_WORDS[2]}" == "flatten-src" ]]; then
+                COMPREPLY=( $(compgen -W "$(git for-each-ref --format='%(refname:short)' refs/heads refs/tags 2>/dev/null)" -- ${cur}) )
+            fi
+            return 0
+            ;;
         *)
             if [[ ${cur} == -* ]]; then
                 case "${COMP_WORDS[1]}" in
                     "git")
                         case "${COMP_WORDS[2]}" in
                             "diff-comment")
-                                COMPREPLY=( $(compgen -W "--llm" -- ${cur}) )
+                                COMPREPLY=( $(compgen -W "--llm --cached --no-stream --system --system-file --template --lang --var --max-tokens --temperature --top-p --top-k --stop --auto-continue --api --region --profile --assume-role-arn --config-profile --timeout --max-retries" -- ${cur}) )
                                 ;;
                         esac
                         ;;
                     "llm")
                         case "${COMP_WORDS[2]}" in
+                            "list")
+                                COMPREPLY=( $(compgen -W "--provider --output-modality --input-modality --inference-type --customization --sort --output --access --refresh --cached --profiles --provisioned --aliases --region --profile --assume-role-arn --config-profile --timeout --max-retries" -- ${cur}) )
+                                ;;
                             "ask")
-                                COMPREPLY=( $(compgen -W "--llm --debug -d" -- ${cur}) )
+                                COMPREPLY=( $(compgen -W "--llm --debug -d --no-stream --session --prompt-file --system --system-file --template --lang --var --max-tokens --temperature --top-p --top-k --stop --auto-continue --api --tools --approve-tools --attach --region --profile --assume-role-arn --config-profile --timeout --max-retries" -- ${cur}) )
+                                ;;
+                            "check")
+                                COMPREPLY=( $(compgen -W "--api --region --profile --assume-role-arn --config-profile --timeout --max-retries" -- ${cur}) )
+                                ;;
+                            "usage")
+                                COMPREPLY=( $(compgen -W "--since --by" -- ${cur}) )
+                                ;;
+                            "count-tokens")
+                                COMPREPLY=( $(compgen -W "--tokenizer --output --config-profile" -- ${cur}) )
                                 ;;
                             "flatten-src")
-                                COMPREPLY=( $(compgen -W "--pattern --extension --path -p --depth-limit --max-input-tokens --debug -d" -- ${cur}) )
+                                COMPREPLY=( $(compgen -W "--pattern --extension --include --exclude --path -p --depth-limit --max-input-tokens --tokenizer --no-ignore --hidden --git-tracked --git-changed --git-staged --since --budget --order --weight --config-profile --debug -d" -- ${cur}) )
+                                ;;
+                        esac
+                        ;;
+                    "config")
+                        case "${COMP_WORDS[2]}" in
+                            "set")
+                                COMPREPLY=( $(compgen -W "--repo --config-profile" -- ${cur}) )
+                                ;;
+                            "get"|"list")
+                                COMPREPLY=( $(compgen -W "--config-profile" -- ${cur}) )
                                 ;;
                         esac
                         ;;
@@ -212,11 +306,20 @@ EOF
     cat > "${COMPLETION_DIR}/hiracli.zsh" << 'EOF'
 #compdef hiracli
 
+# エイリアスとキャッシュされたモデルIDを補完する（APIは呼び出さない）
+_hiracli_models() {
+    local -a models
+    models=(sonnet sonnet-v2 haiku opus titan llama mistral command-r jamba ${(f)"$(hiracli llm list --cached --output-modality TEXT --output ids 2>/dev/null)"})
+    # モデルIDには : が含まれるため、_describe ではなく compadd で候補を追加する
+    compadd -a models
+}
+
 _hiracli() {
     local -a commands subcmds
     commands=(
         'llm:LLM関連のコマンド'
         'git:Git関連のコマンド'
+        'config:設定を表示・変更'
         'help:ヘルプの表示'
     )
 
@@ -239,7 +342,27 @@ _hiracli() {
                     case $words[2] in
                         diff-comment)
                             _arguments \
-                                '--llm[LLMモデルを指定]:model:(anthropic.claude-3-5-sonnet-20240620-v1:0 amazon.titan-text-express-v1)'
+                                '--llm[LLMモデルを指定]:model:_hiracli_models' \
+                                '--cached[ステージングされた変更の差分を使用]' \
+                                '--no-stream[ストリーミングを使用しない]' \
+                                '--system[システムプロンプトを指定]:system:' \
+                                '--system-file[システムプロンプトを記述したファイル]:file:_files' \
+                                '--template[プロンプトテンプレート名]:template:' \
+                                '--lang[コミットメッセージの言語]:lang:' \
+                                '*--var[テンプレートに渡す変数]:var:' \
+                                '--max-tokens[最大出力トークン数]:tokens:' \
+                                '--temperature[温度]:temperature:' \
+                                '--top-p[top-p]:top-p:' \
+                                '--top-k[top-k]:top-k:' \
+                                '*--stop[停止シーケンス]:sequence:' \
+                                '--auto-continue[途切れた回答の続きを自動取得する回数]:count:' \
+                                '--api[モデルの呼び出しに使用するAPI]:api:(invoke converse)' \
+                                '--region[AWSのリージョン]:region:(us-east-1 us-west-2 ap-northeast-1 ap-southeast-1 eu-central-1 eu-west-1)' \
+                                '--profile[AWSの名前付きプロファイル]:profile:' \
+                                '--assume-role-arn[引き受けるIAMロールのARN]:arn:' \
+                                '--config-profile[設定ファイルのプロファイル]:profile:' \
+                                '--timeout[API呼び出し全体のタイムアウト]:duration:(30s 1m 5m 10m)' \
+                                '--max-retries[一時的なエラーで再試行する最大回数]:count:'
                             ;;
                     esac
                     ;;
@@ -247,27 +370,147 @@ _hiracli() {
                     subcmds=(
                         'list:利用可能なLLMモデルの一覧表示'
                         'ask:LLMに質問する'
+                        'check:モデルを呼び出せるかを確認'
+                        'sessions:保存された会話セッションを管理'
+                        'templates:プロンプトテンプレートを管理'
+                        'usage:トークン使用量と推定料金を集計'
+                        'count-tokens:ファイルまたは標準入力のトークン数を表示'
                         'flatten-src:ファイルをLLMチャットに適した形式で表示'
                         'help:LLMコマンドのヘルプ'
                     )
                     _describe 'llm commands' subcmds
                     case $words[2] in
+                        list)
+                            _arguments \
+                                '--provider[プロバイダー名で絞り込む]:provider:(Amazon Anthropic AI21\ Labs Cohere Meta Mistral\ AI)' \
+                                '--output-modality[出力モダリティで絞り込む]:modality:(TEXT IMAGE EMBEDDING)' \
+                                '--input-modality[入力モダリティで絞り込む]:modality:(TEXT IMAGE)' \
+                                '--inference-type[推論タイプで絞り込む]:type:(ON_DEMAND PROVISIONED)' \
+                                '--customization[カスタマイズの種類で絞り込む]:customization:(FINE_TUNING CONTINUED_PRE_TRAINING DISTILLATION)' \
+                                '--sort[並べ替えのキー]:key:(id name provider)' \
+                                '--output[出力形式]:format:(table json yaml ids)' \
+                                '--access[モデルアクセスの状態を表示]' \
+                                '(--cached)--refresh[モデル一覧を取得し直す]' \
+                                '(--refresh)--cached[キャッシュされたモデル一覧のみを表示]' \
+                                '(--provisioned)--profiles[推論プロファイルを表示]' \
+                                '(--profiles)--provisioned[プロビジョンドスループットを表示]' \
+                                '--aliases[モデルのエイリアスを表示]' \
+                                '--region[AWSのリージョン]:region:(us-east-1 us-west-2 ap-northeast-1 ap-southeast-1 eu-central-1 eu-west-1)' \
+                                '--profile[AWSの名前付きプロファイル]:profile:' \
+                                '--assume-role-arn[引き受けるIAMロールのARN]:arn:' \
+                                '--config-profile[設定ファイルのプロファイル]:profile:' \
+                                '--timeout[API呼び出し全体のタイムアウト]:duration:(30s 1m 5m 10m)' \
+                                '--max-retries[一時的なエラーで再試行する最大回数]:count:'
+                            ;;
                         ask)
                             _arguments \
-                                '--llm[LLMモデルを指定]:model:(anthropic.claude-3-5-sonnet-20240620-v1:0 amazon.titan-text-express-v1)' \
-                                '(-d --debug)'{-d,--debug}'[デバッグモードを有効にする]'
+                                '--llm[LLMモデルを指定]:model:_hiracli_models' \
+                                '(-d --debug)'{-d,--debug}'[デバッグモードを有効にする]' \
+                                '--no-stream[ストリーミングを使用しない]' \
+                                '--session[会話を保存・再開するセッション名]:session:' \
+                                '--prompt-file[質問に添えるファイル]:file:_files' \
+                                '--system[システムプロンプトを指定]:system:' \
+                                '--system-file[システムプロンプトを記述したファイル]:file:_files' \
+                                '--template[プロンプトテンプレート名]:template:' \
+                                '--lang[回答の言語]:lang:' \
+                                '*--var[テンプレートに渡す変数]:var:' \
+                                '--max-tokens[最大出力トークン数]:tokens:' \
+                                '--temperature[温度]:temperature:' \
+                                '--top-p[top-p]:top-p:' \
+                                '--top-k[top-k]:top-k:' \
+                                '*--stop[停止シーケンス]:sequence:' \
+                                '--auto-continue[途切れた回答の続きを自動取得する回数]:count:' \
+                                '--api[モデルの呼び出しに使用するAPI]:api:(invoke converse)' \
+                                '--tools[モデルに提供するツール]:tools:(all read_file list_directory grep git)' \
+                                '--approve-tools[ツールの実行前に確認を求めない]' \
+                                '*--attach[質問に添付する画像やドキュメント]:file:_files' \
+                                '--region[AWSのリージョン]:region:(us-east-1 us-west-2 ap-northeast-1 ap-southeast-1 eu-central-1 eu-west-1)' \
+                                '--profile[AWSの名前付きプロファイル]:profile:' \
+                                '--assume-role-arn[引き受けるIAMロールのARN]:arn:' \
+                                '--config-profile[設定ファイルのプロファイル]:profile:' \
+                                '--timeout[API呼び出し全体のタイムアウト]:duration:(30s 1m 5m 10m)' \
+                                '--max-retries[一時的なエラーで再試行する最大回数]:count:'
+                            ;;
+                        check)
+                            _arguments \
+                                '--api[使用するAPI]:api:(invoke converse)' \
+                                '--region[AWSのリージョン]:region:(us-east-1 us-west-2 ap-northeast-1 ap-southeast-1 eu-central-1 eu-west-1)' \
+                                '--profile[AWSの名前付きプロファイル]:profile:' \
+                                '--assume-role-arn[引き受けるIAMロールのARN]:arn:' \
+                                '--config-profile[設定ファイルのプロファイル]:profile:' \
+                                '--timeout[API呼び出し全体のタイムアウト]:duration:(30s 1m 5m 10m)' \
+                                '--max-retries[一時的なエラーで再試行する最大回数]:count:' \
+                                '1:model:_hiracli_models'
+                            ;;
+                        sessions)
+                            _values 'sessions commands' list show rm export
+                            ;;
+                        templates)
+                            _values 'templates commands' list show path
+                            ;;
+                        usage)
+                            _arguments \
+                                '--since[集計の開始時点]:since:(1d 7d 30d)' \
+                                '--by[集計キー]:key:(model day command user)'
+                            ;;
+                        count-tokens)
+                            _arguments \
+                                '--tokenizer[トークナイザー]:tokenizer:(cl100k o200k heuristic)' \
+                                '--output[出力形式]:format:(table json yaml)' \
+                                '--config-profile[設定ファイルのプロファイル]:profile:' \
+                                '*:file:_files'
                             ;;
                         flatten-src)
                             _arguments \
                                 '--pattern[ファイルを検索する正規表現パターン]:pattern:' \
                                 '--extension[ファイル拡張子でフィルタリング]:extension:' \
+                                '*--include[対象にするファイルのglobパターン]:glob:' \
+                                '*--exclude[除外するファイルとディレクトリのglobパターン]:glob:' \
                                 '(-p --path)'{-p,--path}'[検索を開始するディレクトリパス]:directory:_files -/' \
                                 '--depth-limit[ディレクトリ探索の深さ制限]:depth:(5 10 15 20)' \
                                 '--max-input-tokens[最大トークン数]:tokens:(50000 100000 200000 300000)' \
+                                '--tokenizer[トークナイザー]:tokenizer:(cl100k o200k heuristic)' \
+                                '--no-ignore[.gitignoreや.hiracliignoreを使用しない]' \
+                                '--hidden[隠しファイルも対象にする]' \
+                                '(--git-changed --git-staged --since)--git-tracked[Gitで管理されているファイルのみ]' \
+                                '(--git-tracked --git-staged --since)--git-changed[HEADから変更されたファイルのみ]' \
+                                '(--git-tracked --git-changed --since)--git-staged[ステージングされたファイルのみ]' \
+                                '(--git-tracked --git-changed --git-staged)--since[指定した参照から変更されたファイルのみ]:ref:' \
+                                '--budget[トークン数の制限を超える場合の扱い]:budget:(skip stop truncate)' \
+                                '--order[ファイルを含める優先順位]:order:(path recent size)' \
+                                '*--weight[パスの重み（glob=重み）]:weight:' \
+                                '--config-profile[設定ファイルのプロファイル]:profile:' \
                                 '(-d --debug)'{-d,--debug}'[デバッグモードを有効にする]'
                             ;;
                     esac
                     ;;
+                config)
+                    subcmds=(
+                        'get:設定値を表示'
+                        'set:設定ファイルに値を書き込む'
+                        'list:設定値と設定元の一覧を表示'
+                        'path:設定ファイルのパスを表示'
+                    )
+                    _describe 'config commands' subcmds
+                    case $words[2] in
+                        get)
+                            _arguments \
+                                '--config-profile[設定ファイルのプロファイル]:profile:' \
+                                '1:key:(profile default_model aws_profile region assume_role_arn lang max_tokens max_input_tokens model_cache_ttl tokenizer)'
+                            ;;
+                        list)
+                            _arguments \
+                                '--config-profile[設定ファイルのプロファイル]:profile:'
+                            ;;
+                        set)
+                            _arguments \
+                                '--repo[リポジトリの設定ファイルに書き込む]' \
+                                '--config-profile[プロファイルの設定として書き込む]:profile:' \
+                                '1:key:(profile default_model aws_profile region assume_role_arn lang max_tokens max_input_tokens model_cache_ttl tokenizer)' \
+                                '2:value:'
+                            ;;
+                    esac
+                    ;;
             esac
             ;;
     esac